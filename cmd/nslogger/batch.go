@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/fouge/nslogger"
+)
+
+func runBatch(args []string) error {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	var out outputFlags
+	out.register(fs)
+	var ff filterFlags
+	ff.register(fs)
+	outDir := fs.String("outdir", "", "directory of the output files, that of each capture file if empty")
+	jobs := fs.Int("jobs", 0, "number of capture files converted at once, the number of CPUs if 0")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return errors.New("expected capture file patterns, e.g. 'captures/*.rawnsloggerdata'")
+	}
+	switch {
+	case out.output != "":
+		return errors.New("-o does not apply to batch conversion, see -outdir")
+	case out.format == "raw" || out.format == "bulk" || out.es != "":
+		return fmt.Errorf("batch conversion does not support the %s format", out.format)
+	}
+
+	opts, err := out.options()
+	if err != nil {
+		return err
+	}
+	filterOpts, err := ff.options()
+	if err != nil {
+		return err
+	}
+	opts = append(append(opts, filterOpts...), nslogger.WithSeparator(out.separator))
+
+	results, err := nslogger.ConvertFiles(fs.Args(), nslogger.BatchOptions{OutputDir: *outDir, Workers: *jobs, Options: opts})
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", r.Input, r.Err)
+			failed++
+		} else {
+			fmt.Printf("%s -> %s\n", r.Input, r.Output)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d capture files failed to convert", failed, len(results))
+	}
+	return nil
+}
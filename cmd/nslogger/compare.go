@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/fouge/nslogger"
+)
+
+func runCompare(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	bySeq := fs.Bool("seq", false, "match messages by sequence number, for captures of the same run")
+	tolerance := fs.Duration("tolerance", 0, `only match messages logged at most this long apart since the start of their capture, e.g. "2s"`)
+	exact := fs.Bool("exact", false, "match message texts exactly, rather than ignoring numbers and addresses")
+	color := fs.String("color", "auto", "color the output: auto, always or never")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return errors.New("expected two capture files")
+	}
+
+	var captures [2][]nslogger.Message
+	for i, name := range fs.Args() {
+		data, err := readInput([]string{name})
+		if err != nil {
+			return err
+		}
+		if captures[i], err = nslogger.Decode(data, nslogger.WithInterning()); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	colored, err := colorEnabled(*color, "")
+	if err != nil {
+		return err
+	}
+	var opts []nslogger.Option
+	if colored {
+		opts = append(opts, nslogger.WithColor())
+	}
+
+	c := nslogger.Compare(captures[0], captures[1], nslogger.CompareOptions{BySeq: *bySeq, Tolerance: *tolerance, ExactText: *exact})
+	if err := nslogger.WriteComparison(os.Stdout, c, opts...); err != nil {
+		return err
+	}
+	if !c.Equal() {
+		return fmt.Errorf("captures differ: %d messages matched, %d only in %s, %d only in %s",
+			c.Matched, len(c.OnlyA), fs.Arg(0), len(c.OnlyB), fs.Arg(1))
+	}
+	return nil
+}
@@ -0,0 +1,719 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"math"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fouge/nslogger"
+)
+
+/** outputFlags are the flags controlling how messages are output. */
+type outputFlags struct {
+	format    string
+	separator string
+	output    string
+	binary    string
+	binaryMax int
+	width     int
+	time      string
+	utc       bool
+	relative  bool
+	indent    string
+	recover   bool
+	lenient   bool
+	quirks    string
+	maxSize   string
+	warn      bool
+	strict    bool
+	header    bool
+	columns   string
+	reorder   int
+	collapse  bool
+	stitch    bool
+	redact    bool
+	redactRE  []*regexp.Regexp
+	mask      string
+	workers   int
+	index     string
+	es        string
+	color     string
+	highlight string
+	images    imageFlags
+}
+
+/** outputFormats are the named output formats, templates aside, described
+ * for usage messages. */
+var outputFormats = []struct{ name, desc string }{
+	{"text", "text"},
+	{"table", "aligned columns"},
+	{"json", "JSON"},
+	{"csv", "CSV"},
+	{"logfmt", "logfmt"},
+	{"html", "HTML"},
+	{"raw", "NSLogger binary format"},
+	{"bulk", "Elasticsearch bulk requests"},
+}
+
+/** formatUsage lists the output formats for usage messages, by description,
+ * or by name followed by the description when they differ. */
+func formatUsage(names bool) string {
+	list := make([]string, len(outputFormats))
+	for i, f := range outputFormats {
+		switch {
+		case !names:
+			list[i] = f.desc
+		case strings.EqualFold(f.name, f.desc):
+			list[i] = f.name
+		default:
+			list[i] = f.name + " (" + f.desc + ")"
+		}
+	}
+	return strings.Join(list, ", ")
+}
+
+func (f *outputFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.format, "format", "text", "output format: "+formatUsage(true)+` or a template such as "{{.Time}} [{{.Tag}}] {{.Message}}"`)
+	fs.StringVar(&f.separator, "sep", ",", "separator of text output fields")
+	fs.IntVar(&f.width, "width", 0, "width of table output lines, messages being elided to fit; $COLUMNS when writing to the standard output, unlimited if 0")
+	fs.StringVar(&f.output, "o", "", "output file, standard output if empty")
+	fs.StringVar(&f.binary, "binary", "hex", "binary payload encoding: hex, base64 or hexdump (16 bytes per line in hexadecimal and ASCII, on lines of their own in text output)")
+	fs.IntVar(&f.binaryMax, "binary-max", 0, "render only the first bytes of binary payloads, all if 0")
+	fs.StringVar(&f.time, "time", "", `timestamp layout, e.g. "2006-01-02T15:04:05Z07:00", "unix" or "unixmilli"`)
+	fs.BoolVar(&f.utc, "utc", false, "output timestamps in UTC rather than local time")
+	fs.BoolVar(&f.relative, "relative", false, "output the time since the start of the capture and since the previous message (elapsed and delta columns) in place of timestamps")
+	fs.StringVar(&f.columns, "columns", "", `comma-separated columns of text and CSV output, e.g. "time,level,tag,message"`)
+	fs.StringVar(&f.color, "color", "auto", "color text output: auto (when writing to a terminal and NO_COLOR is not set), always or never")
+	fs.StringVar(&f.highlight, "highlight", "", "regular expression whose matches are highlighted in colored text output")
+	fs.BoolVar(&f.header, "header", false, "start text output with a line naming its columns")
+	fs.StringVar(&f.indent, "indent", "", "indentation of text lines per enclosing block")
+	fs.BoolVar(&f.recover, "recover", false, "skip corrupt messages instead of failing")
+	fs.BoolVar(&f.lenient, "lenient", false, "skip message parts of unknown types instead of failing")
+	fs.StringVar(&f.quirks, "quirks", "", "comma-separated deviations from the binary format of client ports to accept: little-endian, int16-image-size, unsized-strings")
+	fs.StringVar(&f.maxSize, "max-message-size", "", `reject messages larger than this size, e.g. "16M"`)
+	fs.BoolVar(&f.warn, "warn", false, "report anomalies such as out-of-order sequence numbers on standard error")
+	fs.BoolVar(&f.strict, "strict", false, "fail on an incomplete message at the end of the file")
+	fs.StringVar(&f.index, "index", nslogger.DefaultBulkIndex, `index name of bulk output, "{date}" being replaced by the message date`)
+	fs.StringVar(&f.es, "es", "", "index messages in the Elasticsearch or OpenSearch cluster at this URL instead of writing bulk output")
+	fs.IntVar(&f.reorder, "reorder", 0, "output messages in sequence order, holding back up to this many messages")
+	fs.BoolVar(&f.collapse, "collapse", false, "collapse runs of identical messages into one line with a repeat count")
+	fs.BoolVar(&f.stitch, "stitch", false, "merge the reconnections of clients, dropping repeated client infos and resent messages")
+	fs.BoolVar(&f.redact, "redact", false, "mask email addresses, phone numbers and bearer tokens in message texts")
+	fs.Func("redact-pattern", "also mask the matches of this regular expression in message texts, only its capture groups if it has some; can be repeated", func(s string) error {
+		re, err := regexp.Compile(s)
+		if err == nil {
+			f.redactRE = append(f.redactRE, re)
+		}
+		return err
+	})
+	fs.StringVar(&f.mask, "redact-mask", nslogger.DefaultRedactionMask, "text replacing masked content")
+	fs.IntVar(&f.workers, "workers", runtime.GOMAXPROCS(0), "number of goroutines decoding messages")
+	f.images.register(fs)
+}
+
+/** imageFlags are the flags converting image payloads. */
+type imageFlags struct {
+	format  string
+	quality int
+	size    string
+}
+
+func (f *imageFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.format, "image-format", "", "re-encode images in this format: png or jpeg")
+	fs.IntVar(&f.quality, "image-quality", 0, "quality of JPEG images, from 1 to 100")
+	fs.StringVar(&f.size, "thumbnail", "", `scale images down to fit this size in pixels, e.g. "320x480"`)
+}
+
+/** options returns the option converting images, if any. */
+func (f *imageFlags) options() ([]nslogger.Option, error) {
+	if f.format == "" && f.size == "" {
+		return nil, nil
+	}
+	c := nslogger.ImageConversion{Quality: f.quality}
+	switch f.format {
+	case "", "png":
+	case "jpeg", "jpg":
+		c.Format = nslogger.ImageJPEG
+	default:
+		return nil, fmt.Errorf("unsupported image format %q", f.format)
+	}
+	if f.size != "" {
+		w, h, ok := strings.Cut(f.size, "x")
+		var err error
+		if ok {
+			if c.MaxWidth, err = strconv.Atoi(w); err == nil {
+				c.MaxHeight, err = strconv.Atoi(h)
+			}
+		}
+		if !ok || err != nil || c.MaxWidth <= 0 || c.MaxHeight <= 0 {
+			return nil, fmt.Errorf("invalid thumbnail size %q, expected WIDTHxHEIGHT", f.size)
+		}
+	}
+	return []nslogger.Option{nslogger.WithImageConversion(c)}, nil
+}
+
+func (f *outputFlags) options() ([]nslogger.Option, error) {
+	var opts []nslogger.Option
+
+	switch f.format {
+	case "text", "raw", "bulk":
+	case "json":
+		opts = append(opts, nslogger.WithFormat(nslogger.FormatJSON))
+	case "csv":
+		opts = append(opts, nslogger.WithFormat(nslogger.FormatCSV))
+	case "logfmt":
+		opts = append(opts, nslogger.WithFormat(nslogger.FormatLogfmt))
+	case "html":
+		opts = append(opts, nslogger.WithFormat(nslogger.FormatHTML))
+	case "table":
+		opts = append(opts, nslogger.WithFormat(nslogger.FormatTable))
+		width := f.width
+		if width == 0 && f.output == "" {
+			width, _ = strconv.Atoi(os.Getenv("COLUMNS"))
+		}
+		opts = append(opts, nslogger.WithTableWidths(nslogger.TableWidths{Width: width}))
+	default:
+		if !strings.Contains(f.format, "{{") {
+			return nil, fmt.Errorf("unknown format %q, expected %s or a template", f.format, formatUsage(true))
+		}
+		tmpl, err := nslogger.ParseTemplate(f.format)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, nslogger.WithTemplate(tmpl))
+	}
+
+	switch f.binary {
+	case "hex":
+	case "base64":
+		opts = append(opts, nslogger.WithBinaryFormat(nslogger.BinaryBase64))
+	case "hexdump":
+		opts = append(opts, nslogger.WithBinaryFormat(nslogger.BinaryHexDump))
+	default:
+		return nil, fmt.Errorf("unknown binary encoding %q", f.binary)
+	}
+
+	imageOpts, err := f.images.options()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, imageOpts...)
+
+	if f.binaryMax > 0 {
+		opts = append(opts, nslogger.WithBinaryMaxBytes(f.binaryMax))
+	}
+	if f.time != "" {
+		opts = append(opts, nslogger.WithTimeLayout(f.time))
+	}
+	if f.utc {
+		opts = append(opts, nslogger.WithLocation(time.UTC))
+	}
+	if f.relative {
+		opts = append(opts, nslogger.WithRelativeTimes())
+	}
+	if f.columns != "" {
+		opts = append(opts, nslogger.WithColumns(split(f.columns)...))
+	}
+	color, err := colorEnabled(f.color, f.output)
+	if err != nil {
+		return nil, err
+	}
+	if color {
+		opts = append(opts, nslogger.WithColor())
+	}
+	if f.highlight != "" {
+		re, err := regexp.Compile(f.highlight)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, nslogger.WithHighlight(re))
+	}
+	if f.header {
+		opts = append(opts, nslogger.WithHeader())
+	}
+	if f.indent != "" {
+		opts = append(opts, nslogger.WithBlockIndent(f.indent))
+	}
+	if f.reorder > 0 {
+		opts = append(opts, nslogger.WithReorder(f.reorder))
+	}
+	if f.collapse {
+		opts = append(opts, nslogger.WithCollapse())
+	}
+	if f.stitch {
+		opts = append(opts, nslogger.WithStitching())
+	}
+	if f.redact || f.redactRE != nil {
+		var r nslogger.Redaction
+		if f.redact {
+			r = nslogger.DefaultRedaction()
+		}
+		r.Patterns = append(r.Patterns, f.redactRE...)
+		r.Mask = f.mask
+		opts = append(opts, nslogger.WithRedaction(r))
+	}
+	if f.workers > 1 {
+		opts = append(opts, nslogger.WithWorkers(f.workers))
+	}
+	if f.strict {
+		opts = append(opts, nslogger.WithStrict())
+	}
+	if f.recover {
+		opts = append(opts, nslogger.WithRecovery(func(r nslogger.SkippedRange) {
+			log.Printf("skipped bytes %d-%d: %v", r.Start, r.End, r.Err)
+		}))
+	}
+	switch {
+	case f.lenient && f.warn:
+		opts = append(opts, nslogger.WithLenient(nil)) // skipped parts are reported as warnings
+	case f.lenient:
+		opts = append(opts, nslogger.WithLenient(func(p nslogger.SkippedPart) {
+			log.Printf("skipped part at offset %d: %v", p.Offset, p.Err)
+		}))
+	}
+	if f.quirks != "" {
+		var q nslogger.Quirks
+		for _, name := range split(f.quirks) {
+			switch name {
+			case "little-endian":
+				q |= nslogger.QuirkLittleEndian
+			case "int16-image-size":
+				q |= nslogger.QuirkInt16ImageSize
+			case "unsized-strings":
+				q |= nslogger.QuirkUnsizedStrings
+			default:
+				return nil, fmt.Errorf("unknown quirk %q", name)
+			}
+		}
+		opts = append(opts, nslogger.WithQuirks(q))
+	}
+	if f.maxSize != "" {
+		n, err := parseSize(f.maxSize)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, nslogger.WithLimits(nslogger.Limits{MaxMessageSize: uint32(min(n, math.MaxUint32))}))
+	}
+	if f.warn {
+		opts = append(opts, nslogger.WithWarnings(func(w nslogger.Warning) {
+			log.Printf("warning: %v", w)
+		}))
+	}
+
+	return opts, nil
+}
+
+/** filterFlags are the flags selecting the messages to output. */
+type filterFlags struct {
+	preset      string
+	presets     string
+	tags        string
+	excludeTags string
+	threads     string
+	level       int
+	tagLevels   string
+	pattern     string
+	before      int
+	after       int
+	context     int
+	since       string
+	until       string
+	sampleEvery int
+	sampleTags  string
+	maxRate     int
+	fromMark    string
+	toMark      string
+}
+
+func (f *filterFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.preset, "preset", "", "start from the filter preset with this name, which the other flags refine")
+	fs.StringVar(&f.presets, "presets", "", "JSON file defining filter presets, $"+nslogger.PresetsEnv+" or nslogger/presets.json in the user configuration directory if empty")
+	fs.StringVar(&f.tags, "tag", "", "comma-separated tags to keep")
+	fs.StringVar(&f.excludeTags, "exclude-tag", "", "comma-separated tags to drop")
+	fs.StringVar(&f.threads, "thread", "", "comma-separated threads to keep")
+	fs.IntVar(&f.level, "level", -1, "keep levels up to this one (0=Error ... 4=Verbose)")
+	fs.StringVar(&f.tagLevels, "tag-level", "", `comma-separated levels to keep up to per tag, overriding -level, e.g. "network=verbose,ui=1"`)
+	fs.StringVar(&f.pattern, "grep", "", "regular expression the message text, tag, file or function must match")
+	fs.IntVar(&f.before, "B", 0, "also output this number of messages before each -grep match")
+	fs.IntVar(&f.after, "A", 0, "also output this number of messages after each -grep match")
+	fs.IntVar(&f.context, "C", 0, "also output this number of messages around each -grep match")
+	fs.StringVar(&f.since, "since", "", "keep messages logged from this RFC 3339 time")
+	fs.StringVar(&f.until, "until", "", "keep messages logged before this RFC 3339 time")
+	fs.IntVar(&f.sampleEvery, "sample-every", 0, "keep one log message out of this number")
+	fs.StringVar(&f.sampleTags, "sample-tag", "", `comma-separated probabilities of keeping the log messages of tags, e.g. "network=0.1"`)
+	fs.IntVar(&f.maxRate, "max-rate", 0, "keep at most this number of log messages per second")
+	fs.StringVar(&f.fromMark, "from-mark", "", "keep messages from the mark with this label")
+	fs.StringVar(&f.toMark, "to-mark", "", "keep messages up to the mark with this label")
+}
+
+/** options returns the options selecting messages. */
+func (f *filterFlags) options() ([]nslogger.Option, error) {
+	filter, err := f.filter()
+	if err != nil {
+		return nil, err
+	}
+	opts := []nslogger.Option{nslogger.WithFilter(filter)}
+	if f.fromMark != "" || f.toMark != "" {
+		opts = append(opts, nslogger.WithMarkRange(f.fromMark, f.toMark))
+	}
+
+	if f.pattern != "" {
+		re, err := regexp.Compile(f.pattern)
+		if err != nil {
+			return nil, err
+		}
+		g := nslogger.Grep{Pattern: re, Before: f.before, After: f.after}
+		if f.context > 0 {
+			g.Before, g.After = max(g.Before, f.context), max(g.After, f.context)
+		}
+		opts = append(opts, nslogger.WithGrep(g))
+	}
+
+	if f.sampleEvery > 1 || f.sampleTags != "" || f.maxRate > 0 {
+		sampling := nslogger.Sampling{Every: f.sampleEvery, PerSecond: f.maxRate}
+		for _, tr := range split(f.sampleTags) {
+			tag, value, ok := strings.Cut(tr, "=")
+			rate, err := strconv.ParseFloat(value, 64)
+			if !ok || err != nil || rate < 0 || rate > 1 {
+				return nil, fmt.Errorf("invalid tag sampling %q, expected tag=probability", tr)
+			}
+			if sampling.TagRates == nil {
+				sampling.TagRates = make(map[string]float64)
+			}
+			sampling.TagRates[tag] = rate
+		}
+		opts = append(opts, nslogger.WithSampling(sampling))
+	}
+	return opts, nil
+}
+
+func (f *filterFlags) filter() (*nslogger.Filter, error) {
+	filter := &nslogger.Filter{}
+	if f.preset != "" {
+		preset, err := f.loadPreset()
+		if err != nil {
+			return nil, err
+		}
+		*filter = *preset
+		filter.TagLevels = maps.Clone(preset.TagLevels)
+	}
+	if f.tags != "" {
+		filter.Tags = split(f.tags)
+	}
+	if f.excludeTags != "" {
+		filter.ExcludeTags = split(f.excludeTags)
+	}
+	if f.threads != "" {
+		filter.Threads = split(f.threads)
+	}
+
+	if f.level >= 0 {
+		filter.MinLevel = &f.level
+	}
+	for _, tl := range split(f.tagLevels) {
+		tag, name, ok := strings.Cut(tl, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid tag level %q, expected tag=level", tl)
+		}
+		level, err := nslogger.ParseLevel(name)
+		if err != nil {
+			return nil, err
+		}
+		if filter.TagLevels == nil {
+			filter.TagLevels = make(map[string]int)
+		}
+		filter.TagLevels[tag] = level
+	}
+
+	var err error
+	if f.since != "" {
+		if filter.Start, err = time.Parse(time.RFC3339, f.since); err != nil {
+			return nil, err
+		}
+	}
+	if f.until != "" {
+		if filter.End, err = time.Parse(time.RFC3339, f.until); err != nil {
+			return nil, err
+		}
+	}
+
+	return filter, nil
+}
+
+/** loadPreset returns the filter preset named by the -preset flag, from the
+ * presets file of the -presets flag. */
+func (f *filterFlags) loadPreset() (*nslogger.Filter, error) {
+	name := f.presets
+	if name == "" {
+		name = os.Getenv(nslogger.PresetsEnv)
+	}
+	if name == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, err
+		}
+		name = filepath.Join(dir, "nslogger", "presets.json")
+	}
+
+	presets, err := nslogger.LoadPresets(name)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := presets.Filter(f.preset)
+	if err != nil {
+		return nil, fmt.Errorf("%w, %s defines: %s", err, name, strings.Join(presets.Names(), ", "))
+	}
+	return filter, nil
+}
+
+/** colorEnabled reports whether text output to the output file is colored
+ * according to the -color flag value mode. */
+func colorEnabled(mode, output string) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		return output == "" && nslogger.ColorEnabled(os.Stdout), nil
+	}
+	return false, fmt.Errorf("unknown color mode %q", mode)
+}
+
+func split(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
+}
+
+func runConvert(args []string) error {
+	return convert("convert", args, false)
+}
+
+func runFilter(args []string) error {
+	return convert("filter", args, true)
+}
+
+/** convert parses the capture file given in args and writes it in the
+ * requested output format, filtering messages if filters is set. */
+func convert(name string, args []string, filters bool) error {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	var out outputFlags
+	out.register(fs)
+	var ff filterFlags
+	if filters {
+		ff.register(fs)
+	}
+	follow := fs.Bool("f", false, "keep reading the file as it grows, outputting messages as they are written (text, json, logfmt and template formats)")
+	byThread := fs.Bool("by-thread", false, "group text output by thread, each group starting with a line naming its thread")
+	at := fs.String("at", "", "start around the messages logged at this RFC 3339 time, seeking with the index of the file (text, json, logfmt and template formats)")
+	seq := fs.Int("seq", 0, "start around the message with this sequence number, seeking with the index of the file (text, json, logfmt and template formats)")
+	fs.Parse(args)
+
+	opts, err := out.options()
+	if err != nil {
+		return err
+	}
+	if filters {
+		filterOpts, err := ff.options()
+		if err != nil {
+			return err
+		}
+		opts = append(opts, filterOpts...)
+	}
+
+	if *follow || *at != "" || *seq != 0 {
+		seek, err := seekFunc(*at, *seq)
+		if err != nil {
+			return err
+		}
+		return streamInput(fs.Args(), out.output, *follow, seek, append(opts, nslogger.WithSeparator(out.separator)))
+	}
+
+	data, err := readInput(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case out.format == "raw":
+		return writeRaw(data, out.output, opts)
+	case out.es != "":
+		msgs, err := nslogger.Decode(data, opts...)
+		if err != nil {
+			return err
+		}
+		return nslogger.PostBulk(nil, out.es, out.index, msgs)
+	case out.format == "bulk":
+		return writeBulk(data, out.output, out.index, opts)
+	case *byThread:
+		if out.format != "text" {
+			return errors.New("-by-thread only applies to text output")
+		}
+		return writeByThread(data, out.output, append(opts, nslogger.WithSeparator(out.separator)))
+	}
+
+	w, err := createOutput(out.output)
+	if err != nil {
+		return err
+	}
+	if err := nslogger.ParseToWriter(data, w, append(opts, nslogger.WithSeparator(out.separator))...); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+/** seekFunc returns the function locating the first message to output in
+ * an index, as requested by the -at and -seq flags, nil if none is. */
+func seekFunc(at string, seq int) (func(ix *nslogger.Index) int64, error) {
+	switch {
+	case at != "" && seq != 0:
+		return nil, errors.New("-at and -seq are mutually exclusive")
+	case at != "":
+		t, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			return nil, err
+		}
+		return func(ix *nslogger.Index) int64 { return ix.OffsetAt(t) }, nil
+	case seq != 0:
+		return func(ix *nslogger.Index) int64 { return ix.OffsetOfSeq(seq) }, nil
+	}
+	return nil, nil
+}
+
+/** streamInput outputs the messages of the capture file given in args as
+ * they are decoded, from the offset returned by seek for its index if set,
+ * and as the file grows until interrupted if follow is set. */
+func streamInput(args []string, output string, follow bool, seek func(ix *nslogger.Index) int64, opts []nslogger.Option) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected one capture file, got %d arguments", len(args))
+	}
+	f := os.Stdin
+	if args[0] != "-" {
+		var err error
+		if f, err = os.Open(args[0]); err != nil {
+			return err
+		}
+		defer f.Close()
+	}
+	if seek != nil {
+		if args[0] == "-" {
+			return errors.New("cannot seek in the standard input")
+		}
+		ix, err := nslogger.LoadIndex(args[0])
+		if err != nil {
+			return err
+		}
+		if _, err := f.Seek(seek(ix), io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	w, err := createOutput(output)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	var r io.Reader = f
+	if follow {
+		r = nslogger.Follow(ctx, f, 0)
+	}
+	err = nslogger.ParseStream(r, w, append(opts, nslogger.WithContext(ctx))...)
+	if errors.Is(err, context.Canceled) {
+		err = nil
+	}
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+/** writeRaw writes the messages of data selected by opts in the NSLogger
+ * binary format, as a smaller capture the desktop viewer can open. */
+func writeRaw(data []byte, output string, opts []nslogger.Option) error {
+	msgs, err := nslogger.Decode(data, opts...)
+	if err != nil {
+		return err
+	}
+
+	w, err := createOutput(output)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	e := nslogger.NewEncoder(bw)
+	for i := range msgs {
+		if err := e.Encode(&msgs[i]); err != nil {
+			w.Close()
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+/** writeByThread writes the text output of the messages of data selected by
+ * opts grouped by thread. */
+func writeByThread(data []byte, output string, opts []nslogger.Option) error {
+	msgs, err := nslogger.Decode(data, opts...)
+	if err != nil {
+		return err
+	}
+
+	w, err := createOutput(output)
+	if err != nil {
+		return err
+	}
+	if err := nslogger.WriteByThread(w, msgs, opts...); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+/** writeBulk writes the messages of data selected by opts as the body of an
+ * Elasticsearch bulk API request. */
+func writeBulk(data []byte, output, index string, opts []nslogger.Option) error {
+	msgs, err := nslogger.Decode(data, opts...)
+	if err != nil {
+		return err
+	}
+
+	w, err := createOutput(output)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	b := nslogger.NewBulkWriter(bw, index)
+	for i := range msgs {
+		if err := b.Write(&msgs[i]); err != nil {
+			w.Close()
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/fouge/nslogger"
+)
+
+func runImages(args []string) error {
+	fs := flag.NewFlagSet("images", flag.ExitOnError)
+	dir := fs.String("o", ".", "directory where images are written, along with a "+nslogger.ManifestFilename+" file describing them")
+	binary := fs.Bool("binary", false, "also extract binary payloads, as .bin files")
+	var images imageFlags
+	images.register(fs)
+	fs.Parse(args)
+
+	opts, err := images.options()
+	if err != nil {
+		return err
+	}
+
+	data, err := readInput(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	msgs, err := nslogger.Decode(data, opts...)
+	if err != nil {
+		return err
+	}
+	if !*binary {
+		for i := range msgs {
+			msgs[i].Binary = nil
+		}
+	}
+
+	attachments, err := nslogger.ExtractAttachments(*dir, msgs)
+	for _, a := range attachments {
+		fmt.Println(filepath.Join(*dir, a.File))
+	}
+	return err
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/fouge/nslogger"
+)
+
+func runIndex(args []string) error {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 || fs.Arg(0) == "-" {
+		return fmt.Errorf("expected one capture file, got %d arguments", fs.NArg())
+	}
+
+	ix, err := nslogger.LoadIndex(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Index:\t%s\n", fs.Arg(0)+nslogger.IndexFileExt)
+	fmt.Fprintf(w, "Messages:\t%d\n", ix.Messages)
+	fmt.Fprintf(w, "Entries:\t%d (every %d messages)\n", len(ix.Entries), ix.Interval)
+	if n := len(ix.Entries); n > 0 {
+		fmt.Fprintf(w, "From:\t%s\n", ix.Entries[0].Timestamp.Format(nslogger.DefaultTimeLayout))
+		fmt.Fprintf(w, "To:\t%s\n", ix.Entries[n-1].Timestamp.Format(nslogger.DefaultTimeLayout))
+	}
+	return w.Flush()
+}
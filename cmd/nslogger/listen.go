@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fouge/nslogger"
+)
+
+func runListen(args []string) error {
+	fs := flag.NewFlagSet("listen", flag.ExitOnError)
+	addr := fs.String("addr", nslogger.DefaultListenerAddr, "TCP address to listen on")
+	drain := fs.Duration("drain", 10*time.Second, "once interrupted, wait up to this time for clients to disconnect, decoding their last messages")
+	udp := fs.Bool("udp", false, "also receive messages sent in datagrams to the UDP port of -addr, one message per datagram")
+	udpTimeout := fs.Duration("udp-timeout", nslogger.DefaultUDPTimeout, "disconnect UDP clients after this time without datagrams")
+	wsAddr := fs.String("websocket", "", `also accept clients over WebSocket on this address, e.g. ":8082", sending binary NSLogger frames`)
+	var wsOrigins []string
+	fs.Func("websocket-origin", `with -websocket, also accept browser clients of pages of this origin, e.g. "https://app.example.com", with * wildcards; can be repeated`, func(s string) error {
+		wsOrigins = append(wsOrigins, s)
+		return nil
+	})
+	readBuffer := fs.String("read-buffer", "", `kernel receive buffer size of each connection, e.g. "256K"`)
+	rate := fs.String("rate", "", `read each connection at up to this many bytes per second, e.g. "1M"`)
+	queue := fs.Int("queue", 0, "decode up to this many messages of each connection ahead of their output, pausing reads beyond")
+	queueSize := fs.String("queue-size", "", `decode up to this size of messages of each connection ahead of their output, pausing reads beyond, e.g. "8M"`)
+	useTLS := fs.Bool("tls", false, "accept TLS connections, with a self-signed certificate unless -cert and -key are set")
+	certFile := fs.String("cert", "", "TLS certificate file")
+	keyFile := fs.String("key", "", "TLS key file")
+	clientCA := fs.String("client-ca", "", "accept only TLS clients with a certificate signed by the CAs of this PEM file, enabling -tls")
+	var tokens []string
+	fs.Func("token", "accept only clients sending this token in their client info message; can be repeated", func(s string) error {
+		tokens = append(tokens, s)
+		return nil
+	})
+	bonjour := fs.Bool("bonjour", false, "advertise the listener with Bonjour")
+	name := fs.String("name", "", "Bonjour instance name, the host name if empty")
+	format := fs.String("format", "text", "output format: text or json")
+	sep := fs.String("sep", " ", "separator of text output fields")
+	colorFlag := fs.String("color", "auto", "color text output: auto (when writing to a terminal and NO_COLOR is not set), always or never")
+	lokiURL := fs.String("loki", "", "also push messages to this Loki push API URL, e.g. http://localhost:3100/loki/api/v1/push")
+	lokiLabels := fs.String("loki-labels", "", `comma-separated static labels of the messages pushed to Loki, e.g. "job=ios,env=qa"`)
+	record := fs.String("record", "", `record the messages received, unfiltered, to this capture file, e.g. "capture.rawnsloggerdata"`)
+	recordSize := fs.String("record-size", "", `start a new capture file when it reaches this size, e.g. "100M", naming files after -record with their creation time`)
+	recordEvery := fs.Duration("record-every", 0, `start a new capture file every time window, e.g. "1h", naming files after -record with their creation time`)
+	recordKeep := fs.Int("record-keep", 0, "keep only this number of capture files, deleting the oldest")
+	recordCompress := fs.Bool("record-compress", false, "gzip-compress capture files once a new one is started")
+	apiAddr := fs.String("api", "", `serve the HTTP API controlling the listener on this address, e.g. "localhost:8081", recording to -record or "capture.rawnsloggerdata"`)
+	stitch := fs.Bool("stitch", false, "merge the reconnections of clients into one session, dropping resent messages")
+	stitchTimeout := fs.Duration("stitch-timeout", nslogger.DefaultStitchTimeout, "with -stitch, forget clients disconnected for this time")
+	storeSize := fs.Int("store", 0, "with -api, retain this many last messages in memory for GET /messages, "+strconv.Itoa(nslogger.DefaultStoreSize)+" if only -store-age is set")
+	storeAge := fs.Duration("store-age", 0, `with -api, retain the messages received during this time window in memory for GET /messages, e.g. "30m"`)
+	metricsAddr := fs.String("metrics", "", `serve Prometheus metrics at /metrics on this address, e.g. ":9100"`)
+	var ff filterFlags
+	ff.register(fs)
+	fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+
+	filterOpts, err := ff.options()
+	if err != nil {
+		return err
+	}
+
+	color, err := colorEnabled(*colorFlag, "")
+	if err != nil {
+		return err
+	}
+
+	var print func(*nslogger.Message) error
+	switch *format {
+	case "text":
+		print = func(m *nslogger.Message) error {
+			_, err := fmt.Println(textLine(m, *sep, color))
+			return err
+		}
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		print = func(m *nslogger.Message) error {
+			return enc.Encode(m)
+		}
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	var loki *nslogger.LokiPusher
+	if *lokiURL != "" {
+		loki = &nslogger.LokiPusher{URL: *lokiURL, ErrorLog: log.New(os.Stderr, "", log.LstdFlags)}
+		loki.Labels, err = parseLabels(*lokiLabels)
+		if err != nil {
+			return err
+		}
+	}
+
+	recordOpts := nslogger.RecordOptions{Interval: *recordEvery, MaxFiles: *recordKeep, Compress: *recordCompress}
+	if *recordSize != "" {
+		if recordOpts.MaxSize, err = parseSize(*recordSize); err != nil {
+			return err
+		}
+	}
+
+	flow := nslogger.FlowControl{MaxQueued: *queue}
+	if *readBuffer != "" {
+		n, err := parseSize(*readBuffer)
+		if err != nil {
+			return err
+		}
+		flow.ReadBuffer = int(n)
+	}
+	if *rate != "" {
+		if flow.BytesPerSecond, err = parseSize(*rate); err != nil {
+			return err
+		}
+	}
+	if *queueSize != "" {
+		if flow.MaxQueuedBytes, err = parseSize(*queueSize); err != nil {
+			return err
+		}
+	}
+
+	var store *nslogger.Store
+	if *storeSize > 0 || *storeAge > 0 {
+		store = nslogger.NewStore(nslogger.StoreOptions{MaxMessages: *storeSize, MaxAge: *storeAge})
+		filterOpts = append(filterOpts, nslogger.WithInterning())
+	} else {
+		filterOpts = append(filterOpts, nslogger.WithMessagePool()) // messages not kept once printed
+	}
+
+	var mu sync.Mutex
+	l := &nslogger.Listener{
+		Addr:             *addr,
+		Bonjour:          *bonjour,
+		BonjourName:      *name,
+		Options:          filterOpts,
+		StitchSessions:   *stitch,
+		StitchTimeout:    *stitchTimeout,
+		UDPTimeout:       *udpTimeout,
+		WebSocketOrigins: wsOrigins,
+		FlowControl:      flow,
+		ErrorLog:         log.New(os.Stderr, "", log.LstdFlags),
+		Handler: func(m *nslogger.Message) {
+			if loki != nil {
+				loki.Handle(m)
+			}
+			if store != nil {
+				store.Add(m)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err := print(m); err != nil {
+				log.Fatal(err)
+			}
+			if store == nil {
+				m.Release()
+			}
+		},
+	}
+
+	if len(tokens) > 0 {
+		l.Auth = &nslogger.ListenerAuth{Tokens: tokens}
+	}
+
+	if *useTLS || *certFile != "" || *keyFile != "" || *clientCA != "" {
+		var cert tls.Certificate
+		if *certFile != "" || *keyFile != "" {
+			cert, err = tls.LoadX509KeyPair(*certFile, *keyFile)
+		} else {
+			cert, err = nslogger.SelfSignedCertificate()
+		}
+		if err != nil {
+			return err
+		}
+		l.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		if *clientCA != "" {
+			pem, err := os.ReadFile(*clientCA)
+			if err != nil {
+				return err
+			}
+			cas := x509.NewCertPool()
+			if !cas.AppendCertsFromPEM(pem) {
+				return fmt.Errorf("no certificate found in %s", *clientCA)
+			}
+			l.TLSConfig = nslogger.MutualTLSConfig(cert, cas)
+		}
+	}
+
+	if *record != "" {
+		if _, err := l.StartRecording(*record, recordOpts); err != nil {
+			return err
+		}
+	}
+	if *apiAddr != "" {
+		recordFile := *record
+		if recordFile == "" {
+			recordFile = "capture.rawnsloggerdata"
+		}
+		api := &nslogger.ListenerAPI{Listener: l, RecordFile: recordFile, RecordOptions: recordOpts, Store: store}
+		go func() {
+			log.Fatal(http.ListenAndServe(*apiAddr, api))
+		}()
+		log.Printf("serving the API on http://%s", *apiAddr)
+	}
+
+	if *wsAddr != "" {
+		go func() {
+			log.Fatal(http.ListenAndServe(*wsAddr, l.WebSocketHandler()))
+		}()
+		log.Printf("accepting WebSocket clients on ws://%s", *wsAddr)
+	}
+
+	if *metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", l.MetricsHandler())
+		go func() {
+			log.Fatal(http.ListenAndServe(*metricsAddr, mux))
+		}()
+		log.Printf("serving metrics on http://%s/metrics", *metricsAddr)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *udp {
+		go func() {
+			if err := l.ListenAndServeUDP(); err != nslogger.ErrListenerClosed {
+				log.Fatal(err)
+			}
+		}()
+		log.Printf("listening on %s/udp", *addr)
+	}
+	if loki != nil {
+		l.RegisterOnShutdown(func() error {
+			if err := loki.Close(); err != nil {
+				return fmt.Errorf("loki: %w", err)
+			}
+			return nil
+		})
+	}
+
+	// Once interrupted, let clients send their last messages before exiting
+	var recorder *nslogger.Recorder
+	shutdown := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		log.Printf("shutting down, waiting up to %v for clients to disconnect", *drain)
+		recorder = l.Recorder
+		dctx, cancel := context.WithTimeout(context.Background(), *drain)
+		defer cancel()
+		shutdown <- l.Shutdown(dctx)
+	}()
+
+	log.Printf("listening on %s", *addr)
+	if err := l.ListenAndServe(); err != nslogger.ErrListenerClosed {
+		return err
+	}
+	err = <-shutdown
+	if err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+	if recorder != nil {
+		if rerr := recorder.Err(); rerr != nil {
+			log.Printf("recording stopped: %v", rerr)
+		}
+		log.Printf("recorded to %s", strings.Join(recorder.Files(), ", "))
+	}
+	return nil
+}
+
+/** parseLabels parses comma-separated name=value pairs. */
+func parseLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, pair := range split(s) {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid label %q, expected name=value", pair)
+		}
+		labels[name] = value
+	}
+	return labels, nil
+}
+
+/** textLine formats a message received by the listener as a line of text,
+ * colored with ANSI escape sequences if color is set. */
+func textLine(m *nslogger.Message, sep string, color bool) string {
+	paint := func(code, s string) string {
+		if !color || code == "" || s == "" {
+			return s
+		}
+		return code + s + nslogger.ColorReset
+	}
+
+	fields := []string{paint(nslogger.ColorDim, m.Timestamp.Format(nslogger.DefaultTimeLayout))}
+	if m.SessionID != 0 {
+		fields = append(fields, paint(nslogger.ColorDim, "#"+strconv.FormatUint(m.SessionID, 10)))
+	}
+
+	switch {
+	case m.IsClientInfo():
+		return strings.Join(append(fields, paint(nslogger.ColorEvent, "Client info: "+m.Client.String())), sep)
+	case m.IsDisconnect():
+		client := "unknown client"
+		if m.Client != nil {
+			client = m.Client.String()
+		}
+		return strings.Join(append(fields, paint(nslogger.ColorEvent, fmt.Sprintf("Client disconnected: %s after %v", client, m.Duration))), sep)
+	case m.IsMark():
+		return strings.Join(append(fields, paint(nslogger.ColorEvent, "--- "+m.Payload+" ---")), sep)
+	}
+
+	level := m.LevelName
+	if level == "" {
+		level = strconv.Itoa(m.Level)
+	}
+	levelColor := nslogger.LevelColor(m.Level)
+	fields = append(fields, paint(nslogger.ColorDim, m.ThreadID), paint(nslogger.ColorTag, m.Tag),
+		paint(levelColor, level), paint(levelColor, m.Payload))
+	if m.Filename != "" {
+		fields = append(fields, paint(nslogger.ColorDim, m.Filename+":"+strconv.Itoa(m.LineNumber)))
+	}
+	if m.FunctionName != "" {
+		fields = append(fields, paint(nslogger.ColorDim, m.FunctionName))
+	}
+	return strings.Join(fields, sep)
+}
@@ -0,0 +1,134 @@
+// Command nslogger reads, converts and receives NSLogger logs.
+//
+// Usage:
+//
+//	nslogger convert [flags] file    convert a capture file to text, aligned columns, JSON, CSV, logfmt, HTML, NSLogger binary format, Elasticsearch bulk requests or a template
+//	nslogger filter [flags] file     output the messages of a capture file matching filters
+//	nslogger batch [flags] glob...   convert the capture files matching patterns, several at once
+//	nslogger watch [flags] dir       convert or export the capture files dropped in a directory
+//	nslogger listen [flags]          receive logs from NSLogger clients and print them
+//	nslogger view [flags] [file]     browse a capture file, or logs received live, in the terminal
+//	nslogger web [flags] [file]      watch a capture file, or logs received live, in a browser
+//	nslogger stats file              summarize the content of a capture file
+//	nslogger validate file           check a capture file for conformance to the NSLogger protocol
+//	nslogger vectors [flags]         write reference capture files for testing NSLogger implementations
+//	nslogger index file              index a capture file, for -at and -seq to seek in it
+//	nslogger split [flags] file      split a capture file by message count, size, time window or tag
+//	nslogger compare [flags] a b     report the messages found in only one of two capture files
+//	nslogger replay [flags] file     send the messages of a capture file to an NSLogger viewer
+//	nslogger images [flags] file     extract the images of a capture file as PNG files
+//
+// A file name of "-" reads the standard input.
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"convert", "convert a capture file to " + formatUsage(false) + " or a template", runConvert},
+	{"filter", "output the messages of a capture file matching filters", runFilter},
+	{"batch", "convert the capture files matching patterns, several at once", runBatch},
+	{"watch", "convert or export the capture files dropped in a directory", runWatch},
+	{"listen", "receive logs from NSLogger clients and print them", runListen},
+	{"view", "browse a capture file, or logs received live, in the terminal", runView},
+	{"web", "watch a capture file, or logs received live, in a browser", runWeb},
+	{"stats", "summarize the content of a capture file", runStats},
+	{"validate", "check a capture file for conformance to the NSLogger protocol", runValidate},
+	{"vectors", "write reference capture files for testing NSLogger implementations", runVectors},
+	{"index", "index a capture file, for -at and -seq to seek in it", runIndex},
+	{"split", "split a capture file by message count, size, time window or tag", runSplit},
+	{"compare", "report the messages found in only one of two capture files", runCompare},
+	{"replay", "send the messages of a capture file to an NSLogger viewer", runReplay},
+	{"images", "extract the images of a capture file as PNG files", runImages},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			if err := c.run(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, "nslogger:", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: nslogger <command> [flags] [file]")
+	fmt.Fprintln(os.Stderr)
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, `Run "nslogger <command> -h" for the flags of a command.`)
+}
+
+/** readInput reads the capture file given as single argument, "-" being the
+ * standard input. */
+func readInput(args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected one capture file, got %d arguments", len(args))
+	}
+	if args[0] == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(args[0])
+}
+
+/** createOutput opens the output file, the standard output if name is empty.
+ * Files named with a .gz extension are gzip-compressed. */
+func createOutput(name string) (io.WriteCloser, error) {
+	if name == "" {
+		return nopCloser{os.Stdout}, nil
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(name, ".gz") {
+		return f, nil
+	}
+	return gzipFile{gzip.NewWriter(f), f}, nil
+}
+
+/** gzipFile is a gzip-compressed output file. */
+type gzipFile struct {
+	*gzip.Writer
+	f *os.File
+}
+
+func (g gzipFile) Close() error {
+	err := g.Writer.Close()
+	if cerr := g.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
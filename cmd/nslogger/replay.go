@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+
+	"github.com/fouge/nslogger"
+)
+
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	addr := fs.String("addr", "localhost"+nslogger.DefaultListenerAddr, "address of the NSLogger viewer")
+	useTLS := fs.Bool("tls", false, "connect over TLS, as the desktop viewer requires by default")
+	timing := fs.Bool("timing", false, "wait between messages as long as elapsed between them when logged")
+	speed := fs.Float64("speed", 1, "with -timing, replay this many times faster")
+	maxDelay := fs.Duration("max-delay", 0, `with -timing, longest wait between two messages, e.g. "5s"`)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("expected one capture file")
+	}
+
+	data, err := readInput(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	var conn net.Conn
+	if *useTLS {
+		conn, err = tls.Dial("tcp", *addr, &tls.Config{InsecureSkipVerify: true})
+	} else {
+		conn, err = net.Dial("tcp", *addr)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts := nslogger.ReplayOptions{Timing: *timing, Speed: *speed, MaxDelay: *maxDelay}
+	n, err := nslogger.Replay(ctx, conn, bytes.NewReader(data), opts)
+	log.Printf("replayed %d messages to %s", n, *addr)
+	return err
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/fouge/nslogger"
+)
+
+func runSplit(args []string) error {
+	fs := flag.NewFlagSet("split", flag.ExitOnError)
+	output := fs.String("o", "", `base name of the files written, e.g. "app.rawnsloggerdata" for app-001.rawnsloggerdata..., the capture file name if empty`)
+	count := fs.Int("n", 0, "maximum number of messages per file")
+	size := fs.String("size", "", `maximum size per file, e.g. "500K", "10M" or "1G"`)
+	window := fs.Duration("window", 0, `time window per file, e.g. "1h"`)
+	byTag := fs.Bool("by-tag", false, "write the messages of each tag to files of their own")
+	fs.Parse(args)
+
+	opts := nslogger.SplitOptions{MaxMessages: *count, Window: *window, ByTag: *byTag}
+	if *size != "" {
+		n, err := parseSize(*size)
+		if err != nil {
+			return err
+		}
+		opts.MaxSize = n
+	}
+	if opts == (nslogger.SplitOptions{}) {
+		return errors.New("expected one of -n, -size, -window or -by-tag")
+	}
+
+	data, err := readInput(fs.Args())
+	if err != nil {
+		return err
+	}
+	base := *output
+	if base == "" {
+		if base = fs.Arg(0); base == "-" {
+			base = "split.rawnsloggerdata"
+		}
+	}
+
+	files, err := nslogger.Split(nslogger.NewDecoder(bytes.NewReader(data)), base, opts)
+	for _, name := range files {
+		fmt.Println(name)
+	}
+	return err
+}
+
+/** parseSize parses a size in bytes with an optional K, M or G suffix. */
+func parseSize(s string) (int64, error) {
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		mult = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		mult = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		mult = 1 << 30
+	}
+	n, err := strconv.ParseInt(strings.TrimRight(s, "KMG"), 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * mult, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fouge/nslogger"
+)
+
+// histogramRows is the maximum number of rows of the messages per second
+// histogram.
+const histogramRows = 20
+
+func runStats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	fs.Parse(args)
+
+	data, err := readInput(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	s, err := nslogger.CollectStats(nslogger.NewDecoder(bytes.NewReader(data)))
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Messages:\t%d\n", s.Messages)
+	if s.Lost > 0 {
+		fmt.Fprintf(w, "Lost:\t%d\n", s.Lost)
+	}
+	if s.Messages > 0 {
+		fmt.Fprintf(w, "From:\t%s\n", s.Start.Format(nslogger.DefaultTimeLayout))
+		fmt.Fprintf(w, "To:\t%s\n", s.End.Format(nslogger.DefaultTimeLayout))
+		fmt.Fprintf(w, "Duration:\t%v\n", s.Duration())
+	}
+	fmt.Fprintf(w, "Images:\t%d (%d bytes)\n", s.Images, s.ImageBytes)
+	fmt.Fprintf(w, "Binary data:\t%d bytes\n", s.BinaryBytes)
+
+	printCounts(w, "Tags", s.Tags)
+	levels := make(map[string]int)
+	for level, n := range s.Levels {
+		name := nslogger.DefaultLevelNames[level]
+		if name == "" {
+			name = strconv.Itoa(level)
+		}
+		levels[name] += n
+	}
+	printCounts(w, "Levels", levels)
+	printCounts(w, "Threads", s.Threads)
+	printSlowestBlocks(w, s)
+	printHistogram(w, s)
+
+	return w.Flush()
+}
+
+func printCounts(w *tabwriter.Writer, title string, counts map[string]int) {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	fmt.Fprintf(w, "\n%s:\n", title)
+	for _, k := range keys {
+		if k == "" {
+			fmt.Fprintf(w, "  (none)\t%d\n", counts[k])
+		} else {
+			fmt.Fprintf(w, "  %s\t%d\n", k, counts[k])
+		}
+	}
+}
+
+/** printSlowestBlocks prints the longest blocks, if any ended. */
+func printSlowestBlocks(w *tabwriter.Writer, s *nslogger.Stats) {
+	if s.Blocks == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nSlowest blocks (of %d):\n", s.Blocks)
+	for _, b := range s.Slowest {
+		fmt.Fprintf(w, "  %v\t%s\t%s\t%s\n", b.Duration, b.Start.Format(nslogger.DefaultTimeLayout), b.Thread, b.Label)
+	}
+}
+
+/** printHistogram prints the number of messages over time as a bar chart of
+ * at most histogramRows rows. */
+func printHistogram(w *tabwriter.Writer, s *nslogger.Stats) {
+	if s.Messages == 0 {
+		return
+	}
+
+	seconds := s.End.Unix() - s.Start.Unix() + 1
+	interval := time.Duration((seconds+histogramRows-1)/histogramRows) * time.Second
+	h := s.Histogram(interval)
+	max := 0
+	for _, n := range h {
+		if n > max {
+			max = n
+		}
+	}
+
+	fmt.Fprintf(w, "\nMessages per %v:\n", interval)
+	for i, n := range h {
+		t := s.Start.Add(time.Duration(i) * interval)
+		fmt.Fprintf(w, "  %s\t%d\t%s\n", t.Format("15:04:05"), n, strings.Repeat("#", n*40/max))
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/fouge/nslogger"
+)
+
+func runValidate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	fs.Parse(args)
+
+	data, err := readInput(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	violations, err := nslogger.Validate(data)
+	if err != nil {
+		return err
+	}
+	for _, v := range violations {
+		fmt.Println(v)
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("%d protocol violations", len(violations))
+	}
+	fmt.Println("capture conforms to the NSLogger protocol")
+	return nil
+}
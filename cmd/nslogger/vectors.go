@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/fouge/nslogger"
+)
+
+func runVectors(args []string) error {
+	fs := flag.NewFlagSet("vectors", flag.ExitOnError)
+	outdir := fs.String("outdir", "testvectors", "directory to write the test vectors to")
+	corpus := fs.String("corpus", "", "also write the seed corpus for fuzzing the decoder to `dir`")
+	fs.Parse(args)
+
+	if err := nslogger.WriteTestVectors(*outdir); err != nil {
+		return err
+	}
+	fmt.Printf("test vectors written to %s, indexed in vectors.json\n", *outdir)
+	if *corpus != "" {
+		if err := nslogger.WriteFuzzCorpus(*corpus); err != nil {
+			return err
+		}
+		fmt.Printf("fuzzing corpus written to %s\n", *corpus)
+	}
+	return nil
+}
@@ -0,0 +1,460 @@
+//go:build unix
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"unicode/utf8"
+
+	"github.com/fouge/nslogger"
+)
+
+const viewHelp = "q quit  j/k scroll  space/b page  g/G top/bottom  f follow  0-4 levels  t tag  / search  n/N next match  m/M next mark"
+
+func runView(args []string) error {
+	fs := flag.NewFlagSet("view", flag.ExitOnError)
+	listen := fs.String("listen", "", "receive logs from NSLogger clients on this TCP address instead of reading a file")
+	fs.Parse(args)
+
+	v := &viewer{changed: make(chan struct{}, 1), follow: true, out: bufio.NewWriter(os.Stdout)}
+
+	if *listen != "" {
+		if fs.NArg() != 0 {
+			return fmt.Errorf("unexpected arguments %v", fs.Args())
+		}
+		l := &nslogger.Listener{Addr: *listen, Handler: v.add}
+		errc := make(chan error, 1)
+		go func() { errc <- l.ListenAndServe() }()
+		defer l.Close()
+		v.status = "listening on " + *listen
+		return v.run(errc)
+	}
+
+	data, err := readInput(fs.Args())
+	if err != nil {
+		return err
+	}
+	msgs, err := nslogger.Decode(data, nslogger.WithInterning())
+	if err != nil {
+		return err
+	}
+	for i := range msgs {
+		v.msgs = append(v.msgs, &msgs[i])
+	}
+	v.follow = false
+	return v.run(nil)
+}
+
+/** viewer is an interactive terminal viewer of messages, received live or
+ * read from a file. */
+type viewer struct {
+	mu      sync.Mutex
+	msgs    []*nslogger.Message
+	changed chan struct{} // signaled when messages are added
+
+	rows, cols int
+	lines      []int // indices of the messages shown with the current filters
+	filtered   int   // number of messages checked against the filters
+	top        int   // first line on screen
+	follow     bool  // keep the last message on screen
+
+	hidden [nslogger.LevelVerbose + 1]bool
+	tag    string
+	search *regexp.Regexp
+	status string
+
+	prompt     string // label of the input line, if being edited
+	input      []rune
+	promptDone func(string)
+
+	out *bufio.Writer
+}
+
+/** add appends a message received by the listener. */
+func (v *viewer) add(m *nslogger.Message) {
+	v.mu.Lock()
+	v.msgs = append(v.msgs, m)
+	v.mu.Unlock()
+	select {
+	case v.changed <- struct{}{}:
+	default:
+	}
+}
+
+/** run shows the messages until the user quits, or errc receives an error. */
+func (v *viewer) run(errc <-chan error) error {
+	restore, err := rawTerminal()
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	v.out.WriteString("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		v.out.WriteString("\x1b[?25h\x1b[?1049l")
+		v.out.Flush()
+	}()
+
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	defer signal.Stop(winch)
+
+	keys := make(chan string)
+	go readKeys(keys)
+
+	v.resize()
+	v.refilter()
+	for {
+		v.draw()
+		select {
+		case key, ok := <-keys:
+			if !ok || !v.key(key) {
+				return nil
+			}
+		case <-v.changed:
+			v.filter()
+		case <-winch:
+			v.resize()
+		case err := <-errc:
+			return err
+		}
+	}
+}
+
+/** rawTerminal puts the terminal in raw mode and returns the function
+ * restoring its settings. */
+func rawTerminal() (func(), error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("view needs a terminal: %v", err)
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, err
+	}
+	return func() { stty(strings.TrimSpace(saved)) }, nil
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+/** readKeys sends the keys typed by the user to keys, named after the
+ * escape sequences of special keys. */
+func readKeys(keys chan<- string) {
+	defer close(keys)
+	special := map[string]string{
+		"\x1b[A": "up", "\x1b[B": "down", "\x1b[5~": "pgup", "\x1b[6~": "pgdn",
+		"\x1b[H": "home", "\x1b[F": "end", "\x1b[1~": "home", "\x1b[4~": "end",
+	}
+
+	buf := make([]byte, 64)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return
+		}
+		b := buf[:n]
+		for len(b) > 0 {
+			switch {
+			case b[0] == 0x1b && len(b) > 2 && b[1] == '[':
+				end := 2
+				for end < len(b) && (b[end] < 0x40 || b[end] > 0x7e) {
+					end++
+				}
+				if end < len(b) {
+					end++
+				}
+				keys <- special[string(b[:end])]
+				b = b[end:]
+			case b[0] == 0x1b:
+				keys <- "esc"
+				b = b[1:]
+			case b[0] == '\r' || b[0] == '\n':
+				keys <- "enter"
+				b = b[1:]
+			case b[0] == 0x7f || b[0] == 0x08:
+				keys <- "backspace"
+				b = b[1:]
+			case b[0] == 0x03:
+				keys <- "ctrl-c"
+				b = b[1:]
+			default:
+				r, size := utf8.DecodeRune(b)
+				keys <- string(r)
+				b = b[size:]
+			}
+		}
+	}
+}
+
+func (v *viewer) resize() {
+	v.rows, v.cols = 24, 80
+	if size, err := stty("size"); err == nil {
+		fmt.Sscan(size, &v.rows, &v.cols)
+	}
+}
+
+/** height is the number of message lines on screen. */
+func (v *viewer) height() int {
+	if v.rows < 2 {
+		return 1
+	}
+	return v.rows - 1
+}
+
+/** shown reports whether m passes the level and tag filters. Other
+ * messages than logs are always shown. */
+func (v *viewer) shown(m *nslogger.Message) bool {
+	if m.Type != nslogger.LogmsgTypeLog {
+		return true
+	}
+	if m.Level >= 0 && m.Level < len(v.hidden) && v.hidden[m.Level] {
+		return false
+	}
+	return v.tag == "" || m.Tag == v.tag
+}
+
+/** filter adds the messages received since the last call to the lines. */
+func (v *viewer) filter() {
+	v.mu.Lock()
+	msgs := v.msgs
+	v.mu.Unlock()
+
+	for ; v.filtered < len(msgs); v.filtered++ {
+		if v.shown(msgs[v.filtered]) {
+			v.lines = append(v.lines, v.filtered)
+		}
+	}
+}
+
+/** refilter applies changed filters, keeping the first message on screen
+ * in view when possible. */
+func (v *viewer) refilter() {
+	first := 0
+	if v.top < len(v.lines) {
+		first = v.lines[v.top]
+	}
+	v.lines, v.filtered, v.top = v.lines[:0], 0, 0
+	v.filter()
+	for v.top < len(v.lines)-1 && v.lines[v.top] < first {
+		v.top++
+	}
+}
+
+func (v *viewer) message(line int) *nslogger.Message {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.msgs[v.lines[line]]
+}
+
+/** matches reports whether the search pattern matches the text, tag, file
+ * or function of m. */
+func (v *viewer) matches(m *nslogger.Message) bool {
+	return v.search != nil && (v.search.MatchString(m.Payload) || v.search.MatchString(m.Tag) ||
+		v.search.MatchString(m.Filename) || v.search.MatchString(m.FunctionName))
+}
+
+/** find moves to the first line from line from, in direction dir, holding
+ * a message for which ok returns true. */
+func (v *viewer) find(from, dir int, ok func(*nslogger.Message) bool, what string) {
+	for i := from; i >= 0 && i < len(v.lines); i += dir {
+		if ok(v.message(i)) {
+			v.top, v.follow = i, false
+			return
+		}
+	}
+	v.status = "no more " + what
+}
+
+/** key handles a key typed by the user, returning false to quit. */
+func (v *viewer) key(key string) bool {
+	if v.prompt != "" {
+		v.editPrompt(key)
+		return true
+	}
+
+	v.status = ""
+	h := v.height()
+	switch key {
+	case "q", "ctrl-c":
+		return false
+	case "j", "down", "enter":
+		v.top, v.follow = v.top+1, false
+	case "k", "up":
+		v.top, v.follow = v.top-1, false
+	case " ", "pgdn":
+		v.top, v.follow = v.top+h, false
+	case "b", "pgup":
+		v.top, v.follow = v.top-h, false
+	case "g", "home":
+		v.top, v.follow = 0, false
+	case "G", "end":
+		v.follow = true
+	case "f":
+		v.follow = !v.follow
+	case "0", "1", "2", "3", "4":
+		level := int(key[0] - '0')
+		v.hidden[level] = !v.hidden[level]
+		v.refilter()
+	case "t":
+		v.startPrompt("tag: ", v.tag, func(tag string) {
+			v.tag = tag
+			v.refilter()
+		})
+	case "/":
+		v.startPrompt("search: ", "", func(pattern string) {
+			v.search = nil
+			if pattern == "" {
+				return
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				v.status = err.Error()
+				return
+			}
+			v.search = re
+			v.find(v.top, 1, v.matches, "matches")
+		})
+	case "n":
+		v.find(v.top+1, 1, v.matches, "matches")
+	case "N":
+		v.find(v.top-1, -1, v.matches, "matches")
+	case "m":
+		v.find(v.top+1, 1, (*nslogger.Message).IsMark, "marks")
+	case "M":
+		v.find(v.top-1, -1, (*nslogger.Message).IsMark, "marks")
+	case "?":
+		v.status = viewHelp
+	}
+	return true
+}
+
+func (v *viewer) startPrompt(label, value string, done func(string)) {
+	v.prompt, v.input, v.promptDone = label, []rune(value), done
+}
+
+func (v *viewer) editPrompt(key string) {
+	switch key {
+	case "enter":
+		v.prompt = ""
+		v.promptDone(string(v.input))
+	case "esc", "ctrl-c":
+		v.prompt = ""
+	case "backspace":
+		if len(v.input) > 0 {
+			v.input = v.input[:len(v.input)-1]
+		}
+	default:
+		if utf8.RuneCountInString(key) == 1 {
+			v.input = append(v.input, []rune(key)...)
+		}
+	}
+}
+
+/** draw redraws the screen. */
+func (v *viewer) draw() {
+	h := v.height()
+	if v.follow || v.top > len(v.lines)-h {
+		v.top = len(v.lines) - h
+	}
+	if v.top < 0 {
+		v.top = 0
+	}
+
+	v.out.WriteString("\x1b[H")
+	for row := 0; row < h; row++ {
+		v.out.WriteString("\x1b[2K")
+		if i := v.top + row; i < len(v.lines) {
+			v.drawLine(v.message(i))
+		}
+		v.out.WriteString("\r\n")
+	}
+
+	v.out.WriteString("\x1b[2K\x1b[7m")
+	v.out.WriteString(pad(v.statusLine(), v.cols))
+	v.out.WriteString("\x1b[0m")
+	v.out.Flush()
+}
+
+func (v *viewer) drawLine(m *nslogger.Message) {
+	text := strings.Repeat("  ", m.Depth) + textLine(m, " ", false)
+	text = strings.Map(func(r rune) rune {
+		if r < ' ' {
+			return ' '
+		}
+		return r
+	}, text)
+	text = truncate(text, v.cols)
+
+	switch {
+	case m.IsMark() || m.IsClientInfo() || m.IsDisconnect():
+		v.out.WriteString(nslogger.ColorEvent + text + nslogger.ColorReset)
+	case v.matches(m):
+		v.out.WriteString("\x1b[1;43;30m" + text + nslogger.ColorReset)
+	default:
+		v.out.WriteString(nslogger.LevelColor(m.Level) + text + nslogger.ColorReset)
+	}
+}
+
+func (v *viewer) statusLine() string {
+	if v.prompt != "" {
+		return v.prompt + string(v.input) + "_"
+	}
+
+	v.mu.Lock()
+	total := len(v.msgs)
+	v.mu.Unlock()
+
+	var levels strings.Builder
+	for level, hidden := range v.hidden {
+		if hidden {
+			levels.WriteByte('-')
+		} else {
+			levels.WriteString(strconv.Itoa(level))
+		}
+	}
+
+	s := fmt.Sprintf(" %d-%d/%d (%d total)  levels:%s", v.top+1, min(v.top+v.height(), len(v.lines)), len(v.lines), total, levels.String())
+	if v.tag != "" {
+		s += "  tag:" + v.tag
+	}
+	if v.search != nil {
+		s += "  /" + v.search.String()
+	}
+	if v.follow {
+		s += "  FOLLOW"
+	}
+	if v.status != "" {
+		s += "  | " + v.status
+	} else {
+		s += "  | ? help"
+	}
+	return s
+}
+
+/** truncate cuts s to width runes. */
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width])
+}
+
+/** pad fills s with spaces up to width runes, truncating it if longer. */
+func pad(s string, width int) string {
+	s = truncate(s, width)
+	return s + strings.Repeat(" ", width-utf8.RuneCountInString(s))
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+func runView(args []string) error {
+	return errors.New("view is only available on Unix systems")
+}
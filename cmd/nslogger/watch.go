@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/fouge/nslogger"
+)
+
+func runWatch(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	var out outputFlags
+	out.register(fs)
+	var ff filterFlags
+	ff.register(fs)
+	outDir := fs.String("outdir", "", "directory of the output files, the watched directory if empty")
+	pattern := fs.String("pattern", nslogger.DefaultWatchPattern, "pattern of the names of the capture files to handle")
+	interval := fs.Duration("interval", nslogger.DefaultWatchInterval, "interval at which the directory is listed, files being handled once unchanged for an interval")
+	existing := fs.Bool("existing", false, "also handle the capture files already in the directory")
+	done := fs.String("done", "", "move the capture files handled to this directory")
+	lokiURL := fs.String("loki", "", "push messages to this Loki push API URL instead of writing output files, e.g. http://localhost:3100/loki/api/v1/push")
+	lokiLabels := fs.String("loki-labels", "", `comma-separated static labels of the messages pushed to Loki, e.g. "job=ios,env=qa"`)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return errors.New("expected the directory to watch")
+	}
+	dir := fs.Arg(0)
+
+	opts, err := out.options()
+	if err != nil {
+		return err
+	}
+	filterOpts, err := ff.options()
+	if err != nil {
+		return err
+	}
+	opts = append(append(opts, filterOpts...), nslogger.WithSeparator(out.separator))
+
+	var handler nslogger.WatchHandler
+	switch {
+	case *lokiURL != "":
+		loki := &nslogger.LokiPusher{URL: *lokiURL, ErrorLog: log.New(os.Stderr, "", log.LstdFlags)}
+		if loki.Labels, err = parseLabels(*lokiLabels); err != nil {
+			return err
+		}
+		handle := nslogger.HandleMessages(loki.Handle, opts...)
+		handler = func(path string) error {
+			if err := handle(path); err != nil {
+				return err
+			}
+			return loki.Flush()
+		}
+	case out.es != "":
+		handler = func(path string) error {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			msgs, err := nslogger.Decode(data, opts...)
+			if err != nil {
+				return err
+			}
+			return nslogger.PostBulk(nil, out.es, out.index, msgs)
+		}
+	case out.output != "":
+		return errors.New("-o does not apply to watching, see -outdir")
+	case out.format == "raw" || out.format == "bulk":
+		return fmt.Errorf("watching does not support the %s format, except with -es", out.format)
+	default:
+		handler = nslogger.ConvertTo(*outDir, opts...)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	log.Printf("watching %s", dir)
+	err = nslogger.WatchDir(ctx, dir, func(path string) error {
+		if err := handler(path); err != nil {
+			return err
+		}
+		log.Printf("handled %s", path)
+		return nil
+	}, nslogger.WatchOptions{
+		Pattern:  *pattern,
+		Interval: *interval,
+		Existing: *existing,
+		DoneDir:  *done,
+		ErrorLog: log.New(os.Stderr, "", log.LstdFlags),
+	})
+	if err != context.Canceled {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/fouge/nslogger"
+)
+
+func runWeb(args []string) error {
+	fs := flag.NewFlagSet("web", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "HTTP address of the viewer")
+	listen := fs.String("listen", "", "receive logs from NSLogger clients on this TCP address, "+nslogger.DefaultListenerAddr+" if no file is given")
+	history := fs.Int("history", nslogger.DefaultWebHistory, "number of messages sent to browsers as they connect")
+	historyAge := fs.Duration("history-age", 0, `send browsers only the messages received during this time window, e.g. "30m", when receiving logs from clients`)
+	var ff filterFlags
+	ff.register(fs)
+	fs.Parse(args)
+
+	if fs.NArg() > 1 {
+		return fmt.Errorf("expected at most one capture file, got %d arguments", fs.NArg())
+	}
+	filterOpts, err := ff.options()
+	if err != nil {
+		return err
+	}
+
+	v := &nslogger.WebViewer{History: *history}
+	if *historyAge > 0 {
+		if fs.NArg() == 1 {
+			return errors.New("-history-age only applies to logs received from clients")
+		}
+		v.Store = nslogger.NewStore(nslogger.StoreOptions{MaxMessages: *history, MaxAge: *historyAge})
+	}
+	if fs.NArg() == 1 {
+		data, err := readInput(fs.Args())
+		if err != nil {
+			return err
+		}
+		msgs, err := nslogger.Decode(data, append(filterOpts, nslogger.WithInterning())...)
+		if err != nil {
+			return err
+		}
+		if len(msgs) > v.History {
+			v.History = len(msgs)
+		}
+		for i := range msgs {
+			v.Handle(&msgs[i])
+		}
+		v.Title = fs.Arg(0)
+	} else if *listen == "" {
+		*listen = nslogger.DefaultListenerAddr
+	}
+
+	if *listen != "" {
+		l := &nslogger.Listener{
+			Addr:     *listen,
+			Options:  filterOpts,
+			ErrorLog: log.New(os.Stderr, "", log.LstdFlags),
+			Handler:  v.Handle,
+		}
+		go func() {
+			log.Fatal(l.ListenAndServe())
+		}()
+		log.Printf("listening for clients on %s", *listen)
+	}
+
+	log.Printf("serving the viewer on http://%s", *addr)
+	return http.ListenAndServe(*addr, v)
+}
@@ -0,0 +1,3 @@
+module github.com/fouge/nslogger
+
+go 1.23
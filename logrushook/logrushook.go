@@ -0,0 +1,47 @@
+// Package logrushook sends the entries of logrus loggers to an NSLogger
+// viewer. It is a module of its own so that the nslogger package does not
+// depend on logrus.
+package logrushook
+
+import (
+	"github.com/fouge/nslogger"
+	"github.com/sirupsen/logrus"
+)
+
+// Hook is a logrus.Hook sending entries to an NSLogger viewer through a
+// nslogger.FieldLogger, which maps their fields to the tag and the text of
+// the messages, and optionally to user-defined parts.
+type Hook struct {
+	fl     *nslogger.FieldLogger
+	levels []logrus.Level
+}
+
+// New returns a Hook sending the entries of the given levels through fl, of
+// all levels if none is given.
+func New(fl *nslogger.FieldLogger, levels ...logrus.Level) *Hook {
+	if len(levels) == 0 {
+		levels = logrus.AllLevels
+	}
+	return &Hook{fl: fl, levels: levels}
+}
+
+// Levels returns the levels of the entries sent.
+func (h *Hook) Levels() []logrus.Level {
+	return h.levels
+}
+
+// Fire sends e to the viewer, its fields sorted by key.
+func (h *Hook) Fire(e *logrus.Entry) error {
+	entry := nslogger.LogEntry{
+		Time:    e.Time,
+		Level:   nslogger.LogrusLevel(uint32(e.Level)),
+		Message: e.Message,
+		Fields:  nslogger.SortedFields(e.Data),
+	}
+	if e.HasCaller() {
+		entry.File = e.Caller.File
+		entry.Line = e.Caller.Line
+		entry.Function = e.Caller.Function
+	}
+	return h.fl.Log(entry)
+}
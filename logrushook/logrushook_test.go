@@ -0,0 +1,36 @@
+package logrushook_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/fouge/nslogger"
+	"github.com/fouge/nslogger/logrushook"
+	"github.com/sirupsen/logrus"
+)
+
+func TestHook(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := nslogger.NewLogger(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	logger.AddHook(logrushook.New(nslogger.NewFieldLogger(l, nil), logrus.ErrorLevel, logrus.WarnLevel))
+	logger.Info("not sent")
+	logger.WithFields(logrus.Fields{"tag": "network", "status": 200, "method": "GET"}).Warn("request sent")
+
+	msgs, err := nslogger.Decode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("got %d messages, want the client info and 1 log", len(msgs))
+	}
+	m := msgs[1]
+	if m.Tag != "network" || m.Level != nslogger.LevelWarning || m.Payload != "request sent method=GET status=200" {
+		t.Errorf("got tag %q, level %d, text %q", m.Tag, m.Level, m.Payload)
+	}
+}
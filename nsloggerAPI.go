@@ -0,0 +1,185 @@
+package nslogger
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ListenerAPI serves a small REST API controlling a Listener, so that
+// orchestration tools, e.g. of a device farm, drive the capture server:
+//
+//	GET    /clients            connected clients and their message rates
+//	GET    /stats              message counts and rate of the listener
+//	GET    /recording          whether the listener records, and to which files
+//	POST   /recording          start recording to RecordFile
+//	DELETE /recording          stop recording
+//	GET    /recording/capture  download the capture file being recorded
+//	GET    /metrics            metrics of the listener for Prometheus
+//	GET    /messages           last messages retained by Store, see below
+//
+// GET /messages selects messages with the query parameters tag and thread,
+// comma-separated lists, level, the most verbose level, since and until,
+// RFC 3339 times, pattern, a regular expression matching the text, and limit,
+// the number of last messages returned. Responses are JSON, errors being
+// objects with an "error" field. The API has no authentication: serve it on
+// a trusted network only.
+type ListenerAPI struct {
+	Listener *Listener
+
+	RecordFile    string        // file recordings started with POST /recording write to, named after it with rotation
+	RecordOptions RecordOptions // rotation of recordings started with POST /recording
+
+	Store *Store // messages served by GET /messages, which is not found if nil
+}
+
+/** apiClient is a connected client as listed by GET /clients. */
+type apiClient struct {
+	ID         uint64      `json:"id"`
+	RemoteAddr string      `json:"remoteAddr"`
+	Start      time.Time   `json:"start"`
+	Client     *ClientInfo `json:"client,omitempty"`
+	Messages   int64       `json:"messages"`
+	Rate       float64     `json:"rate"`
+}
+
+/** apiRecording is the recording state returned by /recording. */
+type apiRecording struct {
+	Recording bool     `json:"recording"`
+	Files     []string `json:"files,omitempty"`
+}
+
+// ServeHTTP serves the API.
+func (a *ListenerAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	switch {
+	case path == "clients" && r.Method == http.MethodGet:
+		clients := []apiClient{}
+		for _, s := range a.Listener.Sessions() {
+			clients = append(clients, apiClient{ID: s.ID, RemoteAddr: s.RemoteAddr.String(), Start: s.Start,
+				Client: s.ClientInfo(), Messages: s.MessageCount(), Rate: s.Rate()})
+		}
+		writeAPIResponse(w, http.StatusOK, clients)
+	case path == "stats" && r.Method == http.MethodGet:
+		writeAPIResponse(w, http.StatusOK, a.Listener.Stats())
+	case path == "recording" && r.Method == http.MethodGet:
+		writeAPIResponse(w, http.StatusOK, a.recording())
+	case path == "recording" && r.Method == http.MethodPost:
+		if a.RecordFile == "" {
+			writeAPIError(w, http.StatusConflict, errors.New("no record file configured"))
+			return
+		}
+		if _, err := a.Listener.StartRecording(a.RecordFile, a.RecordOptions); err != nil {
+			writeAPIError(w, http.StatusConflict, err)
+			return
+		}
+		writeAPIResponse(w, http.StatusOK, a.recording())
+	case path == "recording" && r.Method == http.MethodDelete:
+		if err := a.Listener.StopRecording(); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeAPIResponse(w, http.StatusOK, a.recording())
+	case path == "recording/capture" && r.Method == http.MethodGet:
+		a.serveCapture(w)
+	case path == "metrics" && r.Method == http.MethodGet:
+		a.Listener.MetricsHandler().ServeHTTP(w, r)
+	case path == "messages" && r.Method == http.MethodGet && a.Store != nil:
+		a.serveMessages(w, r)
+	case path == "clients" || path == "stats" || path == "recording" || path == "recording/capture" || path == "metrics" ||
+		path == "messages" && a.Store != nil:
+		writeAPIError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	default:
+		writeAPIError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+/** recording returns the recording state of the listener. */
+func (a *ListenerAPI) recording() apiRecording {
+	rec := a.Listener.recorder()
+	if rec == nil {
+		return apiRecording{}
+	}
+	return apiRecording{Recording: true, Files: rec.Files()}
+}
+
+/** serveCapture sends the file being recorded, as written so far. */
+func (a *ListenerAPI) serveCapture(w http.ResponseWriter) {
+	rec := a.Listener.recorder()
+	if rec == nil {
+		writeAPIError(w, http.StatusNotFound, errors.New("not recording"))
+		return
+	}
+	files := rec.Files()
+	name := files[len(files)-1]
+	f, err := os.Open(name)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+strings.ReplaceAll(filepath.Base(name), `"`, "_")+`"`)
+	io.Copy(w, f)
+}
+
+/** serveMessages sends the messages of the store selected by the query
+ * parameters of r. */
+func (a *ListenerAPI) serveMessages(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var f Filter
+	if tags := q.Get("tag"); tags != "" {
+		f.Tags = strings.Split(tags, ",")
+	}
+	if threads := q.Get("thread"); threads != "" {
+		f.Threads = strings.Split(threads, ",")
+	}
+	limit := 0
+	var err error
+	if s := q.Get("level"); s != "" {
+		var level int
+		if level, err = ParseLevel(s); err == nil {
+			f.MinLevel = &level
+		}
+	}
+	if s := q.Get("since"); s != "" && err == nil {
+		f.Start, err = time.Parse(time.RFC3339Nano, s)
+	}
+	if s := q.Get("until"); s != "" && err == nil {
+		f.End, err = time.Parse(time.RFC3339Nano, s)
+	}
+	if s := q.Get("pattern"); s != "" && err == nil {
+		f.Pattern, err = regexp.Compile(s)
+	}
+	if s := q.Get("limit"); s != "" && err == nil {
+		limit, err = strconv.Atoi(s)
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	msgs := a.Store.Query(&f, limit)
+	if msgs == nil {
+		msgs = []*Message{}
+	}
+	writeAPIResponse(w, http.StatusOK, msgs)
+}
+
+func writeAPIResponse(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeAPIResponse(w, status, map[string]string{"error": err.Error()})
+}
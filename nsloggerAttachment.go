@@ -0,0 +1,98 @@
+package nslogger
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ManifestFilename is the name of the manifest ExtractAttachments writes
+// along with the files it extracts.
+const ManifestFilename = "manifest.json"
+
+// Attachment links a file extracted from a message payload to the message,
+// so that extracted assets remain traceable back to the log line that
+// produced them.
+type Attachment struct {
+	File      string    `json:"file"` // name of the file, relative to the directory of the manifest
+	Type      string    `json:"type"` // MIME type, e.g. "image/png" or "application/octet-stream"
+	Size      int       `json:"size"` // in bytes
+	Seq       int       `json:"seq"`
+	Timestamp time.Time `json:"timestamp"`
+	Tag       string    `json:"tag,omitempty"`
+	Thread    string    `json:"thread,omitempty"`
+	Width     int       `json:"width,omitempty"` // declared size of images
+	Height    int       `json:"height,omitempty"`
+}
+
+// BinaryFilename returns the name under which the binary payload of m is
+// extracted, derived from its sequence number and timestamp.
+func BinaryFilename(m *Message) string {
+	return fmt.Sprintf("%06d-%s.bin", m.Seq, m.Timestamp.UTC().Format("20060102T150405.000000"))
+}
+
+// ExtractAttachments writes the image and binary payloads of msgs to files
+// in dir, named by ImageFilename and BinaryFilename, and a JSON manifest
+// describing them named ManifestFilename. The attachments of a manifest
+// already in dir are kept in it, unless their file is written again. It
+// returns the attachments extracted.
+func ExtractAttachments(dir string, msgs []Message) ([]Attachment, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	attachments := []Attachment{}
+	for i := range msgs {
+		m := &msgs[i]
+		a := Attachment{Seq: m.Seq, Timestamp: m.Timestamp, Tag: m.Tag, Thread: m.ThreadID}
+		var data []byte
+		switch {
+		case m.Image != nil:
+			data, a.File, a.Type = m.Image, ImageFilename(m), ImageType(m)
+			a.Width, a.Height = m.ImageWidth, m.ImageHeight
+		case m.Binary != nil:
+			data, a.File, a.Type = m.Binary, BinaryFilename(m), "application/octet-stream"
+		default:
+			continue
+		}
+		a.Size = len(data)
+		if err := os.WriteFile(filepath.Join(dir, a.File), data, 0644); err != nil {
+			return attachments, err
+		}
+		attachments = append(attachments, a)
+	}
+
+	return attachments, writeManifest(filepath.Join(dir, ManifestFilename), attachments)
+}
+
+/** writeManifest writes the manifest name listing attachments, after the
+ * attachments of other files it already lists. */
+func writeManifest(name string, attachments []Attachment) error {
+	all := []Attachment{}
+	if b, err := os.ReadFile(name); err == nil {
+		var previous []Attachment
+		if err := json.Unmarshal(b, &previous); err != nil {
+			return fmt.Errorf("nslogger: invalid manifest %s: %w", name, err)
+		}
+		written := make(map[string]bool)
+		for _, a := range attachments {
+			written[a.File] = true
+		}
+		for _, a := range previous {
+			if !written[a.File] {
+				all = append(all, a)
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	all = append(all, attachments...)
+
+	b, err := json.MarshalIndent(all, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, append(b, '\n'), 0644)
+}
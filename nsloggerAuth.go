@@ -0,0 +1,169 @@
+package nslogger
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// DefaultAuthTokenKey is the key of the part holding the token of clients,
+// when ListenerAuth.TokenKey is 0: the last user-defined key, unlikely to be
+// used by applications for parts of their own.
+const DefaultAuthTokenKey = 255
+
+// DefaultAuthTimeout is the time clients have to complete their TLS handshake
+// and send their client info message to a Listener authenticating them, when
+// ListenerAuth.Timeout is 0.
+const DefaultAuthTimeout = 10 * time.Second
+
+// ErrUnauthorized is the error of the connections rejected by a Listener
+// with Auth or client certificates.
+var ErrUnauthorized = errors.New("nslogger: unauthorized client")
+
+// ListenerAuth sets the shared tokens a Listener accepts connections with, so
+// that a capture server exposed on a lab network only accepts the logs of
+// authorized devices. Clients send their token in a string part of their
+// client info message, the first message of the connection, as the Loggers
+// returned by NewAuthenticatedLogger do. The token part is removed from the
+// message before it is recorded or delivered.
+type ListenerAuth struct {
+	Tokens   []string      // tokens accepted
+	TokenKey uint8         // key of the token part, DefaultAuthTokenKey if 0
+	Timeout  time.Duration // time clients have to authenticate, DefaultAuthTimeout if 0
+}
+
+// MutualTLSConfig returns a TLS configuration for Listener.TLSConfig
+// presenting cert to clients and only accepting the clients with a
+// certificate signed by one of clientCAs.
+func MutualTLSConfig(cert tls.Certificate, clientCAs *x509.CertPool) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+}
+
+// NewAuthenticatedLogger is like NewLogger, sending token in the client info
+// message for listeners with a ListenerAuth to accept the connection.
+func NewAuthenticatedLogger(w io.Writer, token string) (*Logger, error) {
+	return newLogger(w, token)
+}
+
+/** authenticate checks the client certificate of s, if required by the TLS
+ * configuration of the listener, and its token, if l.Auth is set. It returns
+ * the stream of s to decode, its first message without its token part.
+ * Clients not authenticated within the timeout of l.Auth are rejected. */
+func (l *Listener) authenticate(s *Session, o *ParseOptions) (io.Reader, error) {
+	tc, ok := s.conn.(*tls.Conn)
+	verify := ok && l.TLSConfig != nil && l.TLSConfig.ClientAuth != tls.NoClientCert
+	if !verify && l.Auth == nil {
+		return s.conn, nil
+	}
+	timeout := DefaultAuthTimeout
+	if l.Auth != nil && l.Auth.Timeout > 0 {
+		timeout = l.Auth.Timeout
+	}
+	s.conn.SetReadDeadline(time.Now().Add(timeout))
+
+	if verify {
+		if err := tc.Handshake(); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrUnauthorized, err)
+		}
+	}
+	if l.Auth == nil {
+		s.conn.SetReadDeadline(time.Time{})
+		return s.conn, nil
+	}
+
+	var header [4]byte
+	if _, err := io.ReadFull(s.conn, header[:]); err != nil {
+		return nil, fmt.Errorf("%w: no client info: %w", ErrUnauthorized, err)
+	}
+	order := o.Quirks.order()
+	size := order.Uint32(header[:])
+	if err := o.checkMessageSize(size); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	}
+	// Read as it arrives, not to allocate the size claimed by strangers
+	var buf bytes.Buffer
+	n, err := buf.ReadFrom(io.LimitReader(s.conn, int64(size)))
+	if err == nil && n < int64(size) {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: no client info: %w", ErrUnauthorized, err)
+	}
+	body := buf.Bytes()
+
+	key := l.Auth.TokenKey
+	if key == 0 {
+		key = DefaultAuthTokenKey
+	}
+	body, token, err := takeToken(body, key, o.Quirks)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	}
+	if !l.Auth.accepts(token) {
+		return nil, fmt.Errorf("%w: invalid token", ErrUnauthorized)
+	}
+
+	s.conn.SetReadDeadline(time.Time{})
+	order.PutUint32(header[:], uint32(len(body)))
+	return io.MultiReader(bytes.NewReader(header[:]), bytes.NewReader(body), s.conn), nil
+}
+
+/** accepts reports whether token is one of the tokens of a, in constant
+ * time. */
+func (a *ListenerAuth) accepts(token []byte) bool {
+	ok := 0
+	for _, t := range a.Tokens {
+		if t != "" {
+			ok |= subtle.ConstantTimeCompare(token, []byte(t))
+		}
+	}
+	return ok == 1
+}
+
+/** takeToken returns the body of a client info message without its token
+ * part of the given key, along with the token. */
+func takeToken(body []byte, key uint8, q Quirks) ([]byte, []byte, error) {
+	if len(body) < 2 {
+		return nil, nil, ErrTruncatedMessage
+	}
+	order := q.order()
+	count := order.Uint16(body)
+	stripped := make([]byte, 2, len(body))
+	var token []byte
+	clientInfo, found := false, false
+	off := uint32(2)
+	for i := uint16(0); i < count; i++ {
+		p, size, err := readPart(body, off, q)
+		if err != nil {
+			return nil, nil, err
+		}
+		end := off + 2 + size
+		switch {
+		case p.key == key && p.typ == PartTypeString && !found:
+			token, found = p.data, true
+		case p.key == PartKeyMessageType:
+			clientInfo = p.value == LogmsgTypeClientinfo
+			fallthrough
+		default:
+			stripped = append(stripped, body[off:end]...)
+		}
+		off = end
+	}
+	if !clientInfo {
+		return nil, nil, errors.New("first message not a client info")
+	}
+	if !found {
+		return nil, nil, errors.New("no token")
+	}
+	order.PutUint16(stripped, count-1)
+	return stripped, token, nil
+}
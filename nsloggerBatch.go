@@ -0,0 +1,146 @@
+package nslogger
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// ErrNoMatch is returned by ConvertFiles when no file matches its patterns.
+var ErrNoMatch = errors.New("nslogger: no capture file matches")
+
+// BatchOptions sets how ConvertFiles converts captures.
+type BatchOptions struct {
+	// OutputDir is the directory output files are written to, that of each
+	// capture if empty. Output files are named after their capture, with the
+	// extension of the output format, e.g. "run.rawnsloggerdata.gz" is
+	// converted to "run.json" in JSON.
+	OutputDir string
+
+	Workers int      // number of captures converted concurrently, runtime.GOMAXPROCS(0) if 0
+	Options []Option // output format and other options of the conversion, as for ParseToWriter
+}
+
+// BatchResult is the outcome of the conversion of a capture by ConvertFiles.
+type BatchResult struct {
+	Input  string // capture file
+	Output string // output file, removed on error
+	Err    error
+}
+
+// ConvertFiles converts the captures matching the glob patterns, e.g.
+// "captures/*.rawnsloggerdata", to the output format set in opts.Options,
+// several at once, as for teams archiving nightly device farm runs. A capture
+// failing to convert does not stop the others: the results report the error
+// of each capture, in order of their names. An error is returned only if a
+// pattern is malformed or no file matches.
+func ConvertFiles(patterns []string, opts BatchOptions) ([]BatchResult, error) {
+	var inputs []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("nslogger: %q: %w", pattern, err)
+		}
+		for _, name := range matches {
+			if !seen[name] {
+				seen[name] = true
+				inputs = append(inputs, name)
+			}
+		}
+	}
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("%w %s", ErrNoMatch, strings.Join(patterns, " "))
+	}
+
+	ext := formatExt(newParseOptions(opts.Options).Format)
+	results := make([]BatchResult, len(inputs))
+	outputs := make(map[string]string) // inputs by output file, to detect clashes
+	for i, input := range inputs {
+		dir := opts.OutputDir
+		if dir == "" {
+			dir = filepath.Dir(input)
+		}
+		output := filepath.Join(dir, captureBase(input)+ext)
+		results[i] = BatchResult{Input: input, Output: output}
+		if other, ok := outputs[output]; ok {
+			results[i].Err = fmt.Errorf("nslogger: %s is the output file of %s too", output, other)
+			continue
+		}
+		outputs[output] = input
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	todo := make(chan *BatchResult)
+	var wg sync.WaitGroup
+	for i := 0; i < min(workers, len(inputs)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range todo {
+				r.Err = convertFile(r.Input, r.Output, opts.Options)
+			}
+		}()
+	}
+	for i := range results {
+		if results[i].Err == nil {
+			todo <- &results[i]
+		}
+	}
+	close(todo)
+	wg.Wait()
+	return results, nil
+}
+
+/** convertFile converts the capture input to the file output, removed on
+ * error. */
+func convertFile(input, output string, opts []Option) error {
+	b, err := os.ReadFile(input)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	err = ParseToWriter(b, f, opts...)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(output)
+	}
+	return err
+}
+
+/** captureBase returns the file name of the capture name without its
+ * directory and extensions. */
+func captureBase(name string) string {
+	base := strings.TrimSuffix(filepath.Base(name), ".gz")
+	if ext := filepath.Ext(base); ext != "" && ext != base {
+		base = strings.TrimSuffix(base, ext)
+	}
+	return base
+}
+
+/** formatExt returns the file extension of output in format f. */
+func formatExt(f Format) string {
+	switch f {
+	case FormatJSON:
+		return ".json"
+	case FormatCSV:
+		return ".csv"
+	case FormatLogfmt:
+		return ".log"
+	case FormatHTML:
+		return ".html"
+	}
+	return ".txt"
+}
@@ -0,0 +1,102 @@
+package nslogger
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// BlockNode is a message in the block hierarchy of a capture. Block start
+// nodes hold the messages logged inside the block as children, and the
+// message that ended it if any.
+type BlockNode struct {
+	*Message
+	Children []*BlockNode
+	End      *Message // block end message, for block starts
+}
+
+// BlockTree arranges msgs into the hierarchy of blocks created by the client
+// and returns its top level. Block end messages are not part of the tree but
+// referenced by the block they end.
+func BlockTree(msgs []Message) []*BlockNode {
+	var root []*BlockNode
+	var open []*BlockNode // currently open blocks, innermost last
+
+	for i := range msgs {
+		m := &msgs[i]
+		if m.Type == LogmsgTypeBlockend {
+			if len(open) > 0 {
+				open[len(open)-1].End = m
+				open = open[:len(open)-1]
+			}
+			continue
+		}
+
+		node := &BlockNode{Message: m}
+		if len(open) > 0 {
+			parent := open[len(open)-1]
+			parent.Children = append(parent.Children, node)
+		} else {
+			root = append(root, node)
+		}
+		if m.Type == LogmsgTypeBlockstart {
+			open = append(open, node)
+		}
+	}
+
+	return root
+}
+
+// Duration returns the wall-clock duration of the block n starts, from its
+// start to its end message, and false if n is not an ended block.
+func (n *BlockNode) Duration() (time.Duration, bool) {
+	if n.Type != LogmsgTypeBlockstart || n.End == nil {
+		return 0, false
+	}
+	return n.End.Timestamp.Sub(n.Timestamp), true
+}
+
+// BlockDuration is the wall-clock duration of a block, as iOS developers
+// bracket operations with blocks to time them.
+type BlockDuration struct {
+	Label    string    // text of the block start message
+	Thread   string    // thread of the block start message
+	Start    time.Time // timestamp of the block start message
+	Seq      int       // sequence number of the block start message
+	Depth    int       // number of enclosing blocks
+	Duration time.Duration
+}
+
+// BlockDurations returns the durations of the blocks of msgs that ended, in
+// order of their start. Decoding sets the Duration field of block end
+// messages too, and text output shows it.
+func BlockDurations(msgs []Message) []BlockDuration {
+	var blocks []BlockDuration
+	var walk func(nodes []*BlockNode)
+	walk = func(nodes []*BlockNode) {
+		for _, n := range nodes {
+			if d, ok := n.Duration(); ok {
+				blocks = append(blocks, BlockDuration{Label: n.Payload, Thread: n.ThreadID, Start: n.Timestamp,
+					Seq: n.Seq, Depth: n.Depth, Duration: d})
+			}
+			walk(n.Children)
+		}
+	}
+	walk(BlockTree(msgs))
+	return blocks
+}
+
+// SlowestBlocks returns the n longest of blocks, longest first.
+func SlowestBlocks(blocks []BlockDuration, n int) []BlockDuration {
+	slowest := append([]BlockDuration(nil), blocks...)
+	sort.SliceStable(slowest, func(i, j int) bool { return slowest[i].Duration > slowest[j].Duration })
+	if len(slowest) > n {
+		slowest = slowest[:n]
+	}
+	return slowest
+}
+
+/** blockEnd describes a block end message without text in output. */
+func blockEnd(m *Message) string {
+	return fmt.Sprintf("Block ended after %v", m.Duration)
+}
@@ -0,0 +1,252 @@
+package nslogger
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Bonjour service types browsed by NSLogger clients.
+const (
+	ServiceType    = "_nslogger._tcp"
+	ServiceTypeSSL = "_nslogger-ssl._tcp"
+)
+
+const (
+	mdnsAddr          = "224.0.0.251:5353"
+	mdnsServicesQuery = "_services._dns-sd._udp.local."
+	mdnsTypeA         = 1
+	mdnsTypePTR       = 12
+	mdnsTypeTXT       = 16
+	mdnsTypeSRV       = 33
+	mdnsClassIN       = 1
+	mdnsCacheFlush    = 0x8000
+)
+
+// Advertiser announces an NSLogger service on the local network using
+// Bonjour (multicast DNS), so that clients discover it without having to be
+// configured with a host and port. It answers queries until closed.
+type Advertiser struct {
+	instance string // fully qualified instance name
+	service  string // fully qualified service type
+	host     string // fully qualified host name
+	port     uint16
+	ips      []net.IP
+
+	conn   *net.UDPConn
+	group  *net.UDPAddr
+	once   sync.Once
+	closed chan struct{}
+	done   chan struct{}
+}
+
+// Advertise starts announcing a service instance called name listening on
+// port, using the SSL service type if ssl is true. An empty name defaults to
+// the host name.
+func Advertise(name string, port int, ssl bool) (*Advertiser, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	hostname = strings.TrimSuffix(strings.Split(hostname, ".")[0], ".local")
+	if name == "" {
+		name = hostname
+	}
+
+	service := ServiceType
+	if ssl {
+		service = ServiceTypeSSL
+	}
+
+	group, err := net.ResolveUDPAddr("udp4", mdnsAddr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Advertiser{
+		instance: strings.ReplaceAll(name, ".", "-") + "." + service + ".local.",
+		service:  service + ".local.",
+		host:     hostname + ".local.",
+		port:     uint16(port),
+		ips:      localIPv4s(),
+		conn:     conn,
+		group:    group,
+		closed:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go a.serve()
+
+	return a, nil
+}
+
+// Close withdraws the advertisement and stops answering queries.
+func (a *Advertiser) Close() error {
+	var err error
+	a.once.Do(func() {
+		close(a.closed)
+		a.send(0) // goodbye packet, tells clients to flush the records
+		err = a.conn.Close()
+		<-a.done
+	})
+	return err
+}
+
+func (a *Advertiser) serve() {
+	defer close(a.done)
+
+	// Announce on startup as recommended by RFC 6762, section 8.3
+	go func() {
+		for i := 0; i < 3; i++ {
+			a.send(120)
+			select {
+			case <-a.closed:
+				return
+			case <-time.After(time.Second << uint(i)):
+			}
+		}
+	}()
+
+	buf := make([]byte, 9000)
+	for {
+		n, _, err := a.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-a.closed:
+				return
+			default:
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return
+		}
+		if a.matches(buf[:n]) {
+			a.send(120)
+		}
+	}
+}
+
+/** matches reports whether the DNS query in msg asks for one of our records. */
+func (a *Advertiser) matches(msg []byte) bool {
+	if len(msg) < 12 || msg[2]&0x80 != 0 { // not a query
+		return false
+	}
+
+	qdCount := int(binary.BigEndian.Uint16(msg[4:6]))
+	off := 12
+	for i := 0; i < qdCount; i++ {
+		name, next, err := readDNSName(msg, off)
+		if err != nil || next+4 > len(msg) {
+			return false
+		}
+		off = next + 4 // qtype and qclass
+
+		for _, n := range []string{a.service, a.instance, a.host, mdnsServicesQuery} {
+			if strings.EqualFold(name, n) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+/** send multicasts all our records with the given TTL in seconds. */
+func (a *Advertiser) send(ttl uint32) {
+	var msg []byte
+	msg = append(msg, 0, 0, 0x84, 0, 0, 0, 0, 0, 0, 0, 0, 0) // authoritative response
+	answers := 0
+
+	addRecord := func(name string, typ, class uint16, ttl uint32, rdata []byte) {
+		msg = appendDNSName(msg, name)
+		msg = binary.BigEndian.AppendUint16(msg, typ)
+		msg = binary.BigEndian.AppendUint16(msg, class)
+		msg = binary.BigEndian.AppendUint32(msg, ttl)
+		msg = binary.BigEndian.AppendUint16(msg, uint16(len(rdata)))
+		msg = append(msg, rdata...)
+		answers++
+	}
+
+	addRecord(mdnsServicesQuery, mdnsTypePTR, mdnsClassIN, ttl*36, appendDNSName(nil, a.service))
+	addRecord(a.service, mdnsTypePTR, mdnsClassIN, ttl*36, appendDNSName(nil, a.instance))
+
+	srv := []byte{0, 0, 0, 0} // priority and weight
+	srv = binary.BigEndian.AppendUint16(srv, a.port)
+	srv = appendDNSName(srv, a.host)
+	addRecord(a.instance, mdnsTypeSRV, mdnsClassIN|mdnsCacheFlush, ttl, srv)
+	addRecord(a.instance, mdnsTypeTXT, mdnsClassIN|mdnsCacheFlush, ttl*36, []byte{0})
+
+	for _, ip := range a.ips {
+		addRecord(a.host, mdnsTypeA, mdnsClassIN|mdnsCacheFlush, ttl, ip.To4())
+	}
+
+	binary.BigEndian.PutUint16(msg[6:8], uint16(answers))
+	a.conn.WriteToUDP(msg, a.group)
+}
+
+func appendDNSName(b []byte, name string) []byte {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+/** readDNSName reads the possibly compressed name at off and returns it along
+ * with the offset following it. */
+func readDNSName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	next := -1
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, errors.New("truncated DNS name")
+		}
+		l := int(msg[off])
+		switch {
+		case l == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			return strings.Join(labels, ".") + ".", next, nil
+		case l&0xC0 == 0xC0:
+			if off+1 >= len(msg) || jumps > 16 {
+				return "", 0, errors.New("invalid DNS name pointer")
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:off+2]) & 0x3FFF)
+			jumps++
+		default:
+			if off+1+l > len(msg) {
+				return "", 0, errors.New("truncated DNS name")
+			}
+			labels = append(labels, string(msg[off+1:off+1+l]))
+			off += 1 + l
+		}
+	}
+}
+
+func localIPv4s() []net.IP {
+	var ips []net.IP
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() && ipnet.IP.To4() != nil {
+			ips = append(ips, ipnet.IP)
+		}
+	}
+	return ips
+}
@@ -0,0 +1,149 @@
+package nslogger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultBulkIndex is the index name pattern used when none is given to
+// NewBulkWriter and PostBulk: one index per day of messages.
+const DefaultBulkIndex = "nslogger-{date}"
+
+// BulkBatchSize is the number of messages sent per request by PostBulk.
+const BulkBatchSize = 1000
+
+// BulkIndex returns the index name of a message logged at t: pattern with
+// "{date}" replaced by the UTC date of t, e.g. nslogger-2023.11.14.
+func BulkIndex(pattern string, t time.Time) string {
+	if pattern == "" {
+		pattern = DefaultBulkIndex
+	}
+	return strings.ReplaceAll(pattern, "{date}", t.UTC().Format("2006.01.02"))
+}
+
+// BulkWriter writes messages as the NDJSON body of an Elasticsearch or
+// OpenSearch bulk API request, to be sent to the _bulk endpoint or loaded
+// with tools such as elasticdump. Each message is indexed as its JSON
+// representation with an @timestamp field, without its image data.
+type BulkWriter struct {
+	index string
+	enc   *json.Encoder
+}
+
+/** bulkAction is the action line preceding each document. */
+type bulkAction struct {
+	Index struct {
+		Index string `json:"_index"`
+	} `json:"index"`
+}
+
+/** bulkDocument is the document indexed for a message. */
+type bulkDocument struct {
+	Timestamp time.Time `json:"@timestamp"`
+	*Message
+}
+
+// NewBulkWriter returns a BulkWriter writing to w, indexing messages in the
+// index named by the BulkIndex pattern index, DefaultBulkIndex if empty.
+func NewBulkWriter(w io.Writer, index string) *BulkWriter {
+	return &BulkWriter{index: index, enc: json.NewEncoder(w)}
+}
+
+// Write writes the action and document lines indexing m.
+func (b *BulkWriter) Write(m *Message) error {
+	var action bulkAction
+	action.Index.Index = BulkIndex(b.index, m.Timestamp)
+	if err := b.enc.Encode(&action); err != nil {
+		return err
+	}
+
+	doc := *m
+	doc.Image = nil
+	return b.enc.Encode(&bulkDocument{Timestamp: m.Timestamp, Message: &doc})
+}
+
+// PostBulk indexes msgs in the Elasticsearch or OpenSearch cluster at url,
+// e.g. http://localhost:9200, with requests of BulkBatchSize messages to its
+// bulk API. index is the BulkIndex pattern of the index names, and client
+// http.DefaultClient if nil. It fails if the cluster rejects any message.
+func PostBulk(client *http.Client, url, index string, msgs []Message) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	endpoint := strings.TrimSuffix(url, "/") + "/_bulk"
+
+	for start := 0; start < len(msgs); start += BulkBatchSize {
+		end := start + BulkBatchSize
+		if end > len(msgs) {
+			end = len(msgs)
+		}
+
+		var body bytes.Buffer
+		bw := NewBulkWriter(&body, index)
+		for i := start; i < end; i++ {
+			if err := bw.Write(&msgs[i]); err != nil {
+				return err
+			}
+		}
+		if err := postBulk(client, endpoint, &body); err != nil {
+			return fmt.Errorf("indexing messages %d to %d: %w", start, end-1, err)
+		}
+	}
+
+	return nil
+}
+
+/** bulkResponse holds the fields of bulk API responses reporting errors. */
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+/** postBulk sends a bulk API request and checks its response. */
+func postBulk(client *http.Client, endpoint string, body io.Reader) error {
+	req, err := http.NewRequest(http.MethodPost, endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var r bulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return fmt.Errorf("reading bulk response: %w", err)
+	}
+	if !r.Errors {
+		return nil
+	}
+	failed := 0
+	var first string
+	for _, item := range r.Items {
+		for _, result := range item {
+			if result.Status/100 != 2 {
+				if failed == 0 {
+					first = string(result.Error)
+				}
+				failed++
+			}
+		}
+	}
+	return fmt.Errorf("%d messages rejected, first error: %s", failed, first)
+}
@@ -0,0 +1,146 @@
+package nslogger
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// TextColumns is the column order of text output, whose header line, written
+// with WithHeader, names the columns. A message type of LogmsgTypeClientinfo,
+// LogmsgTypeDisconnect or, with WithMarkDividers, LogmsgTypeMark gets a line
+// of its own instead.
+var TextColumns = []string{"type", "time", "thread", "tag", "levelName", "message", "file", "line", "function"}
+
+// CSVColumns is the column order of CSV output, also written as its header row.
+var CSVColumns = []string{"time", "type", "seq", "thread", "tag", "level", "levelName", "message", "file", "line", "function"}
+
+/** columns returns the columns of output set with WithColumns, or defaults
+ * if none were. */
+func (o *ParseOptions) columns(defaults []string) []string {
+	if o.Columns != nil {
+		return o.Columns
+	}
+	if o.RelativeTimes {
+		return relativeColumns(defaults)
+	}
+	return defaults
+}
+
+/** field returns the text value of the named column for m. */
+func (o *ParseOptions) field(m *Message, name string) string {
+	switch name {
+	case "time":
+		return o.formatTime(m.Timestamp)
+	case "elapsed":
+		return formatSeconds(m.Elapsed)
+	case "delta":
+		if m.Delta < 0 {
+			return formatSeconds(m.Delta) // logged out of order
+		}
+		return "+" + formatSeconds(m.Delta)
+	case "type":
+		return strconv.Itoa(m.Type)
+	case "depth":
+		return strconv.Itoa(m.Depth)
+	case "source":
+		return m.Source
+	case "seq":
+		return strconv.Itoa(m.Seq)
+	case "lost":
+		if m.Lost == 0 {
+			return ""
+		}
+		return strconv.Itoa(m.Lost)
+	case "repeated":
+		if m.Repeated == 0 {
+			return ""
+		}
+		return strconv.Itoa(m.Repeated)
+	case "thread":
+		return m.ThreadID
+	case "tag":
+		return m.Tag
+	case "level":
+		return strconv.Itoa(m.Level)
+	case "levelName":
+		return m.LevelName
+	case "message":
+		switch {
+		case m.Image != nil:
+			return o.imagePath(m)
+		case m.Binary != nil:
+			return o.formatBinary(m.Binary)
+		case m.IsClientInfo() || m.IsDisconnect():
+			return clientEvent(m)
+		case m.Type == LogmsgTypeBlockend && m.Payload == "" && m.Duration != 0:
+			return blockEnd(m)
+		}
+		return m.Payload
+	case "file":
+		return m.Filename
+	case "line":
+		if m.LineNumber == 0 {
+			return ""
+		}
+		return strconv.Itoa(m.LineNumber)
+	case "function":
+		return m.FunctionName
+	}
+	return ""
+}
+
+// WriteCSV writes msgs to w as CSV with a header row, using CSVColumns unless
+// other columns are set with WithColumns.
+// Fields containing commas, quotes or newlines are quoted.
+func WriteCSV(w io.Writer, msgs []Message, opts ...Option) error {
+	return writeCSV(csv.NewWriter(w), msgs, newParseOptions(opts))
+}
+
+func writeCSV(cw *csv.Writer, msgs []Message, o *ParseOptions) error {
+	columns := o.columns(CSVColumns)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+
+	record := make([]string, len(columns))
+	for i := range msgs {
+		if err := o.writeCSVRecord(cw, columns, record, &msgs[i]); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+/** writeCSVRecord writes the columns of m to cw, using record as buffer. */
+func (o *ParseOptions) writeCSVRecord(cw *csv.Writer, columns, record []string, m *Message) error {
+	for j, name := range columns {
+		record[j] = o.field(m, name)
+	}
+	return cw.Write(record)
+}
+
+/** formatCSV decodes b into CSV written to w, using separator as the field
+ * delimiter if it is a single character. */
+func formatCSV(w io.Writer, b []byte, separator string, o *ParseOptions) error {
+	cw := csv.NewWriter(w)
+	if r := []rune(separator); len(r) == 1 {
+		cw.Comma = r[0]
+	}
+	columns := o.columns(CSVColumns)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+
+	record := make([]string, len(columns))
+	err := eachMessage(b, o, func(m *Message) error {
+		return o.writeCSVRecord(cw, columns, record, m)
+	})
+	cw.Flush()
+	if err == nil {
+		err = cw.Error()
+	}
+	return err
+}
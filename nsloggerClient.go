@@ -0,0 +1,171 @@
+package nslogger
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Logger sends log messages in the NSLogger binary format to a desktop
+// viewer, or to any io.Writer such as a capture file.
+type Logger struct {
+	// ThreadID is sent as the thread of every message, Go having no notion
+	// of threads visible to programs. Defaults to "main".
+	ThreadID string
+
+	mu  sync.Mutex
+	w   io.Writer
+	seq int
+}
+
+// Dial connects to the NSLogger viewer at addr over plain TCP.
+func Dial(addr string) (*Logger, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return newConnLogger(conn)
+}
+
+// DialTLS connects to the NSLogger viewer at addr over TLS, which the viewer
+// requires by default. If config is nil the viewer certificate is not
+// verified, as it is usually self-signed.
+func DialTLS(addr string, config *tls.Config) (*Logger, error) {
+	if config == nil {
+		config = &tls.Config{InsecureSkipVerify: true}
+	}
+	conn, err := tls.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, err
+	}
+	return newConnLogger(conn)
+}
+
+func newConnLogger(conn net.Conn) (*Logger, error) {
+	l, err := NewLogger(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// NewLogger returns a Logger writing messages to w, starting with a client
+// info message describing the running program.
+func NewLogger(w io.Writer) (*Logger, error) {
+	return newLogger(w, "")
+}
+
+/** newLogger returns a Logger writing to w, sending token in its client info
+ * message if not empty. */
+func newLogger(w io.Writer, token string) (*Logger, error) {
+	l := &Logger{ThreadID: "main", w: w}
+
+	e := newMessageEncoder(LogmsgTypeClientinfo)
+	e.addTimestamp(time.Now())
+	e.addString(PartKeyClientName, filepath.Base(os.Args[0]))
+	e.addString(PartKeyOsName, runtime.GOOS)
+	e.addString(PartKeyOsVersion, runtime.Version())
+	if hostname, err := os.Hostname(); err == nil {
+		e.addString(PartKeyUniqueid, hostname)
+	}
+	if token != "" {
+		e.addString(DefaultAuthTokenKey, token)
+	}
+	if _, err := w.Write(e.bytes()); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Send writes m, assigning its sequence number. The timestamp and thread are
+// filled in if not set.
+func (l *Logger) Send(m *Message) error {
+	return l.send(m, nil)
+}
+
+/** send sends m like Send, calling extra, if not nil, to add parts to the
+ * encoded message. */
+func (l *Logger) send(m *Message, extra func(*messageEncoder)) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	m.Seq = l.seq
+	if m.Timestamp.IsZero() {
+		m.Timestamp = time.Now()
+	}
+	if m.ThreadID == "" {
+		m.ThreadID = l.ThreadID
+	}
+
+	e := messageEncoderFor(m)
+	if extra != nil {
+		extra(e)
+	}
+	_, err := l.w.Write(e.bytes())
+	return err
+}
+
+/** logMessage sends m after setting its location to the caller of the
+ * exported logging function. */
+func (l *Logger) logMessage(m *Message) error {
+	if pc, file, line, ok := runtime.Caller(2); ok {
+		m.Filename = file
+		m.LineNumber = line
+		if fn := runtime.FuncForPC(pc); fn != nil {
+			m.FunctionName = fn.Name()
+		}
+	}
+	return l.Send(m)
+}
+
+// Log sends a text message with the given tag and level.
+func (l *Logger) Log(tag string, level int, text string) error {
+	return l.logMessage(&Message{Type: LogmsgTypeLog, Tag: tag, Level: level, Payload: text})
+}
+
+// Logf sends a text message formatted with fmt.Sprintf.
+func (l *Logger) Logf(tag string, level int, format string, args ...interface{}) error {
+	return l.logMessage(&Message{Type: LogmsgTypeLog, Tag: tag, Level: level, Payload: fmt.Sprintf(format, args...)})
+}
+
+// LogData sends a binary message.
+func (l *Logger) LogData(tag string, level int, data []byte) error {
+	return l.logMessage(&Message{Type: LogmsgTypeLog, Tag: tag, Level: level, Binary: data})
+}
+
+// LogImage sends a PNG image of the given size.
+func (l *Logger) LogImage(tag string, level int, png []byte, width, height int) error {
+	return l.logMessage(&Message{Type: LogmsgTypeLog, Tag: tag, Level: level, Image: png, ImageWidth: width, ImageHeight: height})
+}
+
+// StartBlock starts a block grouping the following messages until EndBlock.
+func (l *Logger) StartBlock(text string) error {
+	return l.logMessage(&Message{Type: LogmsgTypeBlockstart, Payload: text})
+}
+
+// EndBlock ends the last started block.
+func (l *Logger) EndBlock() error {
+	return l.Send(&Message{Type: LogmsgTypeBlockend})
+}
+
+// Mark places a mark with the given label in the log flow.
+func (l *Logger) Mark(label string) error {
+	return l.Send(&Message{Type: LogmsgTypeMark, Payload: label})
+}
+
+// Close closes the underlying connection or writer, if it can be closed.
+func (l *Logger) Close() error {
+	if c, ok := l.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
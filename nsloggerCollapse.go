@@ -0,0 +1,63 @@
+package nslogger
+
+import (
+	"bytes"
+)
+
+// WithCollapse collapses runs of identical consecutive log messages, as
+// logged by retry loops, into their first message, whose Repeated field
+// counts the messages collapsed into it, like syslog's "last message repeated
+// N times". Messages are identical when all their fields but their timestamp
+// and sequence number are. Collapsing applies to the messages passing the
+// filters, each message being output once the next different one is read.
+func WithCollapse() Option {
+	return func(o *ParseOptions) {
+		o.Collapse = true
+	}
+}
+
+/** collapser collapses runs of identical messages. */
+type collapser struct {
+	last *Message // first message of the current run
+}
+
+/** newCollapser returns the collapser of o, nil if collapsing is off. */
+func (o *ParseOptions) newCollapser() *collapser {
+	if !o.Collapse {
+		return nil
+	}
+	return &collapser{}
+}
+
+/** feed returns the message to output once m is read: the first message of
+ * the previous run if m starts a new one, nil otherwise. */
+func (c *collapser) feed(m *Message) *Message {
+	if c.last != nil && sameMessage(c.last, m) {
+		c.last.Repeated++
+		return nil
+	}
+	prev := c.last
+	c.last = m
+	return prev
+}
+
+/** flush returns the first message of the current run, if any, at the end of
+ * the stream. A nil collapser has none. */
+func (c *collapser) flush() *Message {
+	if c == nil {
+		return nil
+	}
+	m := c.last
+	c.last = nil
+	return m
+}
+
+/** sameMessage reports whether the log messages a and b are identical but
+ * for their timestamp and sequence number. */
+func sameMessage(a, b *Message) bool {
+	return a.Type == LogmsgTypeLog && b.Type == LogmsgTypeLog &&
+		a.Level == b.Level && a.Tag == b.Tag && a.ThreadID == b.ThreadID &&
+		a.Payload == b.Payload && a.Filename == b.Filename &&
+		a.LineNumber == b.LineNumber && a.FunctionName == b.FunctionName &&
+		a.Source == b.Source && bytes.Equal(a.Binary, b.Binary) && bytes.Equal(a.Image, b.Image)
+}
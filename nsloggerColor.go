@@ -0,0 +1,85 @@
+package nslogger
+
+import (
+	"os"
+)
+
+// ANSI escape sequences used by colored text output.
+const (
+	ColorReset = "\x1b[0m"
+	ColorDim   = "\x1b[2m"
+	ColorTag   = "\x1b[1;36m" // bold cyan
+	ColorEvent = "\x1b[1;34m" // bold blue, for client events and marks
+)
+
+/** colorMatch and colorMatchEnd surround highlighted matches, in reverse
+ * video so that they keep the color of their field. */
+const (
+	colorMatch    = "\x1b[7m"
+	colorMatchEnd = "\x1b[27m"
+)
+
+// LevelColor returns the ANSI escape sequence coloring messages of the given
+// level in colored text output: red errors, yellow warnings, dimmed debug and
+// verbose messages. It is empty for info messages.
+func LevelColor(level int) string {
+	switch {
+	case level == LevelError:
+		return "\x1b[1;31m"
+	case level == LevelWarning:
+		return "\x1b[33m"
+	case level >= LevelDebug:
+		return ColorDim
+	}
+	return ""
+}
+
+// WithColor colors text output with ANSI escape sequences, for reading in a
+// terminal: levels and message texts are colored by level, tags highlighted
+// and the other fields dimmed. See ColorEnabled to decide when to use it.
+func WithColor() Option {
+	return func(o *ParseOptions) {
+		o.Color = true
+	}
+}
+
+// ColorEnabled reports whether output written to f should be colored: f is
+// a terminal and colors are not disabled by the NO_COLOR environment variable
+// (see https://no-color.org) or a dumb terminal.
+func ColorEnabled(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+/** paint wraps s in the escape sequence color, if any. */
+func paint(color, s string) string {
+	if color == "" || s == "" {
+		return s
+	}
+	return color + s + ColorReset
+}
+
+/** colorField colors the value of the text output column name of m. */
+func colorField(m *Message, name, value string) string {
+	switch name {
+	case "tag":
+		return paint(ColorTag, value)
+	case "levelName", "level", "message":
+		if m.Type == LogmsgTypeLog {
+			return paint(LevelColor(m.Level), value)
+		}
+		return value
+	}
+	return paint(ColorDim, value)
+}
+
+/** paint colors s like paint if colored output is enabled. */
+func (o *ParseOptions) paint(color, s string) string {
+	if !o.Color {
+		return s
+	}
+	return paint(color, s)
+}
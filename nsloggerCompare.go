@@ -0,0 +1,179 @@
+package nslogger
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// CompareOptions sets how Compare aligns the messages of two captures.
+type CompareOptions struct {
+	// BySeq matches messages by sequence number, for captures of the same
+	// run. Otherwise messages are matched by type, tag, level and text, in
+	// order, as when comparing a passing and a failing run of a UI test.
+	BySeq bool
+
+	// Tolerance, if not zero, only matches messages by text whose times
+	// since the start of their capture differ by at most Tolerance.
+	Tolerance time.Duration
+
+	// ExactText matches texts as they are. Otherwise numbers and
+	// hexadecimal addresses, which differ from a run to the next, are
+	// ignored.
+	ExactText bool
+}
+
+// Comparison is the result of Compare: the messages of each capture that
+// have no match in the other. Client info and disconnect messages are not
+// compared.
+type Comparison struct {
+	Matched int        // number of messages matched
+	OnlyA   []*Message // messages of the first capture only, in order
+	OnlyB   []*Message // messages of the second capture only, in order
+}
+
+// Equal reports whether all the messages compared were matched.
+func (c *Comparison) Equal() bool {
+	return len(c.OnlyA) == 0 && len(c.OnlyB) == 0
+}
+
+/** colorRemoved and colorAdded color the prefixes of the messages of the
+ * first and second capture only in WriteComparison. */
+const (
+	colorRemoved = "\x1b[31m"
+	colorAdded   = "\x1b[32m"
+)
+
+/** variablePattern matches the parts of texts ignored by Compare unless
+ * ExactText is set: hexadecimal addresses and numbers. */
+var variablePattern = regexp.MustCompile(`0x[0-9a-fA-F]+|[0-9]+`)
+
+/** compareKey returns what messages must share to match by text. */
+func (opts CompareOptions) compareKey(m *Message) string {
+	text := m.Payload
+	if !opts.ExactText {
+		text = variablePattern.ReplaceAllString(text, "#")
+	}
+	return strconv.Itoa(m.Type) + "\x00" + m.Tag + "\x00" + strconv.Itoa(m.Level) + "\x00" + text
+}
+
+// Compare aligns the messages of two captures a and b and reports those
+// present in one but not the other.
+func Compare(a, b []Message, opts CompareOptions) *Comparison {
+	ma, mb := compared(a), compared(b)
+	matchedA := make([]bool, len(ma))
+	matchedB := make([]bool, len(mb))
+	c := &Comparison{}
+
+	if opts.BySeq {
+		bySeq := make(map[int]int, len(mb))
+		for j, m := range mb {
+			bySeq[m.Seq] = j
+		}
+		for i, m := range ma {
+			if j, ok := bySeq[m.Seq]; ok && opts.compareKey(m) == opts.compareKey(mb[j]) {
+				matchedA[i], matchedB[j] = true, true
+				c.Matched++
+			}
+		}
+	} else {
+		// Each message of a matches the first message of b left with its key,
+		// within the tolerance
+		startA, startB := start(ma), start(mb)
+		pending := make(map[string][]int)
+		for j, m := range mb {
+			key := opts.compareKey(m)
+			pending[key] = append(pending[key], j)
+		}
+		for i, m := range ma {
+			key := opts.compareKey(m)
+			candidates := pending[key]
+			for k, j := range candidates {
+				if opts.Tolerance > 0 {
+					delta := m.Timestamp.Sub(startA) - mb[j].Timestamp.Sub(startB)
+					if delta > opts.Tolerance || delta < -opts.Tolerance {
+						continue
+					}
+				}
+				matchedA[i], matchedB[j] = true, true
+				c.Matched++
+				pending[key] = append(candidates[:k:k], candidates[k+1:]...)
+				break
+			}
+		}
+	}
+
+	for i, m := range ma {
+		if !matchedA[i] {
+			c.OnlyA = append(c.OnlyA, m)
+		}
+	}
+	for j, m := range mb {
+		if !matchedB[j] {
+			c.OnlyB = append(c.OnlyB, m)
+		}
+	}
+	return c
+}
+
+/** compared returns the messages of msgs that Compare compares. */
+func compared(msgs []Message) []*Message {
+	var list []*Message
+	for i := range msgs {
+		if !msgs[i].IsClientInfo() && !msgs[i].IsDisconnect() {
+			list = append(list, &msgs[i])
+		}
+	}
+	return list
+}
+
+/** start returns the time of the earliest of msgs. */
+func start(msgs []*Message) time.Time {
+	var t time.Time
+	for _, m := range msgs {
+		if t.IsZero() || m.Timestamp.Before(t) {
+			t = m.Timestamp
+		}
+	}
+	return t
+}
+
+// WriteComparison writes the text output of the messages of c found in one
+// capture only to w, in order of their time since the start of their
+// capture, as diff does: messages of the first capture only start with "- ",
+// and messages of the second capture only with "+ ".
+func WriteComparison(w io.Writer, c *Comparison, opts ...Option) error {
+	o := newParseOptions(opts)
+	separator := o.Separator
+	if separator == "" {
+		separator = DefaultSeparator
+	}
+
+	type line struct {
+		since  time.Duration
+		prefix string
+		m      *Message
+	}
+	var lines []line
+	startA, startB := start(c.OnlyA), start(c.OnlyB)
+	for _, m := range c.OnlyA {
+		lines = append(lines, line{m.Timestamp.Sub(startA), "- ", m})
+	}
+	for _, m := range c.OnlyB {
+		lines = append(lines, line{m.Timestamp.Sub(startB), "+ ", m})
+	}
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].since < lines[j].since })
+
+	bw := bufio.NewWriter(w)
+	for _, l := range lines {
+		color := colorAdded
+		if l.prefix == "- " {
+			color = colorRemoved
+		}
+		bw.WriteString(o.paint(color, l.prefix) + o.formatText(l.m, separator) + "\n")
+	}
+	return bw.Flush()
+}
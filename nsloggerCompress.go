@@ -0,0 +1,86 @@
+package nslogger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrUnsupportedCompression is returned when decoding a capture compressed
+// in a format other than gzip, such as zstd, which must be decompressed
+// beforehand.
+var ErrUnsupportedCompression = errors.New("nslogger: unsupported compression")
+
+/** Magic numbers starting compressed captures. Captures themselves start
+ * with the size of their first message, which would have to be larger than
+ * 500 MB to be mistaken for them. */
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+/** compression returns the name of the compression format of the capture
+ * starting with b, empty if not compressed. */
+func compression(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, gzipMagic):
+		return "gzip"
+	case bytes.HasPrefix(b, zstdMagic):
+		return "zstd"
+	}
+	return ""
+}
+
+/** decompressed returns the capture b, decompressed if gzip-compressed, up
+ * to max bytes if max is not zero. */
+func decompressed(b []byte, max int64) ([]byte, error) {
+	switch compression(b) {
+	case "gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		var r io.Reader = zr
+		if max > 0 {
+			r = io.LimitReader(zr, max+1)
+		}
+		b, err = io.ReadAll(r)
+		if err == io.ErrUnexpectedEOF {
+			err = nil // truncated like an uncompressed capture would be
+		}
+		if err == nil && max > 0 && int64(len(b)) > max {
+			err = fmt.Errorf("%w: capture larger than %d bytes once decompressed", ErrLimitExceeded, max)
+		}
+		return b, err
+	case "zstd":
+		return nil, fmt.Errorf("%w: zstd, decompress the capture with zstd -d first", ErrUnsupportedCompression)
+	}
+	return b, nil
+}
+
+/** decompress makes d read its stream decompressed, if gzip-compressed,
+ * checking the first bytes of the stream. */
+func (d *Decoder) decompress() error {
+	var head [4]byte
+	n, err := io.ReadFull(d.r, head[:])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	r := io.MultiReader(bytes.NewReader(head[:n]), d.r)
+
+	switch compression(head[:n]) {
+	case "gzip":
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		d.r = zr
+	case "zstd":
+		return fmt.Errorf("%w: zstd, decompress the capture with zstd -d first", ErrUnsupportedCompression)
+	default:
+		d.r = r
+	}
+	return nil
+}
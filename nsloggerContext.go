@@ -0,0 +1,120 @@
+package nslogger
+
+import (
+	"context"
+	"io"
+)
+
+// WithContext makes decoding stop with the error of ctx once it is done, to
+// abort the parsing of large captures. It is checked before each message.
+func WithContext(ctx context.Context) Option {
+	return func(o *ParseOptions) {
+		o.ctx = ctx
+	}
+}
+
+/** canceled returns the error of the context of o once it is done. */
+func (o *ParseOptions) canceled() error {
+	if o.ctx == nil {
+		return nil
+	}
+	return o.ctx.Err()
+}
+
+// ParseContext is like NsLoggerParse, reading the capture from r. Reading and
+// parsing stop with the error of ctx once it is done.
+func ParseContext(ctx context.Context, r io.Reader, separator string, opts ...Option) (string, error) {
+	b, err := io.ReadAll(&contextReader{ctx: ctx, r: r})
+	if err != nil {
+		return "", err
+	}
+	return NsLoggerParse(b, separator, append(opts, WithContext(ctx))...)
+}
+
+// DecodeContext is like Decode, reading the capture from r. Reading and
+// decoding stop with the error of ctx once it is done.
+func DecodeContext(ctx context.Context, r io.Reader, opts ...Option) ([]Message, error) {
+	var msgs []Message
+	d := NewDecoder(&contextReader{ctx: ctx, r: r}, append(opts, WithContext(ctx))...)
+	for {
+		m, err := d.Next()
+		if err == io.EOF {
+			return msgs, nil
+		}
+		if err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, *m)
+	}
+}
+
+// DecodeChanBuffer is the capacity of the message channels of DecodeChan.
+const DecodeChanBuffer = 64
+
+// DecodeChan decodes the stream r in a new goroutine and delivers its
+// messages on the returned message channel, which is closed once the stream
+// is decoded. A decoding error, or the error of ctx once it is done, is then
+// sent on the error channel before it is closed, nothing being sent at the
+// end of the stream. Decoding waits for the messages to be received, so that
+// ctx must be canceled to stop it when they no longer are.
+func DecodeChan(ctx context.Context, r io.Reader, opts ...Option) (<-chan *Message, <-chan error) {
+	msgs := make(chan *Message, DecodeChanBuffer)
+	errc := make(chan error, 1)
+	d := NewDecoder(&contextReader{ctx: ctx, r: r}, append(opts, WithContext(ctx))...)
+
+	go func() {
+		defer close(errc)
+		defer close(msgs)
+		for {
+			m, err := d.Next()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				errc <- err
+				return
+			}
+			select {
+			case msgs <- m:
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			}
+		}
+	}()
+	return msgs, errc
+}
+
+// ListenAndServeContext is like ListenAndServe, closing the listener once ctx
+// is done. It then returns the error of ctx.
+func (l *Listener) ListenAndServeContext(ctx context.Context) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			l.Close()
+		case <-stop:
+		}
+	}()
+
+	err := l.ListenAndServe()
+	if err == ErrListenerClosed && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+/** contextReader is a reader failing with the error of its context once it
+ * is done. */
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
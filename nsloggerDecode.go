@@ -1,11 +1,13 @@
 package nslogger
 
 import (
-	. "bytes"
-	. "encoding/binary"
+	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -87,172 +89,556 @@ const LogmsgTypeClientinfo = 3 // Information about the client app
 const LogmsgTypeDisconnect = 4 // Pseudo-message on the desktop side to identify client disconnects
 const LogmsgTypeMark = 5       // Pseudo-message that defines a "mark" that users can place in the log flow
 
-func check(err error) {
+func unknownPartType(partType uint8, nBytes uint32) error {
+	off := int64(nBytes) + 1
+	return &offsetError{offset: off, err: &ErrUnknownPartType{Type: partType, Offset: off}}
+}
+
+// NsLoggerParse parses the capture b and returns its messages formatted as
+// text, one per line with fields joined by separator, or in the format set
+// with WithFormat. gzip-compressed captures are decompressed first. See
+// ParseToWriter to write the output as it is produced.
+func NsLoggerParse(b []byte, separator string, opts ...Option) (string, error) {
+	o := newParseOptions(opts)
+	b, err := decompressed(b, o.Limits.MaxCaptureSize)
 	if err != nil {
-		log.Fatal(err)
+		return "", err
 	}
+	var res strings.Builder
+	err = parseTo(b, &res, separator, o)
+	return res.String(), err
 }
 
-/** appendValue append new data part to log message */
-func appendValue(b []byte, nBytes uint32, m logMessage) uint32 {
-	partSize := uint32(0)
-	switch partType := b[nBytes+1]; partType {
-	case PartTypeInt16:
-		partSize = 2
-		var val int16
-		err := Read(NewReader(b[2+nBytes:2+nBytes+partSize]), BigEndian, &val)
-		check(err)
-		m.addInt16(val)
-	case PartTypeInt32:
-		partSize = 4
-		var val int32
-		err := Read(NewReader(b[nBytes+2:nBytes+2+partSize]), BigEndian, &val)
-		check(err)
-		m.addInt32(val)
-	case PartTypeInt64:
-		partSize = 8
-		var val int64
-		err := Read(NewReader(b[nBytes+2:nBytes+2+partSize]), BigEndian, &val)
-		check(err)
-		m.addInt64(val)
-	case PartTypeString:
-		partSize = BigEndian.Uint32(b[nBytes+2 : nBytes+6])
-		m.addString(string(b[nBytes+6 : nBytes+6+partSize]))
-		partSize += 4 // Add length of partSize included in message for correct offset
-	case PartTypeBinary:
-		fmt.Println("PART_TYPE_BINARY, not supported")
-		partSize = BigEndian.Uint32(b[nBytes+2 : nBytes+6])
-		// TODO read data
-		partSize += 4
-	case PartTypeImage:
-		fmt.Println("PART_TYPE_IMAGE, not supported")
-		partSize = BigEndian.Uint32(b[nBytes+2 : nBytes+6])
-		// TODO read data
-		partSize += 4
+// ParseToWriter parses the capture b and writes its messages to w, formatted
+// like NsLoggerParse does, with fields separated by the separator set with
+// WithSeparator, DefaultSeparator if not set. On error, the output of the
+// messages preceding the failing one is written, except in table format.
+func ParseToWriter(b []byte, w io.Writer, opts ...Option) error {
+	o := newParseOptions(opts)
+	b, err := decompressed(b, o.Limits.MaxCaptureSize)
+	if err != nil {
+		return err
+	}
+	separator := o.Separator
+	if separator == "" {
+		separator = DefaultSeparator
+	}
+	return parseTo(b, w, separator, o)
+}
+
+/** parseTo writes the output of b in the format of o to w. On error, the
+ * output of the messages preceding the failing one is written, except in
+ * table format, whose column widths depend on all the messages: nothing is
+ * written then. */
+func parseTo(b []byte, w io.Writer, separator string, o *ParseOptions) error {
+	bw := bufio.NewWriter(w)
+
+	if o.Header && o.Format == FormatText {
+		bw.WriteString(o.textHeader(separator))
+		bw.WriteByte('\n')
+	}
+
+	var err error
+	switch {
+	case o.Format == FormatJSON:
+		err = writeJSON(bw, b, o)
+	case o.Format == FormatCSV:
+		err = formatCSV(bw, b, separator, o)
+	case o.Format == FormatTemplate:
+		err = writeTemplate(bw, b, o)
+	case o.Format == FormatLogfmt:
+		err = writeLogfmt(bw, b, o)
+	case o.Format == FormatHTML:
+		err = writeHTML(bw, b, o)
+	case o.Format == FormatTable:
+		err = writeTable(bw, b, o)
+	case o.parallel():
+		err = parseParallel(bw, b, separator, o)
 	default:
-		fmt.Println("Unkown part type", partType)
+		err = parseText(bw, b, separator, o)
+	}
 
-		err := errors.New("Unkown part type")
-		check(err)
+	if ferr := bw.Flush(); err == nil {
+		err = ferr
 	}
+	return err
+}
 
-	return partSize
+/** parseText writes the text output of b to w. */
+func parseText(w *bufio.Writer, b []byte, separator string, o *ParseOptions) error {
+	if err := checkCaptureSize(b); err != nil {
+		return err
+	}
+	var fileSize = uint32(len(b))
+	var nBytes = uint32(0)
+	var state streamState
+	grep := o.newGrepper()
+	collapse := o.newCollapser()
+	order := reorderer{window: o.Reorder}
+
+	output := func(msg *Message) error {
+		if grep == nil {
+			w.WriteString(o.formatText(msg, separator))
+			return w.WriteByte('\n')
+		}
+		for _, m := range grep.feed(msg) {
+			if err := o.writeTextLine(w, m, separator); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	write := func(dm decodedMessage) error {
+		msg := dm.msg
+		o.warned(append(dm.warnings, state.update(msg)...), dm.body)
+		keep, err := o.process(msg)
+		if err != nil || !keep {
+			return err
+		}
+		if collapse != nil {
+			if msg = collapse.feed(msg); msg == nil {
+				return nil
+			}
+		}
+		return output(msg)
+	}
+	// writeReady writes the messages released by order
+	writeReady := func() error {
+		for dm, ok := order.pop(); ok; dm, ok = order.pop() {
+			if err := write(dm); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// finish writes the messages still held back, at the end of the input
+	finish := func() error {
+		order.flush()
+		if err := writeReady(); err != nil {
+			return err
+		}
+		if m := collapse.flush(); m != nil {
+			return output(m)
+		}
+		return nil
+	}
+
+	for nBytes < fileSize {
+		if err := o.canceled(); err != nil {
+			return err
+		}
+		if o.ignoreTrailing() && !frameComplete(b, nBytes, o.Quirks) {
+			break
+		}
+		msg, body, warnings, err := messageAt(b, nBytes, o.Lenient, o)
+		if err != nil && o.Recover {
+			next := resync(b, nBytes+1, o)
+			o.skipped(SkippedRange{Start: int64(nBytes), End: int64(next), Err: err})
+			nBytes = next
+			continue
+		}
+		if err != nil {
+			if ferr := finish(); ferr != nil {
+				return ferr
+			}
+			return err
+		}
+		order.push(decodedMessage{msg: &msg, warnings: warnings, body: int64(nBytes) + 4})
+		nBytes += 4 + uint32(len(body))
+
+		if err := writeReady(); err != nil {
+			return err
+		}
+	}
+
+	return finish()
 }
 
-func skipPart(b []byte, nBytes uint32) uint32 {
-	partSize := uint32(0)
+/** writeTextLine writes the text line of m, or the separator of groups of
+ * grep output if m is nil. */
+func (o *ParseOptions) writeTextLine(w *bufio.Writer, m *Message, separator string) error {
+	if m == nil {
+		w.WriteString("--")
+	} else {
+		w.WriteString(o.formatText(m, separator))
+	}
+	return w.WriteByte('\n')
+}
+
+/** formatText formats msg as a line of text made of its fields in columns,
+ * empty ones included so that columns line up from one message to the next. */
+func (o *ParseOptions) formatText(msg *Message, separator string) string {
+	// Create new empty line
+	m := logMessageString{separator: separator, buf: make([]byte, 0, 128)}
+	m.indent = strings.Repeat(o.BlockIndent, msg.Depth)
+
+	if mark, ok := msg.Mark(); ok && o.MarkDividers {
+		return m.indent + o.paint(ColorEvent, o.markDivider(mark))
+	}
+
+	if msg.IsClientInfo() || msg.IsDisconnect() {
+		// Client events get a line of their own rather than being split in columns
+		m.addString(o.paint(ColorDim, o.formatTime(msg.Timestamp)))
+		m.addString(o.paint(ColorEvent, clientEvent(msg)))
+		return m.String()
+	}
+
+	var dump string // hex dump of a binary payload, on lines of their own
+	for _, name := range o.columns(TextColumns) {
+		value := o.field(msg, name)
+		if name == "message" && msg.Binary != nil && msg.Image == nil && o.BinaryFormat == BinaryHexDump {
+			dump, value = value, strconv.Itoa(len(msg.Binary))+" bytes"
+		}
+		if name == "levelName" && value == "" && msg.Type == LogmsgTypeLog {
+			// Levels without a name are output as numbers
+			value = strconv.Itoa(msg.Level)
+		}
+		switch {
+		case name != "message" || msg.Repeated == 0:
+		case msg.Repeated == 1:
+			value += " (repeated once)"
+		default:
+			value += " (repeated " + strconv.Itoa(msg.Repeated) + " times)"
+		}
+		if o.Color {
+			value = colorField(msg, name, o.highlight(name, value))
+		}
+		m.addField(value)
+	}
+
+	if dump != "" {
+		return m.String() + "\n" + m.indent + strings.ReplaceAll(dump, "\n", "\n"+m.indent)
+	}
+	return m.String()
+}
+
+/** textHeader returns the header line of text output, naming its columns. */
+func (o *ParseOptions) textHeader(separator string) string {
+	m := logMessageString{separator: separator}
+	for _, name := range o.columns(TextColumns) {
+		m.addField(name)
+	}
+	return m.String()
+}
+
+// part is a single decoded message part. Integer parts are stored in value,
+// string, binary and image parts in data.
+type part struct {
+	key     uint8
+	typ     uint8
+	value   int64
+	data    []byte
+	decoded interface{} // value of parts of registered types, see RegisterPartType
+}
+
+func (p part) String() string {
+	if p.decoded != nil {
+		return fmt.Sprint(p.decoded)
+	}
+	switch p.typ {
+	case PartTypeInt16, PartTypeInt32, PartTypeInt64:
+		return fmt.Sprintf("%v", p.value)
+	}
+	return string(p.data)
+}
+
+/** readPart reads the part starting at nBytes. It returns the part along with
+ * the number of bytes following the 2-byte key/type header. */
+func readPart(b []byte, nBytes uint32, q Quirks) (part, uint32, error) {
+	if err := need(b, nBytes, 2); err != nil {
+		return part{}, 0, err
+	}
 
-	switch partType := b[nBytes+1]; partType {
+	order := q.order()
+	p := part{key: b[nBytes], typ: b[nBytes+1]}
+	unsized := p.typ == PartTypeString && q&QuirkUnsizedStrings != 0
+	partSize := uint32(0)
+	var t partType
+	switch p.typ {
+	case PartTypeInt16:
+		partSize = 2
 	case PartTypeInt32:
 		partSize = 4
+		if q&QuirkInt16ImageSize != 0 && (p.key == PartKeyImageWidth || p.key == PartKeyImageHeight) {
+			partSize = 2
+		}
 	case PartTypeInt64:
 		partSize = 8
-	case PartTypeString:
-		partSize = BigEndian.Uint32(b[nBytes+2 : nBytes+6])
-		partSize += 4 // Add length of partSize included in message for correct offset
+	case PartTypeString, PartTypeBinary, PartTypeImage:
+		if err := need(b, nBytes+2, 4); err != nil {
+			if unsized {
+				return unsizedString(b, nBytes, p)
+			}
+			return p, 0, err
+		}
+		size := order.Uint32(b[nBytes+2 : nBytes+6])
+		if unsized && need(b, nBytes+6, size) != nil {
+			return unsizedString(b, nBytes, p)
+		}
+		// Sizes larger than b, truncated anyway, are clamped for the sum not to overflow
+		partSize = 4 + min(size, uint32(len(b))) // partSize field included for correct offset
 	default:
-		fmt.Println("Skipping not handled for part type", partType)
-		err := errors.New("Skipping not handled for that part type")
-		check(err)
+		var ok bool
+		if t, ok = registeredPartType(p.typ); !ok {
+			return p, 0, unknownPartType(p.typ, nBytes)
+		}
+		partSize = uint32(t.size)
+		if t.size == 0 {
+			if err := need(b, nBytes+2, 4); err != nil {
+				return p, 0, err
+			}
+			partSize = 4 + min(order.Uint32(b[nBytes+2:nBytes+6]), uint32(len(b)))
+		}
 	}
 
-	return partSize
-}
+	if err := need(b, nBytes+2, partSize); err != nil {
+		return p, 0, err
+	}
 
-func readDate(b []byte, nBytes uint32) (uint32, string) {
-	stringDate := ""
-	partSize := uint32(0)
-	switch partType := b[nBytes+1]; partType {
+	data := b[nBytes+2 : nBytes+2+partSize]
+	switch p.typ {
+	case PartTypeInt16:
+		p.value = int64(int16(order.Uint16(data)))
 	case PartTypeInt32:
-		partSize = 4
-		var val int32
-		err := Read(NewReader(b[nBytes+2:nBytes+2+partSize]), BigEndian, &val)
-		check(err)
-		stringDate = fmt.Sprintf("%v", val)
+		if partSize == 2 {
+			p.value = int64(int16(order.Uint16(data)))
+		} else {
+			p.value = int64(int32(order.Uint32(data)))
+		}
 	case PartTypeInt64:
-		partSize = 8
-		var val int64
-		err := Read(NewReader(b[nBytes+2:nBytes+2+partSize]), BigEndian, &val)
-		check(err)
-		t := time.Unix(val, 0)
-		stringDate = fmt.Sprintf("%v", t)
-	case PartTypeString:
-		partSize = BigEndian.Uint32(b[nBytes+2 : nBytes+6])
-		stringDate = string(b[nBytes+6 : nBytes+6+partSize])
-		partSize += 4 // Add length of partSize included in message for correct offset
+		p.value = int64(order.Uint64(data))
+	case PartTypeString, PartTypeBinary, PartTypeImage:
+		p.data = data[4:]
 	default:
-		fmt.Println("Date can't be parsed using part type:", partType)
-		err := errors.New("Date can't be parsed using that part type")
-		check(err)
+		if t.size == 0 {
+			data = data[4:]
+		}
+		p.data = data
+		if t.decode != nil {
+			var err error
+			if p.decoded, err = t.decode(data); err != nil {
+				return p, 0, &offsetError{offset: int64(nBytes), err: fmt.Errorf("%w: part type %d: %w", ErrCorruptPart, p.typ, err)}
+			}
+		}
 	}
 
-	return partSize, stringDate
+	return p, partSize, nil
 }
 
-func NsLoggerParse(b []byte, separator string) (string, error) {
-	var fileSize = uint32(len(b))
-	var nBytes = uint32(0)
-	totalSize := BigEndian.Uint32(b[nBytes : nBytes+4])
-	var res string
-
-	for nBytes+totalSize < fileSize {
-		nBytes += 4
-		partCount := BigEndian.Uint16(b[nBytes : nBytes+2])
-		nBytes += 2
-		// Create new empty line
-		m := logMessageString{"", separator}
-
-		for partCount > 0 {
-			usedData := uint32(0)
-
-			formatedValue := ""
-
-			key := b[nBytes]
-			switch key {
-			case PartKeyMessageType:
-			case PartKeyTimestampS:
-				usedData, formatedValue = readDate(b, nBytes)
-			case PartKeyTimestampMs:
-			case PartKeyTimestampUs:
-				//usedData = skipPart(b, nBytes)
-			case PartKeyThreadId:
-			case PartKeyTag:
-			case PartKeyLevel:
-			case PartKeyMessage:
-			case PartKeyImageWidth:
-			case PartKeyImageHeight:
-			case PartKeyMessageSeq:
-				// Skip PartKeyMessageSeq as it comes before date and thus shift date column from line to line
-				usedData = skipPart(b, nBytes)
-			case PartKeyFilename:
-			case PartKeyLinenumber:
-			case PartKeyFunctionname:
-			case PartKeyClientName:
-			case PartKeyClientVersion:
-			case PartKeyOsName:
-			case PartKeyOsVersion:
-			case PartKeyClientModel:
-			case PartKeyUniqueid:
-			default:
-				return res, errors.New("Unkown part key")
-			}
+/** decodeMessage decodes a message body, i.e. everything following the
+ * totalSize field, into a Message. It also returns the anomalies found,
+ * located in b, such as the parts that cannot be decoded, which are skipped
+ * in lenient mode. */
+func decodeMessage(b []byte, lenient bool, o *ParseOptions) (Message, []Warning, error) {
+	var m Message
+	warnings, err := decodeMessageInto(&m, b, lenient, o)
+	return m, warnings, err
+}
 
-			if usedData != 0 {
-				m.addString(formatedValue)
-			} else {
-				usedData = appendValue(b, nBytes, &m)
+/** decodeMessageInto decodes a message body into m, which is zero, as
+ * decodeMessage does. */
+func decodeMessageInto(m *Message, b []byte, lenient bool, o *ParseOptions) ([]Warning, error) {
+	var warnings []Warning
+	var s, ms, us int64
+	var hasType, hasTime bool
+	nBytes := uint32(0)
+	if err := need(b, nBytes, 2); err != nil {
+		return nil, err
+	}
+	q := o.Quirks
+	partCount := q.order().Uint16(b[nBytes : nBytes+2])
+	if err := o.checkParts(partCount); err != nil {
+		return nil, err
+	}
+	nBytes += 2
+
+	for ; partCount > 0; partCount-- {
+		p, usedData, err := readPart(b, nBytes, q)
+		if err != nil {
+			if !lenient || errors.Is(err, ErrTruncatedMessage) {
+				return warnings, err
+			}
+			size, serr := declaredPartSize(b, nBytes, q)
+			if serr != nil {
+				return warnings, serr
 			}
+			warnings = append(warnings, Warning{Kind: WarningSkippedPart, Offset: int64(nBytes), Key: p.key, Type: p.typ, Err: unlocated(err)})
+			nBytes += 2 + size
+			continue
+		}
+		if err := o.checkPart(p); err != nil {
+			return warnings, &offsetError{offset: int64(nBytes), err: err}
+		}
 
-			partCount--
-			nBytes += (2 + usedData)
+		switch p.key {
+		case PartKeyMessageType:
+			m.Type = int(p.value)
+			hasType = true
+		case PartKeyTimestampS:
+			s = p.value
+			hasTime = true
+		case PartKeyTimestampMs:
+			ms = p.value
+		case PartKeyTimestampUs:
+			us = p.value
+		case PartKeyThreadId:
+			m.ThreadID = o.partString(p)
+		case PartKeyTag:
+			m.Tag = o.partString(p)
+		case PartKeyLevel:
+			m.Level = int(p.value)
+		case PartKeyMessage:
+			switch p.typ {
+			case PartTypeBinary:
+				m.Binary = append([]byte(nil), p.data...)
+			case PartTypeImage:
+				m.Image = append([]byte(nil), p.data...)
+			default:
+				m.Payload = p.String()
+			}
+		case PartKeyMessageSeq:
+			m.Seq = int(p.value)
+		case PartKeyFilename:
+			m.Filename = o.partString(p)
+		case PartKeyLinenumber:
+			m.LineNumber = int(p.value)
+		case PartKeyFunctionname:
+			m.FunctionName = o.partString(p)
+		case PartKeyImageWidth:
+			m.ImageWidth = int(p.value)
+		case PartKeyImageHeight:
+			m.ImageHeight = int(p.value)
+		case PartKeyClientName:
+			m.clientInfo().Name = o.partString(p)
+		case PartKeyClientVersion:
+			m.clientInfo().Version = o.partString(p)
+		case PartKeyOsName:
+			m.clientInfo().OSName = o.partString(p)
+		case PartKeyOsVersion:
+			m.clientInfo().OSVersion = o.partString(p)
+		case PartKeyClientModel:
+			m.clientInfo().Model = o.partString(p)
+		case PartKeyUniqueid:
+			m.clientInfo().UniqueID = o.partString(p)
+		default:
+			if _, ok := registeredPartKey(p.key); !ok {
+				off := int64(nBytes)
+				warnings = append(warnings, Warning{Kind: WarningUnknownPartKey, Offset: off, Key: p.key, Type: p.typ,
+					Err: &ErrUnknownPartKey{Key: p.key, Offset: off}})
+				break
+			}
+			if err := decodeUserPart(m, p); err != nil {
+				err = fmt.Errorf("%w: part key %d: %w", ErrCorruptPart, p.key, err)
+				if !lenient {
+					return warnings, &offsetError{offset: int64(nBytes), err: err}
+				}
+				warnings = append(warnings, Warning{Kind: WarningSkippedPart, Offset: int64(nBytes), Key: p.key, Type: p.typ, Err: err})
+			}
 		}
 
-		res += (m.String() + "\n")
+		nBytes += 2 + usedData
+	}
+
+	// Milliseconds and microseconds are mutually exclusive complements of the seconds
+	m.Timestamp = time.Unix(s, ms*int64(time.Millisecond)+us*int64(time.Microsecond))
+
+	if !hasType {
+		warnings = append(warnings, Warning{Kind: WarningMissingPart, Key: PartKeyMessageType, Err: errors.New("message without message type")})
+	}
+	if !hasTime {
+		warnings = append(warnings, Warning{Kind: WarningMissingPart, Key: PartKeyTimestampS, Err: errors.New("message without timestamp")})
+	}
+
+	return warnings, nil
+}
 
-		// nBytes = nBytes + totalSize
-		totalSize = BigEndian.Uint32(b[nBytes : nBytes+4])
+// Decode parses the messages of an NSLogger binary capture into typed Message
+// values. gzip-compressed captures are decompressed first.
+func Decode(b []byte, opts ...Option) ([]Message, error) {
+	o := newParseOptions(opts)
+	b, err := decompressed(b, o.Limits.MaxCaptureSize)
+	if err != nil {
+		return nil, err
 	}
+	return decode(b, o)
+}
 
-	return res, nil
+// ParseFunc decodes the capture b and calls fn with each message, in order,
+// until fn returns false, without keeping the messages in memory: fn may keep
+// the messages it is passed. Messages are selected and processed by opts as
+// for Decode. gzip-compressed captures are decompressed first.
+func ParseFunc(b []byte, fn func(*Message) bool, opts ...Option) error {
+	o := newParseOptions(opts)
+	b, err := decompressed(b, o.Limits.MaxCaptureSize)
+	if err != nil {
+		return err
+	}
+	d := &Decoder{r: bytes.NewReader(b), o: o}
+	for {
+		m, err := d.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !fn(m) {
+			return nil
+		}
+	}
 }
 
+/** eachMessage calls write with each message of b as it is decoded, so that
+ * the messages preceding a failing one are written, and returns the first
+ * error of either. With workers, the messages are decoded in parallel first. */
+func eachMessage(b []byte, o *ParseOptions, write func(m *Message) error) error {
+	if !o.parallel() {
+		return writeEach(&Decoder{r: bytes.NewReader(b), o: o}, write)
+	}
+	msgs, err := decodeParallel(b, o)
+	for i := range msgs {
+		if err := write(&msgs[i]); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+/** writeEach calls write with each message of d, until the end of its
+ * stream or the first error of either. */
+func writeEach(d *Decoder, write func(m *Message) error) error {
+	for {
+		m, err := d.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := write(m); err != nil {
+			return err
+		}
+		d.o.release(m) // written
+	}
+}
+
+func decode(b []byte, o *ParseOptions) ([]Message, error) {
+	if o.parallel() {
+		return decodeParallel(b, o)
+	}
+
+	var msgs []Message
+	d := &Decoder{r: bytes.NewReader(b), o: o}
+
+	for {
+		m, err := d.Next()
+		if err == io.EOF {
+			return msgs, nil
+		}
+		if err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, *m)
+		o.release(m) // copied
+	}
+}
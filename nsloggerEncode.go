@@ -0,0 +1,186 @@
+package nslogger
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+/** messageEncoder builds a message in the NSLogger binary format, see the
+ * format description in nsloggerDecode.go. */
+type messageEncoder struct {
+	partCount uint16
+	buf       []byte
+}
+
+func newMessageEncoder(msgType int) *messageEncoder {
+	e := &messageEncoder{buf: make([]byte, 6, 256)} // room for totalSize and partCount
+	e.addInt32(PartKeyMessageType, int32(msgType))
+	return e
+}
+
+func (e *messageEncoder) addInt32(key uint8, value int32) {
+	e.buf = append(e.buf, key, PartTypeInt32)
+	e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(value))
+	e.partCount++
+}
+
+func (e *messageEncoder) addInt64(key uint8, value int64) {
+	e.buf = append(e.buf, key, PartTypeInt64)
+	e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(value))
+	e.partCount++
+}
+
+func (e *messageEncoder) addData(key uint8, partType uint8, value []byte) {
+	e.buf = append(e.buf, key, partType)
+	e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(len(value)))
+	e.buf = append(e.buf, value...)
+	e.partCount++
+}
+
+func (e *messageEncoder) addString(key uint8, value string) {
+	e.buf = append(e.buf, key, PartTypeString)
+	e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(len(value)))
+	e.buf = append(e.buf, value...)
+	e.partCount++
+}
+
+func (e *messageEncoder) addTimestamp(t time.Time) {
+	e.addInt64(PartKeyTimestampS, t.Unix())
+	e.addInt32(PartKeyTimestampUs, int32(t.Nanosecond()/int(time.Microsecond)))
+}
+
+/** bytes returns the framed message, including its totalSize header. */
+func (e *messageEncoder) bytes() []byte {
+	binary.BigEndian.PutUint32(e.buf[0:4], uint32(len(e.buf)-4))
+	binary.BigEndian.PutUint16(e.buf[4:6], e.partCount)
+	return e.buf
+}
+
+/** encodeMessage encodes m, omitting the optional parts that are not set. */
+func encodeMessage(m *Message) []byte {
+	return messageEncoderFor(m).bytes()
+}
+
+/** messageEncoderFor returns an encoder holding the parts of m, to which
+ * more parts can be added before framing. */
+func messageEncoderFor(m *Message) *messageEncoder {
+	e := newMessageEncoder(m.Type)
+	e.addTimestamp(m.Timestamp)
+	e.addInt32(PartKeyMessageSeq, int32(m.Seq))
+	if m.ThreadID != "" {
+		e.addString(PartKeyThreadId, m.ThreadID)
+	}
+	if m.Tag != "" {
+		e.addString(PartKeyTag, m.Tag)
+	}
+	if m.Level != 0 || m.Tag != "" {
+		e.addInt32(PartKeyLevel, int32(m.Level))
+	}
+	if m.Filename != "" {
+		e.addString(PartKeyFilename, m.Filename)
+	}
+	if m.LineNumber != 0 {
+		e.addInt32(PartKeyLinenumber, int32(m.LineNumber))
+	}
+	if m.FunctionName != "" {
+		e.addString(PartKeyFunctionname, m.FunctionName)
+	}
+
+	switch {
+	case m.Image != nil:
+		e.addData(PartKeyMessage, PartTypeImage, m.Image)
+		if m.ImageWidth != 0 || m.ImageHeight != 0 {
+			e.addInt32(PartKeyImageWidth, int32(m.ImageWidth))
+			e.addInt32(PartKeyImageHeight, int32(m.ImageHeight))
+		}
+	case m.Binary != nil:
+		e.addData(PartKeyMessage, PartTypeBinary, m.Binary)
+	case m.Payload != "":
+		e.addString(PartKeyMessage, m.Payload)
+	}
+
+	if c := m.Client; c != nil {
+		for _, p := range []struct {
+			key   uint8
+			value string
+		}{
+			{PartKeyClientName, c.Name},
+			{PartKeyClientVersion, c.Version},
+			{PartKeyOsName, c.OSName},
+			{PartKeyOsVersion, c.OSVersion},
+			{PartKeyClientModel, c.Model},
+			{PartKeyUniqueid, c.UniqueID},
+		} {
+			if p.value != "" {
+				e.addString(p.key, p.value)
+			}
+		}
+	}
+	e.addExtra(m)
+
+	return e
+}
+
+// Encoder writes messages in the NSLogger binary format, as found in
+// .rawnsloggerdata files, e.g. to save a filtered copy of a capture that the
+// desktop viewer can open.
+type Encoder struct {
+	w io.Writer
+}
+
+// NewEncoder returns an Encoder writing to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes m, its optional parts being omitted when not set.
+func (e *Encoder) Encode(m *Message) error {
+	_, err := e.w.Write(encodeMessage(m))
+	return err
+}
+
+// FileWriter writes messages to a .rawnsloggerdata file.
+type FileWriter struct {
+	*Encoder
+	f  *os.File
+	zw *gzip.Writer // compresses the file, if named with a .gz extension
+	bw *bufio.Writer
+}
+
+// CreateFile creates or truncates the named file and returns a FileWriter
+// writing to it. Files named with a .gz extension are gzip-compressed, as
+// Decode and Decoder decompress them.
+func CreateFile(name string) (*FileWriter, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	w := &FileWriter{f: f}
+	if strings.HasSuffix(name, ".gz") {
+		w.zw = gzip.NewWriter(f)
+		w.bw = bufio.NewWriter(w.zw)
+	} else {
+		w.bw = bufio.NewWriter(f)
+	}
+	w.Encoder = NewEncoder(w.bw)
+	return w, nil
+}
+
+// Close flushes the messages written and closes the file.
+func (w *FileWriter) Close() error {
+	err := w.bw.Flush()
+	if w.zw != nil {
+		if zerr := w.zw.Close(); err == nil {
+			err = zerr
+		}
+	}
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
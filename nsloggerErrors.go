@@ -0,0 +1,154 @@
+package nslogger
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var (
+	// ErrTruncatedMessage is returned when the input ends in the middle of a
+	// message, or when a part extends past the end of its message.
+	ErrTruncatedMessage = errors.New("nslogger: truncated message")
+
+	// ErrCorruptPart is returned when a part of a message cannot be decoded.
+	ErrCorruptPart = errors.New("nslogger: corrupt part")
+)
+
+// ErrTruncated is the error of truncated messages, located at the offset of
+// the message or part concerned. It matches ErrTruncatedMessage with
+// errors.Is.
+type ErrTruncated struct {
+	Offset int64
+}
+
+func (e *ErrTruncated) Error() string {
+	return ErrTruncatedMessage.Error()
+}
+
+func (e *ErrTruncated) Is(target error) bool {
+	return target == ErrTruncatedMessage
+}
+
+// ErrUnknownPartType is the error of parts of a type that is neither one of
+// the protocol nor registered with RegisterPartType, located at the offset of
+// their type. It matches ErrCorruptPart with errors.Is, the size of such parts
+// being unknown, and decoding cannot go on past them except in lenient mode.
+type ErrUnknownPartType struct {
+	Type   uint8
+	Offset int64
+}
+
+func (e *ErrUnknownPartType) Error() string {
+	return fmt.Sprintf("%v: unknown part type %d", ErrCorruptPart, e.Type)
+}
+
+func (e *ErrUnknownPartType) Is(target error) bool {
+	return target == ErrCorruptPart
+}
+
+// ErrUnknownPartKey reports a part with a key that is neither one of the
+// protocol nor registered with RegisterPartKey, located at the offset of the
+// part. Such parts are skipped, so that it is only found in warnings of kind
+// WarningUnknownPartKey.
+type ErrUnknownPartKey struct {
+	Key    uint8
+	Offset int64
+}
+
+func (e *ErrUnknownPartKey) Error() string {
+	return fmt.Sprintf("nslogger: unknown part key %d", e.Key)
+}
+
+// ErrorOffset returns the byte offset in the input at which the decoding
+// error err occurred, if known.
+func ErrorOffset(err error) (int64, bool) {
+	var oe *offsetError
+	if errors.As(err, &oe) {
+		return oe.offset, true
+	}
+	return 0, false
+}
+
+/** offsetError locates a decoding error at a byte offset of the input. */
+type offsetError struct {
+	offset int64
+	err    error
+}
+
+func (e *offsetError) Error() string {
+	return fmt.Sprintf("%v at offset %d", e.err, e.offset)
+}
+
+func (e *offsetError) Unwrap() error {
+	return e.err
+}
+
+/** atOffset returns err located at offset off. Errors already located
+ * relative to a message are shifted by off instead. */
+func atOffset(err error, off int64) error {
+	var oe *offsetError
+	if errors.As(err, &oe) {
+		return &offsetError{offset: oe.offset + off, err: shifted(oe.err, off)}
+	}
+	if err == ErrTruncatedMessage {
+		err = &ErrTruncated{}
+	}
+	return &offsetError{offset: off, err: shifted(err, off)}
+}
+
+/** shifted returns err with the offset of structured errors shifted by off,
+ * as their enclosing offsetError is. */
+func shifted(err error, off int64) error {
+	switch e := err.(type) {
+	case *ErrTruncated:
+		return &ErrTruncated{Offset: e.Offset + off}
+	case *ErrUnknownPartType:
+		return &ErrUnknownPartType{Type: e.Type, Offset: e.Offset + off}
+	case *ErrUnknownPartKey:
+		return &ErrUnknownPartKey{Key: e.Key, Offset: e.Offset + off}
+	}
+	return err
+}
+
+/** unlocated returns err without its offset, if located. */
+func unlocated(err error) error {
+	var oe *offsetError
+	if errors.As(err, &oe) {
+		return oe.err
+	}
+	return err
+}
+
+/** need returns an ErrTruncatedMessage error if b holds less than n bytes at off. */
+func need(b []byte, off, n uint32) error {
+	if uint64(off)+uint64(n) > uint64(len(b)) {
+		return &offsetError{offset: int64(off), err: &ErrTruncated{Offset: int64(off)}}
+	}
+	return nil
+}
+
+/** checkCaptureSize returns an ErrLimitExceeded error if the in-memory
+ * capture b is too large for the 32-bit offsets it is decoded with. Larger
+ * captures are decoded as streams, with a Decoder. */
+func checkCaptureSize(b []byte) error {
+	if uint64(len(b)) > math.MaxUint32 {
+		return fmt.Errorf("%w: in-memory capture of %d bytes, the maximum being %d, decode it with a Decoder", ErrLimitExceeded, len(b), uint32(math.MaxUint32))
+	}
+	return nil
+}
+
+/** isDecodeError reports whether err comes from malformed input, as opposed
+ * to a failure to read it. */
+func isDecodeError(err error) bool {
+	return errors.Is(err, ErrTruncatedMessage) || errors.Is(err, ErrCorruptPart) || errors.Is(err, ErrLimitExceeded)
+}
+
+/** frameComplete reports whether b holds a complete message at off, size
+ * header included. */
+func frameComplete(b []byte, off uint32, q Quirks) bool {
+	if need(b, off, 4) != nil {
+		return false
+	}
+	return need(b, off+4, q.order().Uint32(b[off:off+4])) == nil
+}
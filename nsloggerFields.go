@@ -0,0 +1,181 @@
+package nslogger
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Field is a structured field of a log entry, as attached by zap or logrus.
+type Field struct {
+	Key   string
+	Value any
+}
+
+// LogEntry is a log entry of a structured logger, such as a zapcore.Entry
+// with its fields or a logrus.Entry.
+type LogEntry struct {
+	Time    time.Time // now if zero
+	Level   int       // NSLogger level, see ZapLevel and LogrusLevel
+	Message string
+	Fields  []Field
+
+	// Location of the logging call, if known
+	File     string
+	Line     int
+	Function string
+}
+
+// FieldOptions configures a FieldLogger.
+type FieldOptions struct {
+	// TagKey is the key of the field used as message tag, "tag" if empty.
+	TagKey string
+
+	// FieldKeys maps field keys to the user-defined part keys (from
+	// PartKeyUserDefined) under which they are also sent as separate parts,
+	// for viewers extended to display them.
+	FieldKeys map[string]uint8
+}
+
+// FieldLogger sends the entries of structured loggers to an NSLogger viewer
+// through a Logger, as SlogHandler does for log/slog. The tag field becomes
+// the message tag and other fields are appended to the message text as
+// key=value pairs. The zapcore.Core of the github.com/fouge/nslogger/zapcore
+// module and the logrus hook of github.com/fouge/nslogger/logrushook log
+// through it, this package not depending on zap or logrus.
+type FieldLogger struct {
+	l    *Logger
+	opts FieldOptions
+}
+
+// NewFieldLogger returns a FieldLogger sending entries through l. opts may be
+// nil.
+func NewFieldLogger(l *Logger, opts *FieldOptions) *FieldLogger {
+	f := &FieldLogger{l: l}
+	if opts != nil {
+		f.opts = *opts
+	}
+	if f.opts.TagKey == "" {
+		f.opts.TagKey = "tag"
+	}
+	return f
+}
+
+// Log sends e to the viewer.
+func (f *FieldLogger) Log(e LogEntry) error {
+	m := &Message{
+		Type:         LogmsgTypeLog,
+		Timestamp:    e.Time,
+		Level:        e.Level,
+		Filename:     e.File,
+		LineNumber:   e.Line,
+		FunctionName: e.Function,
+	}
+
+	var text strings.Builder
+	text.WriteString(e.Message)
+	var parts []Field
+	for _, field := range e.Fields {
+		if field.Key == f.opts.TagKey {
+			m.Tag = fmt.Sprint(field.Value)
+			continue
+		}
+		if _, ok := f.opts.FieldKeys[field.Key]; ok {
+			parts = append(parts, field)
+		}
+		text.WriteByte(' ')
+		text.WriteString(field.Key)
+		text.WriteByte('=')
+		text.WriteString(fieldText(field.Value))
+	}
+	m.Payload = text.String()
+
+	return f.l.send(m, func(enc *messageEncoder) {
+		for _, field := range parts {
+			key := f.opts.FieldKeys[field.Key]
+			if n, ok := fieldInt(field.Value); ok {
+				enc.addInt64(key, n)
+			} else {
+				enc.addString(key, fmt.Sprint(field.Value))
+			}
+		}
+	})
+}
+
+// SortedFields returns the fields of a map, such as logrus.Fields, sorted by
+// key so that they are sent in a stable order.
+func SortedFields(fields map[string]any) []Field {
+	list := make([]Field, 0, len(fields))
+	for key, value := range fields {
+		list = append(list, Field{Key: key, Value: value})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
+
+// ZapLevel maps a zapcore.Level, from -1 for debug to 5 for fatal, to the
+// nearest NSLogger level.
+func ZapLevel(level int8) int {
+	switch {
+	case level >= 2: // error, dpanic, panic and fatal
+		return LevelError
+	case level == 1:
+		return LevelWarning
+	case level == 0:
+		return LevelInfo
+	case level == -1:
+		return LevelDebug
+	}
+	return LevelVerbose
+}
+
+// LogrusLevel maps a logrus.Level, from 0 for panic to 6 for trace, to the
+// nearest NSLogger level.
+func LogrusLevel(level uint32) int {
+	switch level {
+	case 0, 1, 2: // panic, fatal and error
+		return LevelError
+	case 3:
+		return LevelWarning
+	case 4:
+		return LevelInfo
+	case 5:
+		return LevelDebug
+	}
+	return LevelVerbose
+}
+
+/** fieldText formats v as the value of a key=value pair, quoted when needed
+ * to keep the pairs apart. */
+func fieldText(v any) string {
+	s := fmt.Sprint(v)
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+/** fieldInt returns v as an int64 if it is an integer that fits. */
+func fieldInt(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	}
+	return 0, false
+}
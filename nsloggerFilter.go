@@ -0,0 +1,72 @@
+package nslogger
+
+import (
+	"regexp"
+	"time"
+)
+
+// Filter selects log messages by time, tag, level, thread and text. Empty
+// criteria match everything. Apart from the time window, only regular log
+// messages and blocks are filtered: client info, marks and disconnects match
+// the other criteria.
+type Filter struct {
+	Tags        []string // if not empty, keep only messages with one of these tags
+	ExcludeTags []string // drop messages with one of these tags
+	Threads     []string // if not empty, keep only messages from one of these threads
+
+	// MinLevel, if set, drops messages more verbose than the given level.
+	// NSLogger levels grow with verbosity, 0 being the most important.
+	MinLevel *int
+
+	// TagLevels overrides MinLevel for the tags it holds, e.g. to keep the
+	// verbose messages of the subsystem being debugged and only the errors
+	// and warnings of the others, as the filters of the desktop viewer do.
+	TagLevels map[string]int
+
+	Pattern *regexp.Regexp // if set, keep only messages whose text matches
+
+	Start time.Time // if not zero, drop messages logged before Start
+	End   time.Time // if not zero, drop messages logged at or after End
+}
+
+// Match reports whether m passes the filter.
+func (f *Filter) Match(m *Message) bool {
+	if !f.Start.IsZero() && m.Timestamp.Before(f.Start) {
+		return false
+	}
+	if !f.End.IsZero() && !m.Timestamp.Before(f.End) {
+		return false
+	}
+	if m.Type != LogmsgTypeLog && m.Type != LogmsgTypeBlockstart && m.Type != LogmsgTypeBlockend {
+		return true
+	}
+	if len(f.Tags) > 0 && !contains(f.Tags, m.Tag) {
+		return false
+	}
+	if contains(f.ExcludeTags, m.Tag) {
+		return false
+	}
+	if len(f.Threads) > 0 && !contains(f.Threads, m.ThreadID) {
+		return false
+	}
+	if level, ok := f.TagLevels[m.Tag]; ok {
+		if m.Level > level {
+			return false
+		}
+	} else if f.MinLevel != nil && m.Level > *f.MinLevel {
+		return false
+	}
+	if f.Pattern != nil && !f.Pattern.MatchString(m.Payload) {
+		return false
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,196 @@
+package nslogger
+
+import (
+	"crypto/tls"
+	"io"
+	"sync"
+	"time"
+)
+
+/** messageOverhead approximates the memory taken by a message beyond its
+ * text and data, for FlowControl.MaxQueuedBytes. */
+const messageOverhead = 256
+
+// FlowControl bounds the resources each connection of a Listener takes, so
+// that a device flooding logs can neither exhaust memory nor starve the other
+// sessions.
+type FlowControl struct {
+	// ReadBuffer is the size, in bytes, of the kernel receive buffer of each
+	// TCP connection and of the UDP socket, the system default if 0.
+	ReadBuffer int
+
+	// BytesPerSecond limits the rate at which each connection is read,
+	// unlimited if 0. Messages sent faster wait in the buffers of the
+	// client, which usually drops the oldest when they fill up.
+	BytesPerSecond int64
+
+	// MaxQueued and MaxQueuedBytes, if not zero, let the messages of each
+	// connection be decoded ahead of Handler and SessionHandler, up to that
+	// number of messages or of bytes of text and data, reading being paused
+	// while the queue is full. Otherwise each message is delivered as soon as
+	// decoded, reading being paused while it is handled.
+	MaxQueued      int
+	MaxQueuedBytes int64
+}
+
+/** queued reports whether the messages of connections are queued. */
+func (f *FlowControl) queued() bool {
+	return f.MaxQueued > 0 || f.MaxQueuedBytes > 0
+}
+
+/** setReadBuffer sets the kernel receive buffer size of conn, if set and
+ * conn is a TCP or UDP connection. */
+func (f *FlowControl) setReadBuffer(conn interface{}) error {
+	if f.ReadBuffer <= 0 {
+		return nil
+	}
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn = tc.NetConn()
+	}
+	if c, ok := conn.(interface{ SetReadBuffer(int) error }); ok {
+		return c.SetReadBuffer(f.ReadBuffer)
+	}
+	return nil
+}
+
+/** throttledReader reads from r at up to rate bytes per second, allowing
+ * bursts of a second after idle periods. */
+type throttledReader struct {
+	r    io.Reader
+	rate int64
+	next time.Time // time the next byte may be read at
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	// Reading a tenth of a second of bytes at most keeps waits short, so that
+	// closing the connection is not delayed
+	if chunk := max(t.rate/10, 1); int64(len(p)) > chunk {
+		p = p[:chunk]
+	}
+	now := time.Now()
+	if t.next.Before(now.Add(-time.Second)) {
+		t.next = now.Add(-time.Second)
+	}
+	if wait := t.next.Sub(now); wait > 0 {
+		time.Sleep(wait)
+	}
+	n, err := t.r.Read(p)
+	t.next = t.next.Add(time.Duration(int64(n) * int64(time.Second) / t.rate))
+	return n, err
+}
+
+/** messageQueue is the bounded queue of the messages of a connection
+ * waiting to be delivered, with FlowControl.MaxQueued or MaxQueuedBytes. */
+type messageQueue struct {
+	maxMessages int
+	maxBytes    int64
+
+	mu     sync.Mutex
+	cond   sync.Cond
+	msgs   []*Message
+	bytes  int64
+	closed bool
+}
+
+func newMessageQueue(f FlowControl) *messageQueue {
+	q := &messageQueue{maxMessages: f.MaxQueued, maxBytes: f.MaxQueuedBytes}
+	q.cond.L = &q.mu
+	return q
+}
+
+/** push adds m to the queue, waiting while it is full. It reports whether
+ * it had to wait. A message larger than MaxQueuedBytes waits for the queue
+ * to be empty. */
+func (q *messageQueue) push(m *Message) bool {
+	size := messageSize(m)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	waited := false
+	for len(q.msgs) > 0 && ((q.maxMessages > 0 && len(q.msgs) >= q.maxMessages) || (q.maxBytes > 0 && q.bytes+size > q.maxBytes)) {
+		waited = true
+		q.cond.Wait()
+	}
+	q.msgs = append(q.msgs, m)
+	q.bytes += size
+	q.cond.Broadcast()
+	return waited
+}
+
+/** pop removes the oldest message of the queue, waiting for one. It returns
+ * false once the queue is closed and empty. */
+func (q *messageQueue) pop() (*Message, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.msgs) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.msgs) == 0 {
+		return nil, false
+	}
+	m := q.msgs[0]
+	q.msgs[0] = nil
+	q.msgs = q.msgs[1:]
+	q.bytes -= messageSize(m)
+	q.cond.Broadcast()
+	return m, true
+}
+
+/** close makes pop return false once the queue is empty. */
+func (q *messageQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+}
+
+/** messageSize approximates the memory taken by m. */
+func messageSize(m *Message) int64 {
+	return int64(messageOverhead + len(m.ThreadID) + len(m.Tag) + len(m.Filename) + len(m.FunctionName) +
+		len(m.Payload) + len(m.Binary) + len(m.Image))
+}
+
+/** deliverer returns the function delivering the messages of s, through a
+ * queue with FlowControl.MaxQueued or MaxQueuedBytes, along with the function
+ * waiting for the messages queued to be delivered once s ends. Messages get
+ * their SessionID as they are passed to it, by the goroutine serving s. */
+func (l *Listener) deliverer(s *Session) (deliver func(*Message), wait func()) {
+	if !l.FlowControl.queued() {
+		return func(m *Message) {
+			m.SessionID = s.sessionID()
+			l.deliver(s, m)
+		}, func() {}
+	}
+
+	q := newMessageQueue(l.FlowControl)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			m, ok := q.pop()
+			if !ok {
+				return
+			}
+			l.deliver(s, m)
+		}
+	}()
+	deliver = func(m *Message) {
+		m.SessionID = s.sessionID()
+		if q.push(m) {
+			l.mu.Lock()
+			l.metrics.paused++
+			l.mu.Unlock()
+		}
+	}
+	return deliver, func() {
+		q.close()
+		<-done
+	}
+}
+
+/** throttle returns r read at FlowControl.BytesPerSecond, if set. */
+func (l *Listener) throttle(r io.Reader) io.Reader {
+	if l.FlowControl.BytesPerSecond <= 0 {
+		return r
+	}
+	return &throttledReader{r: r, rate: l.FlowControl.BytesPerSecond}
+}
@@ -0,0 +1,122 @@
+package nslogger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// DefaultFollowInterval is the interval at which a Follow reader checks for
+// data appended to its file, if its interval is 0.
+const DefaultFollowInterval = 250 * time.Millisecond
+
+// ErrFileTruncated is returned by a Follow reader when its file shrinks, as
+// when it is truncated or replaced.
+var ErrFileTruncated = errors.New("nslogger: followed file truncated")
+
+// Follow returns a reader of r that, instead of returning io.EOF at the end of
+// r, waits for data to be appended to it, like tail -f, so that the messages
+// of a capture still being written by a recorder can be decoded as they are
+// written. The end of r is checked for new data every interval,
+// DefaultFollowInterval if 0. Reading fails with the error of ctx once it is
+// done, and with ErrFileTruncated if r is a file that shrinks.
+//
+// A Decoder reading a Follow reader waits for the rest of the incomplete
+// message ending the file, if any.
+func Follow(ctx context.Context, r io.Reader, interval time.Duration) io.Reader {
+	if interval <= 0 {
+		interval = DefaultFollowInterval
+	}
+	return &followReader{ctx: ctx, r: r, interval: interval}
+}
+
+/** followReader is the reader returned by Follow. */
+type followReader struct {
+	ctx      context.Context
+	r        io.Reader
+	interval time.Duration
+	read     int64 // number of bytes read
+}
+
+func (f *followReader) Read(p []byte) (int, error) {
+	for {
+		if err := f.ctx.Err(); err != nil {
+			return 0, err
+		}
+		n, err := f.r.Read(p)
+		f.read += int64(n)
+		if n > 0 || (err != nil && err != io.EOF) {
+			return n, err
+		}
+
+		if file, ok := f.r.(*os.File); ok {
+			if fi, err := file.Stat(); err == nil && fi.Mode().IsRegular() && fi.Size() < f.read {
+				return 0, ErrFileTruncated
+			}
+		}
+
+		t := time.NewTimer(f.interval)
+		select {
+		case <-f.ctx.Done():
+			t.Stop()
+			return 0, f.ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// ParseStream decodes the stream r and writes each message to w as soon as it
+// is decoded, in text (the default), JSON lines, logfmt or template format,
+// so that captures still being written can be followed:
+//
+//	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+//	defer stop()
+//	err := nslogger.ParseStream(nslogger.Follow(ctx, f, 0), os.Stdout)
+//
+// Text fields are separated by the separator set with WithSeparator,
+// DefaultSeparator if not set. Groups of grep output are not separated.
+func ParseStream(r io.Reader, w io.Writer, opts ...Option) error {
+	o := newParseOptions(opts)
+	separator := o.Separator
+	if separator == "" {
+		separator = DefaultSeparator
+	}
+
+	var write func(m *Message) error
+	switch o.Format {
+	case FormatText:
+		if o.Header {
+			if _, err := io.WriteString(w, o.textHeader(separator)+"\n"); err != nil {
+				return err
+			}
+		}
+		write = func(m *Message) error {
+			_, err := io.WriteString(w, o.formatText(m, separator)+"\n")
+			return err
+		}
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		write = func(m *Message) error {
+			return enc.Encode(m)
+		}
+	case FormatLogfmt:
+		write = func(m *Message) error {
+			_, err := io.WriteString(w, o.formatLogfmt(m)+"\n")
+			return err
+		}
+	case FormatTemplate:
+		var line bytes.Buffer
+		write = func(m *Message) error {
+			return o.writeTemplateLine(w, &line, m)
+		}
+	default:
+		return fmt.Errorf("nslogger: format %d cannot be streamed", o.Format)
+	}
+
+	return writeEach(&Decoder{r: r, o: o}, write)
+}
@@ -0,0 +1,13 @@
+//go:build gofuzz
+
+package nslogger
+
+// Fuzz is the go-fuzz entry point, decoding data with FuzzDecode. Malformed
+// input must produce an error, never a panic. Seed the corpus directory with
+// WriteFuzzCorpus. The native target, run by go test, is the FuzzDecode test.
+func Fuzz(data []byte) int {
+	if err := FuzzDecode(data); err != nil {
+		return 0
+	}
+	return 1
+}
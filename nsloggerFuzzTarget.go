@@ -0,0 +1,130 @@
+package nslogger
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FuzzLimits are the limits FuzzDecode decodes with, low enough for fuzzers
+// to run many inputs per second and high enough for every part of the
+// protocol to be reached.
+var FuzzLimits = Limits{
+	MaxMessageSize: 1 << 20,
+	MaxParts:       256,
+	MaxPartSize:    1 << 20,
+	MaxCaptureSize: 16 << 20,
+}
+
+/** maxFuzzSeedSize is the size of the largest test vector of the seed
+ * corpus, fuzzers running faster on small inputs. */
+const maxFuzzSeedSize = 64 << 10
+
+// FuzzDecode decodes data along each decoding path of the package: Decode,
+// strict and lenient, with each quirk, the Decoder in recovery mode with
+// reordering and stitching, lazy decoding, each output format of
+// ParseToWriter, and Validate. It returns the error of the strict Decode, nil
+// if data decodes.
+//
+// It is the entry point for fuzzers, such as the FuzzDecode test of the
+// package, run with go test -fuzz=FuzzDecode: it prints nothing, allocates
+// within FuzzLimits and, by contract, never panics, any panic being a bug of
+// the package.
+func FuzzDecode(data []byte) error {
+	b, err := decompressed(data, FuzzLimits.MaxCaptureSize)
+	if err != nil {
+		return err
+	}
+	limits := WithLimits(FuzzLimits)
+
+	_, err = Decode(b, limits)
+	Decode(b, limits, WithLenient(nil), WithWarnings(func(Warning) {}))
+	for _, q := range []Quirks{QuirkLittleEndian, QuirkInt16ImageSize, QuirkUnsizedStrings} {
+		Decode(b, limits, WithQuirks(q))
+	}
+
+	d := NewDecoder(bytes.NewReader(b), limits, WithRecovery(func(SkippedRange) {}), WithReorder(16), WithStitching(),
+		WithCollapse(), WithRelativeTimes())
+	for {
+		if _, err := d.Next(); err != nil {
+			break
+		}
+	}
+
+	d = NewDecoder(bytes.NewReader(b), limits, WithLenient(nil))
+	for {
+		m, err := d.NextLazy()
+		if err != nil {
+			break
+		}
+		m.Type()
+		m.Timestamp()
+		m.ThreadID()
+		m.Tag()
+		m.Message()
+		m.Binary()
+		m.Decode()
+	}
+
+	for f := FormatText; f <= FormatTable; f++ {
+		if f == FormatTemplate {
+			continue // needs a template
+		}
+		ParseToWriter(b, io.Discard, limits, WithFormat(f))
+	}
+	Validate(b)
+	return err
+}
+
+// FuzzCorpus returns the seed corpus of FuzzDecode: the captures of
+// TestVectors, except the largest ones, and captures written by Encoder
+// covering each message type.
+func FuzzCorpus() [][]byte {
+	var corpus [][]byte
+	for _, v := range TestVectors() {
+		if len(v.Data) <= maxFuzzSeedSize {
+			corpus = append(corpus, v.Data)
+		}
+	}
+
+	t := vectorTime
+	client := &ClientInfo{Name: "Demo", Version: "1.0", OSName: "iOS", OSVersion: "17.2", Model: "iPhone", UniqueID: "0123-4567"}
+	msgs := []*Message{
+		{Type: LogmsgTypeClientinfo, Timestamp: t, Client: client},
+		{Type: LogmsgTypeBlockstart, Timestamp: t, Seq: 1, Payload: "block"},
+		{Type: LogmsgTypeLog, Timestamp: t.Add(time.Millisecond), Seq: 2, ThreadID: "Main thread", Tag: "network", Level: 2,
+			Filename: "/src/Network.m", LineNumber: 42, FunctionName: "-[Network send:]", Payload: "request sent"},
+		{Type: LogmsgTypeLog, Timestamp: t.Add(2 * time.Millisecond), Seq: 3, Binary: vectorBytes(64)},
+		{Type: LogmsgTypeLog, Timestamp: t.Add(3 * time.Millisecond), Seq: 4, Image: vectorPNG(2, 3), ImageWidth: 2, ImageHeight: 3},
+		{Type: LogmsgTypeMark, Timestamp: t.Add(4 * time.Millisecond), Seq: 5, Payload: "mark"},
+		{Type: LogmsgTypeBlockend, Timestamp: t.Add(5 * time.Millisecond), Seq: 6},
+		{Type: LogmsgTypeDisconnect, Timestamp: t.Add(6 * time.Millisecond), Client: client},
+	}
+	var session bytes.Buffer
+	e := NewEncoder(&session)
+	for _, m := range msgs {
+		e.Encode(m)
+		corpus = append(corpus, encodeMessage(m))
+	}
+	return append(corpus, session.Bytes())
+}
+
+// WriteFuzzCorpus writes the seed corpus of FuzzCorpus to dir, created if
+// needed, one file per input named by the SHA-1 of its content, as go-fuzz
+// names the inputs of its corpus directories.
+func WriteFuzzCorpus(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, b := range FuzzCorpus() {
+		sum := sha1.Sum(b)
+		if err := os.WriteFile(filepath.Join(dir, hex.EncodeToString(sum[:])), b, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package nslogger
+
+import (
+	"regexp"
+)
+
+// Grep selects the messages matching Pattern in their text, tag, file name or
+// function name, along with the Before messages preceding and the After
+// messages following each match, as grep -B and -A do.
+type Grep struct {
+	Pattern       *regexp.Regexp
+	Before, After int
+}
+
+// Match reports whether the text, tag, file name or function name of m
+// matches the pattern of g.
+func (g *Grep) Match(m *Message) bool {
+	return matchFields(g.Pattern, m)
+}
+
+func matchFields(re *regexp.Regexp, m *Message) bool {
+	return re.MatchString(m.Payload) || re.MatchString(m.Tag) ||
+		re.MatchString(m.Filename) || re.MatchString(m.FunctionName)
+}
+
+// WithGrep only outputs the messages selected by g, after the other filters.
+// In text output, a "--" line separates groups of messages that do not follow
+// each other when context is output, and matches are highlighted in colored
+// text output.
+func WithGrep(g Grep) Option {
+	return func(o *ParseOptions) {
+		o.Grep = &g
+	}
+}
+
+// WithHighlight highlights the matches of re in colored text output, without
+// filtering messages.
+func WithHighlight(re *regexp.Regexp) Option {
+	return func(o *ParseOptions) {
+		o.Highlight = re
+	}
+}
+
+/** highlightPattern returns the pattern whose matches are highlighted. */
+func (o *ParseOptions) highlightPattern() *regexp.Regexp {
+	if o.Highlight != nil {
+		return o.Highlight
+	}
+	if o.Grep != nil {
+		return o.Grep.Pattern
+	}
+	return nil
+}
+
+/** highlight highlights the matches of the highlight pattern in the value
+ * of column name, in colored text output. */
+func (o *ParseOptions) highlight(name, value string) string {
+	re := o.highlightPattern()
+	if !o.Color || re == nil {
+		return value
+	}
+	switch name {
+	case "message", "tag", "file", "function":
+		return re.ReplaceAllStringFunc(value, func(s string) string {
+			return colorMatch + s + colorMatchEnd
+		})
+	}
+	return value
+}
+
+/** grepper applies a Grep to a stream of messages. */
+type grepper struct {
+	g       *Grep
+	before  []*Message // messages preceding the next match, at most g.Before
+	after   int        // number of messages still to output after the last match
+	output  bool       // messages were output
+	skipped bool       // messages were dropped since the last message output
+}
+
+/** newGrepper returns the grepper of o, nil if o has no Grep. */
+func (o *ParseOptions) newGrepper() *grepper {
+	if o.Grep == nil {
+		return nil
+	}
+	return &grepper{g: o.Grep}
+}
+
+/** feed returns the messages to output once m is read: m and the messages
+ * preceding it if it matches, m if it follows a match closely enough, and
+ * none otherwise. A nil message in the result stands for the messages
+ * skipped between two groups of messages, when context is output. */
+func (gr *grepper) feed(m *Message) []*Message {
+	if !gr.g.Match(m) {
+		if gr.after > 0 {
+			gr.after--
+			return gr.emit(m)
+		}
+		if gr.g.Before > 0 {
+			if len(gr.before) == gr.g.Before {
+				gr.before = append(gr.before[:0], gr.before[1:]...)
+				gr.skipped = true
+			}
+			gr.before = append(gr.before, m)
+		} else {
+			gr.skipped = true
+		}
+		return nil
+	}
+
+	gr.after = gr.g.After
+	out := gr.emit(gr.before...)
+	gr.before = gr.before[:0]
+	return append(out, gr.emit(m)...)
+}
+
+/** emit returns msgs, preceded by a nil gap marker if messages were skipped
+ * since the last ones output. */
+func (gr *grepper) emit(msgs ...*Message) []*Message {
+	if len(msgs) == 0 {
+		return nil
+	}
+	var out []*Message
+	if gr.skipped && gr.output && (gr.g.Before > 0 || gr.g.After > 0) {
+		out = append(out, nil)
+	}
+	gr.skipped, gr.output = false, true
+	return append(out, msgs...)
+}
@@ -0,0 +1,141 @@
+package nslogger
+
+import (
+	"bufio"
+	"encoding/base64"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+)
+
+/** htmlHead starts HTML reports, up to the opening of their body. */
+const htmlHead = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%TITLE%</title>
+<style>
+body { font: 13px/1.4 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 1em 2em; color: #222; }
+h1 { font-size: 1.4em; }
+h2.client { font-size: 1.1em; margin: 1.5em 0 .5em; padding: .3em .5em; background: #e8eef7; border-left: 4px solid #4a76b8; }
+.disconnect { color: #777; font-style: italic; margin: .5em 0 1em; }
+.msg { display: flex; gap: .8em; padding: 1px 4px; border-bottom: 1px solid #f0f0f0; }
+.msg > span { white-space: nowrap; }
+.time, .thread, .loc { color: #888; font-family: Menlo, Consolas, monospace; font-size: .9em; }
+.tag { color: #2a6d3c; font-weight: bold; }
+.level { min-width: 4.5em; }
+.msg > .text { white-space: pre-wrap; word-break: break-word; flex: 1; font-family: Menlo, Consolas, monospace; }
+.l0 { background: #fdecea; } .l0 .level { color: #c62828; font-weight: bold; }
+.l1 { background: #fff6e0; } .l1 .level { color: #b26a00; font-weight: bold; }
+.l3 .text, .l4 .text { color: #666; }
+.mark { margin: .8em 0; padding: .2em .5em; background: #fff3b0; border: 1px dashed #d4b200; text-align: center; }
+details { margin-left: 1em; border-left: 2px solid #ccd; padding-left: .5em; }
+summary { cursor: pointer; font-weight: bold; color: #446; }
+img { max-width: 100%; border: 1px solid #ddd; }
+</style>
+</head>
+<body>
+`
+
+// WriteHTML writes msgs to w as a standalone HTML report that can be opened
+// in any browser: blocks are collapsible, levels color-coded, images inline
+// and client infos shown as section headers.
+func WriteHTML(w io.Writer, msgs []Message, opts ...Option) error {
+	bw := bufio.NewWriter(w)
+	writeHTMLReport(bw, msgs, newParseOptions(opts))
+	return bw.Flush()
+}
+
+/** writeHTML decodes b and writes its messages as an HTML report. */
+func writeHTML(w *bufio.Writer, b []byte, o *ParseOptions) error {
+	msgs, err := decode(b, o)
+	writeHTMLReport(w, msgs, o)
+	return err
+}
+
+func writeHTMLReport(w *bufio.Writer, msgs []Message, o *ParseOptions) {
+	title := "NSLogger capture"
+	for i := range msgs {
+		if msgs[i].IsClientInfo() && msgs[i].Client != nil {
+			title = msgs[i].Client.String()
+			break
+		}
+	}
+	title = html.EscapeString(title)
+
+	w.WriteString(strings.Replace(htmlHead, "%TITLE%", title, 1))
+	w.WriteString("<h1>" + title + "</h1>\n")
+
+	open := 0
+	for i := range msgs {
+		m := &msgs[i]
+		switch m.Type {
+		case LogmsgTypeBlockstart:
+			w.WriteString("<details open><summary>" + html.EscapeString(m.Payload) + "</summary>\n")
+			open++
+		case LogmsgTypeBlockend:
+			if open > 0 {
+				w.WriteString("</details>\n")
+				open--
+			}
+		case LogmsgTypeClientinfo:
+			w.WriteString(`<h2 class="client">` + html.EscapeString(clientEvent(m)) + " <small>" + o.formatTime(m.Timestamp) + "</small></h2>\n")
+		case LogmsgTypeDisconnect:
+			w.WriteString(`<p class="disconnect">` + html.EscapeString(clientEvent(m)) + "</p>\n")
+		case LogmsgTypeMark:
+			w.WriteString(`<div class="mark">` + html.EscapeString(m.Payload) + " (" + o.formatTime(m.Timestamp) + ")</div>\n")
+		default:
+			o.writeHTMLMessage(w, m)
+		}
+	}
+	for ; open > 0; open-- {
+		w.WriteString("</details>\n")
+	}
+
+	w.WriteString("</body>\n</html>\n")
+}
+
+/** writeHTMLMessage writes a log message as a row of the report. */
+func (o *ParseOptions) writeHTMLMessage(w *bufio.Writer, m *Message) {
+	level := m.LevelName
+	if level == "" {
+		level = o.levelName(m.Level)
+	}
+	if level == "" {
+		level = strconv.Itoa(m.Level)
+	}
+
+	w.WriteString(`<div class="msg l` + strconv.Itoa(m.Level) + `">`)
+	w.WriteString(`<span class="time">` + o.formatTime(m.Timestamp) + `</span>`)
+	w.WriteString(`<span class="thread">` + html.EscapeString(m.ThreadID) + `</span>`)
+	w.WriteString(`<span class="tag">` + html.EscapeString(m.Tag) + `</span>`)
+	w.WriteString(`<span class="level">` + html.EscapeString(level) + `</span>`)
+
+	w.WriteString(`<span class="text">`)
+	switch {
+	case m.Image != nil:
+		w.WriteString(`<img src="data:` + ImageType(m) + `;base64,` + base64.StdEncoding.EncodeToString(m.Image) + `"`)
+		if m.ImageWidth > 0 && m.ImageHeight > 0 {
+			w.WriteString(` width="` + strconv.Itoa(m.ImageWidth) + `" height="` + strconv.Itoa(m.ImageHeight) + `"`)
+		}
+		w.WriteString(` alt="image">`)
+	case m.Binary != nil:
+		w.WriteString(html.EscapeString(o.formatBinary(m.Binary)))
+	default:
+		w.WriteString(html.EscapeString(m.Payload))
+	}
+	w.WriteString(`</span>`)
+
+	if m.Filename != "" || m.FunctionName != "" {
+		loc := m.Filename
+		if m.LineNumber != 0 {
+			loc += ":" + strconv.Itoa(m.LineNumber)
+		}
+		if m.FunctionName != "" {
+			loc += " " + m.FunctionName
+		}
+		w.WriteString(`<span class="loc">` + html.EscapeString(loc) + `</span>`)
+	}
+	w.WriteString("</div>\n")
+}
@@ -0,0 +1,30 @@
+package nslogger
+
+// Hook transforms a decoded message before it is output: it can enrich it,
+// e.g. resolving user IDs, rewrite it, or return nil to drop it. Hooks may
+// modify the message they are passed and return it, or return another one.
+type Hook func(*Message) *Message
+
+// WithHooks runs hooks, in order, on the messages passing the filters and
+// sampling, before they are redacted and output. Hooks of several WithHooks
+// options add up. Like the other options, they run on one message at a time,
+// from the goroutine of each connection of a Listener.
+func WithHooks(hooks ...Hook) Option {
+	return func(o *ParseOptions) {
+		o.Hooks = append(o.Hooks, hooks...)
+	}
+}
+
+/** runHooks runs the hooks of o on m, reporting whether m is kept. */
+func (o *ParseOptions) runHooks(m *Message) bool {
+	for _, hook := range o.Hooks {
+		r := hook(m)
+		if r == nil {
+			return false
+		}
+		if r != m {
+			*m = *r
+		}
+	}
+	return true
+}
@@ -0,0 +1,45 @@
+package nslogger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ImageFilename returns the name under which the image of m is saved,
+// derived from its sequence number and timestamp, with a .png extension, or
+// .jpg for JPEG images.
+func ImageFilename(m *Message) string {
+	ext := ".png"
+	if ImageType(m) == "image/jpeg" {
+		ext = ".jpg"
+	}
+	return fmt.Sprintf("%06d-%s%s", m.Seq, m.Timestamp.UTC().Format("20060102T150405.000000"), ext)
+}
+
+/** imagePath returns the path where the image of m is saved, if it is. */
+func (o *ParseOptions) imagePath(m *Message) string {
+	if o.ImageDir == "" || m.Image == nil {
+		return ""
+	}
+	return filepath.Join(o.ImageDir, ImageFilename(m))
+}
+
+/** saveImage writes the image of m, if any, to dir and returns its path.
+ * Nothing is written if dir is empty. */
+func saveImage(dir string, m *Message) (string, error) {
+	if dir == "" || m.Image == nil {
+		return "", nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, ImageFilename(m))
+	if err := os.WriteFile(path, m.Image, 0644); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
@@ -0,0 +1,300 @@
+package nslogger
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// DefaultIndexInterval is the number of messages between two entries of the
+// indexes built by LoadIndex.
+const DefaultIndexInterval = 100
+
+// IndexFileExt is the extension added to the name of a capture file to name
+// its index file.
+const IndexFileExt = ".nsidx"
+
+// ErrInvalidIndex is returned when reading an index that was not written by
+// Index.WriteTo.
+var ErrInvalidIndex = errors.New("nslogger: invalid index")
+
+/** indexMagic starts the serialized indexes, followed by their version. */
+const indexMagic = "NSLIDX\x01"
+
+// IndexEntry locates a message in a capture.
+type IndexEntry struct {
+	Offset    int64 // offset of the message in the capture, at its size header
+	Seq       int
+	Timestamp time.Time
+}
+
+// Index maps the sequence numbers and timestamps of the messages of a capture
+// to their byte offsets, so that the messages logged around a given time can
+// be decoded without decoding the capture from its start. Indexes are sparse:
+// only the first timestamped message of every Interval messages is indexed.
+type Index struct {
+	Size     int64 // size of the capture indexed, up to its last complete message
+	Messages int64 // number of messages in the capture
+	Interval int
+	Entries  []IndexEntry
+}
+
+// BuildIndex indexes the capture read from r, decoding one message out of
+// every interval. An incomplete message ending r is not indexed, as when the
+// capture is still being written.
+func BuildIndex(r io.Reader, interval int) (*Index, error) {
+	if interval < 1 {
+		interval = 1
+	}
+	ix := &Index{Interval: interval}
+	return ix, ix.index(r)
+}
+
+// Update indexes the messages appended to the capture r of ix since it was
+// indexed, r being read from ix.Size.
+func (ix *Index) Update(r io.ReadSeeker) error {
+	if _, err := r.Seek(ix.Size, io.SeekStart); err != nil {
+		return err
+	}
+	return ix.index(r)
+}
+
+/** index indexes the messages read from r, which follow the last message
+ * indexed. */
+func (ix *Index) index(r io.Reader) error {
+	d := &Decoder{r: bufio.NewReaderSize(r, 64<<10), o: newParseOptions(nil)}
+	want := false // the next timestamped message is indexed
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(d.r, header[:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+		if c := compression(header[:]); ix.Size == 0 && c != "" {
+			return fmt.Errorf("nslogger: cannot index a %s-compressed capture", c)
+		}
+		size := binary.BigEndian.Uint32(header[:])
+
+		if ix.Messages%int64(ix.Interval) == 0 {
+			want = true
+		}
+		if !want {
+			if n, err := io.CopyN(io.Discard, d.r, int64(size)); n < int64(size) {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+		} else {
+			body, err := d.readBody(size)
+			if err != nil {
+				if err == io.EOF || err == io.ErrUnexpectedEOF {
+					return nil
+				}
+				return err
+			}
+			m, _, err := decodeMessage(body, true, d.o)
+			if err != nil {
+				return atOffset(err, ix.Size+4)
+			}
+			if !m.Timestamp.IsZero() {
+				ix.Entries = append(ix.Entries, IndexEntry{Offset: ix.Size, Seq: m.Seq, Timestamp: m.Timestamp})
+				want = false
+			}
+		}
+		ix.Size += 4 + int64(size)
+		ix.Messages++
+	}
+}
+
+// OffsetAt returns the offset from which to decode the capture of ix to read
+// the messages logged from t, those logged shortly before included. Timestamps
+// are expected not to decrease along the capture.
+func (ix *Index) OffsetAt(t time.Time) int64 {
+	return ix.seek(func(e *IndexEntry) bool {
+		return !e.Timestamp.Before(t)
+	})
+}
+
+// OffsetOfSeq returns the offset from which to decode the capture of ix to
+// read the message with sequence number seq, in the first client session
+// reaching it.
+func (ix *Index) OffsetOfSeq(seq int) int64 {
+	return ix.seek(func(e *IndexEntry) bool {
+		return e.Seq != 0 && e.Seq >= seq
+	})
+}
+
+/** seek returns the offset of the last entry preceding the first one for
+ * which reached is true, 0 if none precedes it. */
+func (ix *Index) seek(reached func(e *IndexEntry) bool) int64 {
+	var off int64
+	for i := range ix.Entries {
+		if reached(&ix.Entries[i]) {
+			break
+		}
+		off = ix.Entries[i].Offset
+	}
+	return off
+}
+
+// WriteTo writes ix to w in a compact binary format, as stored in index files.
+func (ix *Index) WriteTo(w io.Writer) (int64, error) {
+	b := []byte(indexMagic)
+	b = binary.AppendUvarint(b, uint64(ix.Size))
+	b = binary.AppendUvarint(b, uint64(ix.Messages))
+	b = binary.AppendUvarint(b, uint64(ix.Interval))
+	b = binary.AppendUvarint(b, uint64(len(ix.Entries)))
+	var prev int64
+	for _, e := range ix.Entries {
+		b = binary.AppendUvarint(b, uint64(e.Offset-prev))
+		b = binary.AppendVarint(b, int64(e.Seq))
+		b = binary.AppendVarint(b, e.Timestamp.UnixNano())
+		prev = e.Offset
+	}
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+// ReadIndex reads an index written by Index.WriteTo.
+func ReadIndex(r io.Reader) (*Index, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(b, []byte(indexMagic)) {
+		return nil, ErrInvalidIndex
+	}
+	b = b[len(indexMagic):]
+
+	var bad bool
+	uvarint := func() uint64 {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			bad = true
+			return 0
+		}
+		b = b[n:]
+		return v
+	}
+	varint := func() int64 {
+		v, n := binary.Varint(b)
+		if n <= 0 {
+			bad = true
+			return 0
+		}
+		b = b[n:]
+		return v
+	}
+
+	ix := &Index{Size: int64(uvarint()), Messages: int64(uvarint()), Interval: int(uvarint())}
+	count := uvarint()
+	if bad || count > uint64(len(b)) {
+		return nil, ErrInvalidIndex
+	}
+	ix.Entries = make([]IndexEntry, 0, count)
+	var off int64
+	for i := uint64(0); i < count; i++ {
+		off += int64(uvarint())
+		seq := varint()
+		ns := varint()
+		if bad {
+			return nil, ErrInvalidIndex
+		}
+		ix.Entries = append(ix.Entries, IndexEntry{Offset: off, Seq: int(seq), Timestamp: time.Unix(0, ns)})
+	}
+	return ix, nil
+}
+
+// LoadIndex returns the index of the named capture file, read from its index
+// file, named after it with IndexFileExt, and updated with the messages
+// appended to the capture since. If there is no index file, or it does not
+// match the capture, the capture is indexed every DefaultIndexInterval
+// messages. The index file is then written, if possible, for the next time.
+func LoadIndex(name string) (*Index, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ix, err := readIndexFile(name + IndexFileExt)
+	if err == nil && ix.matches(f) {
+		size := ix.Size
+		if err := ix.Update(f); err != nil {
+			return nil, err
+		}
+		if ix.Size == size {
+			return ix, nil
+		}
+	} else {
+		if ix, err = BuildIndex(f, DefaultIndexInterval); err != nil {
+			return nil, err
+		}
+	}
+
+	if out, err := os.Create(name + IndexFileExt); err == nil {
+		_, err = ix.WriteTo(out)
+		if cerr := out.Close(); err != nil || cerr != nil {
+			os.Remove(name + IndexFileExt)
+		}
+	}
+	return ix, nil
+}
+
+/** readIndexFile reads the index file name. */
+func readIndexFile(name string) (*Index, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadIndex(bufio.NewReader(f))
+}
+
+/** matches reports whether ix indexes the start of the capture f, the last
+ * message it indexes being found at its offset. */
+func (ix *Index) matches(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil || fi.Size() < ix.Size || ix.Interval < 1 {
+		return false
+	}
+	if len(ix.Entries) == 0 {
+		return ix.Size == 0
+	}
+
+	e := ix.Entries[len(ix.Entries)-1]
+	var header [4]byte
+	if _, err := f.ReadAt(header[:], e.Offset); err != nil {
+		return false
+	}
+	body := make([]byte, binary.BigEndian.Uint32(header[:]))
+	if e.Offset+4+int64(len(body)) > ix.Size {
+		return false
+	}
+	if _, err := f.ReadAt(body, e.Offset+4); err != nil {
+		return false
+	}
+	m, _, err := decodeMessage(body, true, newParseOptions(nil))
+	return err == nil && m.Seq == e.Seq && m.Timestamp.Equal(e.Timestamp)
+}
+
+// NewDecoderAt returns a Decoder reading r from offset, as returned by an
+// Index. The offsets of decoding errors are those of r. Messages preceding
+// offset are not read, so that ClientInfo is nil until the next client info
+// message and messages are not indented by the blocks opened before offset.
+func NewDecoderAt(r io.ReadSeeker, offset int64, opts ...Option) (*Decoder, error) {
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	d := NewDecoder(r, opts...)
+	d.offset = offset
+	return d, nil
+}
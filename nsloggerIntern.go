@@ -0,0 +1,67 @@
+package nslogger
+
+import "sync"
+
+/** Bounds of the string table of a decoding, so that captures of unique
+ * strings do not make it grow without limit: strings longer than
+ * maxInternedLen are not interned, nor new strings once it holds
+ * maxInterned. */
+const (
+	maxInterned    = 1 << 16
+	maxInternedLen = 1024
+)
+
+// WithInterning makes the messages decoded share the storage of their
+// repeated strings: thread names, tags, filenames, function names and client
+// info fields, which repeat across the millions of messages of large
+// captures. It cuts the memory held by the messages of whole captures kept
+// in memory, e.g. in a Store for querying, and the allocations of decoding.
+func WithInterning() Option {
+	return func(o *ParseOptions) {
+		o.Interning = true
+	}
+}
+
+/** stringTable holds the strings of a decoding with Interning, safe for the
+ * concurrent use of parallel decoding. */
+type stringTable struct {
+	mu sync.RWMutex
+	m  map[string]string
+}
+
+func newStringTable() *stringTable {
+	return &stringTable{m: make(map[string]string)}
+}
+
+/** intern returns b as a string, the same one for every b of equal
+ * content. */
+func (t *stringTable) intern(b []byte) string {
+	if len(b) > maxInternedLen {
+		return string(b)
+	}
+	t.mu.RLock()
+	s, ok := t.m[string(b)] // not allocating
+	t.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s, ok := t.m[string(b)]; ok {
+		return s
+	}
+	s = string(b)
+	if len(t.m) < maxInterned {
+		t.m[s] = s
+	}
+	return s
+}
+
+/** partString returns the value of p as a string, interned with Interning. */
+func (o *ParseOptions) partString(p part) string {
+	if o.strings == nil || p.typ != PartTypeString || p.decoded != nil {
+		return p.String()
+	}
+	return o.strings.intern(p.data)
+}
@@ -0,0 +1,43 @@
+package nslogger
+
+import (
+	"io"
+	"iter"
+)
+
+// Messages returns an iterator over the messages decoded from the stream r
+// with opts, as a Decoder decodes them:
+//
+//	for m, err := range nslogger.Messages(f) {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(m.Timestamp, m.Payload)
+//	}
+//
+// A decoding error is yielded with a nil message and ends the iteration. The
+// stream is read as the iteration goes, and only once.
+func Messages(r io.Reader, opts ...Option) iter.Seq2[*Message, error] {
+	return NewDecoder(r, opts...).All()
+}
+
+// All returns an iterator over the remaining messages of d, as returned by
+// Next until io.EOF. An error other than io.EOF is yielded with a nil message
+// and ends the iteration.
+func (d *Decoder) All() iter.Seq2[*Message, error] {
+	return func(yield func(*Message, error) bool) {
+		for {
+			m, err := d.Next()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(m, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package nslogger
+
+import (
+	"encoding/json"
+	"io"
+)
+
+/** writeJSON decodes b and writes each message as a JSON object on its own line. */
+func writeJSON(w io.Writer, b []byte, o *ParseOptions) error {
+	enc := json.NewEncoder(w)
+	return eachMessage(b, o, func(m *Message) error {
+		return enc.Encode(m)
+	})
+}
+
+// WriteNDJSON writes each message received from msgs to w as newline-delimited
+// JSON, until msgs is closed. It returns on the first write error without
+// receiving any further message: the caller must then stop the producer of
+// msgs, e.g. by closing its Listener or exiting, or the producer blocks.
+func WriteNDJSON(w io.Writer, msgs <-chan *Message) error {
+	enc := json.NewEncoder(w)
+	for m := range msgs {
+		if err := enc.Encode(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package nslogger
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// LazyMessage is a message read by Decoder.NextLazy, whose parts are located
+// but decoded only when accessed, so that scanning a large capture for a few
+// messages does not pay the cost of decoding all of them. Its accessors
+// decode the part they return each time they are called; Decode decodes the
+// whole message.
+//
+// A LazyMessage refers to the buffer of its Decoder: it is only valid until
+// the next call to Next or NextLazy, and so are the slices returned by Binary
+// and Image. Decode the messages to keep.
+type LazyMessage struct {
+	body   []byte
+	offset int64 // of body in the stream
+	o      *ParseOptions
+
+	// fields set from the preceding messages of the stream
+	depth    int
+	duration time.Duration
+	lost     int
+
+	// offsets in body of the parts of each protocol key, plus one, 0 for the
+	// keys absent
+	parts [PartKeyUniqueid + 1]uint32
+}
+
+// NextLazy reads the next message of the stream and locates its parts,
+// without decoding them. It returns io.EOF at the end of the stream, and an
+// error for messages whose parts cannot be located, such as truncated ones;
+// parts that cannot be decoded are skipped in lenient mode. The state of the
+// stream is kept as with Next, for LazyMessage.Decode to set the block depth,
+// durations and lost message counts, and sequence anomalies are reported to
+// WithWarnings. Options selecting and transforming messages do not apply,
+// nor do recovery mode and reordering. Next and NextLazy may be called in
+// turn.
+func (d *Decoder) NextLazy() (*LazyMessage, error) {
+	if d.merge != nil {
+		return nil, errors.New("nslogger: lazy decoding of merged captures")
+	}
+	if err := d.o.canceled(); err != nil {
+		return nil, err
+	}
+	offset := d.offset
+	_, body, _, err := d.readFrame(false)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &LazyMessage{body: body, offset: offset + 4, o: d.o}
+	if err := m.locate(); err != nil {
+		return nil, atOffset(err, m.offset)
+	}
+	if err := m.update(&d.state); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+/** update records m in the stream state s, decoding only the parts it
+ * depends on, and keeps the fields of m set from it. */
+func (m *LazyMessage) update(s *streamState) error {
+	stub := Message{Type: m.Type(), Seq: m.Seq()}
+	switch stub.Type {
+	case LogmsgTypeBlockstart, LogmsgTypeBlockend:
+		stub.Timestamp = m.Timestamp()
+	case LogmsgTypeClientinfo:
+		msg, _, err := decodeMessage(m.body, m.o.Lenient, m.o)
+		if err != nil {
+			return atOffset(err, m.offset)
+		}
+		stub.Client = msg.Client
+	}
+	m.o.warned(s.update(&stub), m.offset)
+	m.depth, m.duration, m.lost = stub.Depth, stub.Duration, stub.Lost
+	return nil
+}
+
+/** locate records the offsets of the parts of m, checking that they lie
+ * within its body. */
+func (m *LazyMessage) locate() error {
+	o := m.o
+	if err := need(m.body, 0, 2); err != nil {
+		return err
+	}
+	partCount := o.Quirks.order().Uint16(m.body)
+	if err := o.checkParts(partCount); err != nil {
+		return err
+	}
+
+	n := uint32(2)
+	for ; partCount > 0; partCount-- {
+		if size, ok := m.extent(n); ok {
+			if key := m.body[n]; int(key) < len(m.parts) {
+				m.parts[key] = n + 1
+			}
+			n += 2 + size
+			continue
+		}
+		p, size, err := readPart(m.body, n, o.Quirks)
+		if err != nil {
+			if !o.Lenient || errors.Is(err, ErrTruncatedMessage) {
+				return err
+			}
+			if size, err = declaredPartSize(m.body, n, o.Quirks); err != nil {
+				return err
+			}
+			n += 2 + size
+			continue
+		}
+		if err := o.checkPart(p); err != nil {
+			return &offsetError{offset: int64(n), err: err}
+		}
+		if int(p.key) < len(m.parts) {
+			m.parts[p.key] = n + 1 // the last part of a key wins, as with Decode
+		}
+		n += 2 + size
+	}
+	return nil
+}
+
+/** extent returns the size following the header of the part at n, for
+ * parts of the types of the protocol encoded without quirks, lying within
+ * the body and the limits of m. Other parts are located by readPart, for
+ * their errors. */
+func (m *LazyMessage) extent(n uint32) (uint32, bool) {
+	b := m.body
+	if m.o.Quirks != 0 || need(b, n, 2) != nil {
+		return 0, false
+	}
+	var size uint32
+	switch b[n+1] {
+	case PartTypeInt16:
+		size = 2
+	case PartTypeInt32:
+		size = 4
+	case PartTypeInt64:
+		size = 8
+	case PartTypeString, PartTypeBinary, PartTypeImage:
+		if need(b, n+2, 4) != nil {
+			return 0, false
+		}
+		data := binary.BigEndian.Uint32(b[n+2:])
+		if max := m.o.Limits.MaxPartSize; max > 0 && data > max {
+			return 0, false
+		}
+		size = 4 + min(data, uint32(len(b))) // clamped for the sum not to overflow
+	default:
+		return 0, false
+	}
+	return size, need(b, n+2, size) == nil
+}
+
+/** part returns the part of m with key, located beforehand. */
+func (m *LazyMessage) part(key uint8) (part, bool) {
+	off := m.parts[key]
+	if off == 0 {
+		return part{}, false
+	}
+	p, _, err := readPart(m.body, off-1, m.o.Quirks)
+	return p, err == nil
+}
+
+/** int returns the value of the integer part of m with key, 0 if absent. */
+func (m *LazyMessage) int(key uint8) int {
+	p, _ := m.part(key)
+	return int(p.value)
+}
+
+/** string returns the value of the part of m with key as a string, empty if
+ * absent. */
+func (m *LazyMessage) string(key uint8) string {
+	p, ok := m.part(key)
+	if !ok {
+		return ""
+	}
+	return m.o.partString(p)
+}
+
+// Offset returns the offset of the message in the stream, that of its size
+// header.
+func (m *LazyMessage) Offset() int64 {
+	return m.offset - 4
+}
+
+// Type returns the type of the message, one of the LogmsgType* values.
+func (m *LazyMessage) Type() int { return m.int(PartKeyMessageType) }
+
+// Timestamp returns the time the message was logged at.
+func (m *LazyMessage) Timestamp() time.Time {
+	s, _ := m.part(PartKeyTimestampS)
+	ms, _ := m.part(PartKeyTimestampMs)
+	us, _ := m.part(PartKeyTimestampUs)
+	return time.Unix(s.value, ms.value*int64(time.Millisecond)+us.value*int64(time.Microsecond))
+}
+
+// ThreadID returns the thread the message was logged from.
+func (m *LazyMessage) ThreadID() string { return m.string(PartKeyThreadId) }
+
+// Tag returns the tag of the message.
+func (m *LazyMessage) Tag() string { return m.string(PartKeyTag) }
+
+// Level returns the log level of the message.
+func (m *LazyMessage) Level() int { return m.int(PartKeyLevel) }
+
+// Seq returns the sequence number assigned to the message by its client.
+func (m *LazyMessage) Seq() int { return m.int(PartKeyMessageSeq) }
+
+// Filename returns the source file the message was logged from.
+func (m *LazyMessage) Filename() string { return m.string(PartKeyFilename) }
+
+// LineNumber returns the source line the message was logged from.
+func (m *LazyMessage) LineNumber() int { return m.int(PartKeyLinenumber) }
+
+// FunctionName returns the function the message was logged from.
+func (m *LazyMessage) FunctionName() string { return m.string(PartKeyFunctionname) }
+
+// Message returns the text of the message, empty for binary and image
+// messages.
+func (m *LazyMessage) Message() string {
+	p, ok := m.part(PartKeyMessage)
+	if !ok || p.typ == PartTypeBinary || p.typ == PartTypeImage {
+		return ""
+	}
+	return m.o.partString(p)
+}
+
+// Binary returns the data of binary messages, nil for others.
+func (m *LazyMessage) Binary() []byte {
+	if p, ok := m.part(PartKeyMessage); ok && p.typ == PartTypeBinary {
+		return p.data
+	}
+	return nil
+}
+
+// Image returns the image data of image messages, nil for others.
+func (m *LazyMessage) Image() []byte {
+	if p, ok := m.part(PartKeyMessage); ok && p.typ == PartTypeImage {
+		return p.data
+	}
+	return nil
+}
+
+// Decode decodes all the parts of the message into a Message, which may be
+// kept. As with Next, its level name and the fields set from the preceding
+// messages of the stream, Depth, Duration and Lost, are set; options
+// selecting and transforming messages do not apply.
+func (m *LazyMessage) Decode() (*Message, error) {
+	msg, warnings, err := decodeMessage(m.body, m.o.Lenient, m.o)
+	if err != nil {
+		return nil, atOffset(err, m.offset)
+	}
+	m.o.warned(warnings, m.offset)
+	msg.Depth, msg.Duration, msg.Lost = m.depth, m.duration, m.lost
+	if msg.Type == LogmsgTypeLog {
+		msg.LevelName = m.o.levelName(msg.Level)
+	}
+	return &msg, nil
+}
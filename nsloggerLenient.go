@@ -0,0 +1,25 @@
+package nslogger
+
+// SkippedPart is a message part skipped in lenient mode because it could not
+// be decoded, e.g. because of an unknown type.
+type SkippedPart struct {
+	Offset int64 // byte offset of the part in the input
+	Key    uint8
+	Type   uint8
+	Err    error // error that caused the part to be skipped
+}
+
+/** declaredPartSize returns the size of the part starting at nBytes that
+ * follows its key and type, as declared: the size of registered fixed-size
+ * types, and otherwise the size preceding its data, as for strings. */
+func declaredPartSize(b []byte, nBytes uint32, q Quirks) (uint32, error) {
+	if t, ok := registeredPartType(b[nBytes+1]); ok && t.size > 0 {
+		size := uint32(t.size)
+		return size, need(b, nBytes+2, size)
+	}
+	if err := need(b, nBytes+2, 4); err != nil {
+		return 0, err
+	}
+	size := 4 + min(q.order().Uint32(b[nBytes+2:nBytes+6]), uint32(len(b))) // clamped for the sum not to overflow
+	return size, need(b, nBytes+2, size)
+}
@@ -0,0 +1,48 @@
+package nslogger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Log levels as used by the NSLogger clients. Higher levels are more verbose.
+const (
+	LevelError   = 0
+	LevelWarning = 1
+	LevelInfo    = 2
+	LevelDebug   = 3
+	LevelVerbose = 4
+)
+
+// DefaultLevelNames maps the log levels to the names used by NSLogger clients.
+var DefaultLevelNames = map[int]string{
+	LevelError:   "Error",
+	LevelWarning: "Warning",
+	LevelInfo:    "Info",
+	LevelDebug:   "Debug",
+	LevelVerbose: "Verbose",
+}
+
+// ParseLevel parses a log level given as a number or as one of the names of
+// DefaultLevelNames, case-insensitively, e.g. "3" or "debug".
+func ParseLevel(s string) (int, error) {
+	if level, err := strconv.Atoi(s); err == nil {
+		return level, nil
+	}
+	for level, name := range DefaultLevelNames {
+		if strings.EqualFold(name, s) {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("nslogger: unknown level %q", s)
+}
+
+/** levelName returns the name of level, or an empty string if it has none. */
+func (o *ParseOptions) levelName(level int) string {
+	names := o.LevelNames
+	if names == nil {
+		names = DefaultLevelNames
+	}
+	return names[level]
+}
@@ -0,0 +1,65 @@
+package nslogger
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrLimitExceeded is returned when a message exceeds the limits set with
+// WithLimits.
+var ErrLimitExceeded = errors.New("nslogger: limit exceeded")
+
+// Limits bounds the messages accepted when decoding, so that a corrupt or
+// hostile stream cannot make a decoder allocate unbounded memory. Limits that
+// are zero do not apply, except MaxImagePixels.
+type Limits struct {
+	MaxMessageSize uint32 // maximum size of a message, excluding its 4-byte size header
+	MaxParts       int    // maximum number of parts of a message
+	MaxPartSize    uint32 // maximum size of the data of a part
+	MaxCaptureSize int64  // maximum size of a compressed capture decoded from memory, once decompressed
+	MaxImagePixels int64  // maximum width × height of the images decoded for WithImageConversion, DefaultMaxImagePixels if 0; larger ones are left as they are
+}
+
+// DefaultListenerLimits are the limits of the messages received by a
+// Listener, unless other limits are set with WithLimits in its Options. They
+// are generous for logs, screenshots included.
+var DefaultListenerLimits = Limits{
+	MaxMessageSize: 64 << 20,
+	MaxParts:       1024,
+	MaxPartSize:    64 << 20,
+}
+
+// WithLimits rejects the messages exceeding l with an error wrapping
+// ErrLimitExceeded, before their body is read. In recovery mode, they are
+// skipped as corrupt.
+func WithLimits(l Limits) Option {
+	return func(o *ParseOptions) {
+		o.Limits = l
+	}
+}
+
+/** checkMessageSize returns an ErrLimitExceeded error if a message of size
+ * bytes exceeds the limits of o. */
+func (o *ParseOptions) checkMessageSize(size uint32) error {
+	if max := o.Limits.MaxMessageSize; max > 0 && size > max {
+		return fmt.Errorf("%w: message of %d bytes, the maximum being %d", ErrLimitExceeded, size, max)
+	}
+	return nil
+}
+
+/** checkParts returns an ErrLimitExceeded error if a message of n parts
+ * exceeds the limits of o. */
+func (o *ParseOptions) checkParts(n uint16) error {
+	if max := o.Limits.MaxParts; max > 0 && int(n) > max {
+		return fmt.Errorf("%w: message of %d parts, the maximum being %d", ErrLimitExceeded, n, max)
+	}
+	return nil
+}
+
+/** checkPart returns an ErrLimitExceeded error if p exceeds the limits of o. */
+func (o *ParseOptions) checkPart(p part) error {
+	if max := o.Limits.MaxPartSize; max > 0 && uint64(len(p.data)) > uint64(max) {
+		return fmt.Errorf("%w: part key %d of %d bytes, the maximum being %d", ErrLimitExceeded, p.key, len(p.data), max)
+	}
+	return nil
+}
@@ -0,0 +1,448 @@
+package nslogger
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultListenerAddr is the address used when Listener.Addr is empty. 50000 is
+// the port the NSLogger desktop viewer listens on by default.
+const DefaultListenerAddr = ":50000"
+
+// ErrListenerClosed is returned by Listener.Serve after a call to Close.
+var ErrListenerClosed = errors.New("nslogger: listener closed")
+
+// Listener accepts connections from NSLogger clients (iOS, macOS or any
+// other implementation of the protocol) and decodes their messages as they
+// arrive, acting as a headless NSLogger viewer.
+type Listener struct {
+	Addr string // TCP address to listen on, DefaultListenerAddr if empty
+
+	// Handler is called for every decoded message, and with a
+	// LogmsgTypeDisconnect message when a client goes away. It is called
+	// concurrently from the goroutines serving each connection. Messages have
+	// their SessionID and Client set to tell connections apart. With
+	// WithMessagePool in Options, handlers release the messages once handled,
+	// SessionHandler doing so if both are set.
+	Handler func(*Message)
+
+	// SessionHandler, if set, is called in its own goroutine for every new
+	// connection. It must consume the Messages channel of the session, the
+	// connection being paused while it does not.
+	SessionHandler func(*Session)
+
+	// TLSConfig enables TLS on accepted connections when set. NSLogger clients
+	// connect over SSL unless configured otherwise. Clients are authenticated
+	// by certificate when it requires client certificates, as those returned
+	// by MutualTLSConfig do.
+	TLSConfig *tls.Config
+
+	// Auth, if set, rejects the connections of clients not sending one of its
+	// tokens. Rejected connections, including those failing client
+	// certificate verification, are logged to ErrorLog and closed.
+	Auth *ListenerAuth
+
+	// Bonjour advertises the listener on the local network while serving, so
+	// clients find it automatically. BonjourName is the advertised instance
+	// name, the host name if empty.
+	Bonjour     bool
+	BonjourName string
+
+	// Recorder, if set, records the frames of every message received,
+	// whether or not Options filter them out. It is not closed by Close. Set
+	// it before serving, or call StartRecording and StopRecording.
+	Recorder *Recorder
+
+	// StitchSessions merges the connections of a client identified by its
+	// UniqueID into one logical session: the messages of its reconnections
+	// have the SessionID of its first connection, its client info message is
+	// not delivered again, and the messages it resends after reconnecting,
+	// received already, are dropped. A disconnect message is still delivered
+	// when each connection closes.
+	StitchSessions bool
+
+	// StitchTimeout is the time after which a client whose connections all
+	// closed is forgotten, its next connection starting a new session,
+	// DefaultStitchTimeout if 0.
+	StitchTimeout time.Duration
+
+	// UDPTimeout is the time after which a client sending datagrams to
+	// ServeUDP, having sent none, is disconnected, DefaultUDPTimeout if 0.
+	UDPTimeout time.Duration
+
+	// UDPMaxClients is the number of clients served at once by ServeUDP,
+	// DefaultUDPMaxClients if 0. The datagrams of other clients are dropped
+	// until clients time out.
+	UDPMaxClients int
+
+	// UDPMaxQueuedBytes bounds the size of the datagrams received by ServeUDP
+	// waiting to be decoded, all clients together, DefaultUDPMaxQueuedBytes if
+	// 0. Datagrams received beyond it are dropped.
+	UDPMaxQueuedBytes int64
+
+	// WebSocketOrigins are the origins of the pages allowed to open sessions
+	// with WebSocketHandler, such as "https://app.example.com", wildcards
+	// matching as in path.Match, and "*" allowing any. If empty, only pages of
+	// the host the handler is served on are. Clients sending no Origin
+	// header, which are not browsers, are always allowed.
+	WebSocketOrigins []string
+
+	// FlowControl bounds the resources each connection takes.
+	FlowControl FlowControl
+
+	Options  []Option    // options applied to each connection decoder, after WithLimits(DefaultListenerLimits)
+	ErrorLog *log.Logger // logs connection errors, discarded if nil
+
+	mu     sync.Mutex
+	ln     net.Listener
+	pc     net.PacketConn // with ServeUDP
+	adv    *Advertiser
+	closed bool
+	wg     sync.WaitGroup
+
+	sessions map[uint64]*Session
+	lastID   uint64
+	messages int64     // messages received by all sessions
+	rate     rateMeter // of messages received by all sessions
+	metrics  listenerMetrics
+	stitched map[string]*stitchedClient // clients by UniqueID, with StitchSessions
+
+	onShutdown []func() error // registered with RegisterOnShutdown
+}
+
+// ListenerStats are the message counts of a Listener.
+type ListenerStats struct {
+	Clients  int     `json:"clients"`  // number of connected clients
+	Messages int64   `json:"messages"` // number of messages received since the listener started
+	Rate     float64 `json:"rate"`     // messages received per second over the last RateWindow
+}
+
+// ChannelHandler returns a Listener handler delivering messages to ch.
+func ChannelHandler(ch chan<- *Message) func(*Message) {
+	return func(m *Message) {
+		ch <- m
+	}
+}
+
+// ListenAndServe listens on l.Addr and serves incoming client connections.
+func (l *Listener) ListenAndServe() error {
+	addr := l.Addr
+	if addr == "" {
+		addr = DefaultListenerAddr
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return l.Serve(ln)
+}
+
+// Serve accepts client connections on ln, handling each one in its own
+// goroutine. Connections are wrapped in TLS if l.TLSConfig is set. It always
+// returns a non-nil error; after Close it returns ErrListenerClosed.
+func (l *Listener) Serve(ln net.Listener) error {
+	if l.TLSConfig != nil {
+		ln = tls.NewListener(ln, l.TLSConfig)
+	}
+
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		ln.Close()
+		return ErrListenerClosed
+	}
+	l.ln = ln
+	l.mu.Unlock()
+
+	if l.Bonjour {
+		port := 0
+		if addr, ok := ln.Addr().(*net.TCPAddr); ok {
+			port = addr.Port
+		}
+		adv, err := Advertise(l.BonjourName, port, l.TLSConfig != nil)
+		if err != nil {
+			ln.Close()
+			return err
+		}
+		l.mu.Lock()
+		l.adv = adv
+		l.mu.Unlock()
+	}
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if l.isClosed() {
+				return ErrListenerClosed
+			}
+			return err
+		}
+
+		s := l.newSession(conn)
+		if s == nil {
+			conn.Close()
+			return ErrListenerClosed
+		}
+		go l.serveSession(s)
+	}
+}
+
+// NetAddr returns the address the listener accepts connections on, or nil if it
+// is not serving yet.
+func (l *Listener) NetAddr() net.Addr {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ln == nil {
+		return nil
+	}
+	return l.ln.Addr()
+}
+
+// Close stops accepting connections, closes the active ones and waits for
+// their handlers to return.
+func (l *Listener) Close() error {
+	l.mu.Lock()
+	l.closed = true
+	var err error
+	if l.ln != nil {
+		err = l.ln.Close()
+	}
+	if l.pc != nil {
+		if perr := l.pc.Close(); err == nil {
+			err = perr
+		}
+	}
+	if l.adv != nil {
+		l.adv.Close()
+	}
+	for _, s := range l.sessions {
+		s.conn.Close()
+	}
+	l.mu.Unlock()
+
+	l.wg.Wait()
+	return err
+}
+
+// Stats returns the message counts of the listener.
+func (l *Listener) Stats() ListenerStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return ListenerStats{Clients: len(l.sessions), Messages: l.messages, Rate: l.rate.rate(time.Now())}
+}
+
+// StartRecording starts recording the messages received to the file name, or
+// files named after it, as a Recorder created with NewRecorder does. The files
+// start with the client info messages of the clients already connected.
+func (l *Listener) StartRecording(name string, opts RecordOptions) (*Recorder, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.Recorder != nil {
+		return nil, errors.New("nslogger: already recording")
+	}
+
+	clients := make(map[uint64][]byte)
+	for id, s := range l.sessions {
+		s.mu.Lock()
+		if s.clientFrame != nil {
+			clients[id] = append([]byte(nil), s.clientFrame...)
+		}
+		s.mu.Unlock()
+	}
+	r, err := newRecorder(name, opts, clients)
+	if err != nil {
+		return nil, err
+	}
+	l.Recorder = r
+	return r, nil
+}
+
+// StopRecording stops recording and closes the Recorder of the listener, if
+// any.
+func (l *Listener) StopRecording() error {
+	l.mu.Lock()
+	r := l.Recorder
+	l.Recorder = nil
+	l.mu.Unlock()
+	if r == nil {
+		return nil
+	}
+	return r.Close()
+}
+
+/** recorder returns the Recorder of the listener, if recording. */
+func (l *Listener) recorder() *Recorder {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.Recorder
+}
+
+// Sessions returns the active client sessions, in connection order.
+func (l *Listener) Sessions() []*Session {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sessions := make([]*Session, 0, len(l.sessions))
+	for _, s := range l.sessions {
+		sessions = append(sessions, s)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+	return sessions
+}
+
+/** newSession registers a session for conn, or returns nil if the listener
+ * is closed. */
+func (l *Listener) newSession(conn net.Conn) *Session {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+
+	l.lastID++
+	l.metrics.connections++
+	s := &Session{ID: l.lastID, RemoteAddr: conn.RemoteAddr(), Start: time.Now(), conn: conn}
+	if l.SessionHandler != nil {
+		s.ch = make(chan *Message, 64)
+		s.Messages = s.ch
+	}
+	if l.sessions == nil {
+		l.sessions = make(map[uint64]*Session)
+	}
+	l.sessions[s.ID] = s
+	l.wg.Add(1)
+
+	return s
+}
+
+func (l *Listener) serveSession(s *Session) {
+	defer l.wg.Done()
+	defer func() {
+		l.mu.Lock()
+		delete(l.sessions, s.ID)
+		if s.stitched != nil {
+			s.stitched.leave(time.Now())
+		}
+		l.mu.Unlock()
+	}()
+	defer s.conn.Close()
+
+	opts := append([]Option{WithLimits(DefaultListenerLimits)}, l.Options...)
+	r, err := l.authenticate(s, newParseOptions(opts))
+	if err != nil {
+		l.logf("nslogger: rejected connection from %v: %v", s.RemoteAddr, err)
+		l.mu.Lock()
+		l.metrics.rejected++
+		l.mu.Unlock()
+		return
+	}
+
+	if err := l.FlowControl.setReadBuffer(s.conn); err != nil {
+		l.logf("nslogger: connection from %v: %v", s.RemoteAddr, err)
+	}
+
+	if s.ch != nil {
+		defer close(s.ch)
+		go l.SessionHandler(s)
+	}
+	deliver, wait := l.deliverer(s)
+	defer wait()
+
+	d := NewDecoder(l.throttle(r), opts...)
+	defer func() {
+		if r := l.recorder(); r != nil {
+			r.forget(s.ID)
+		}
+	}()
+	d.record = func(header, body []byte, m *Message) {
+		if m.Type == LogmsgTypeClientinfo {
+			s.setClientFrame(header, body)
+		}
+		now := time.Now()
+		s.received(now)
+		l.mu.Lock()
+		r := l.Recorder
+		l.messages++
+		l.rate.add(now)
+		l.metrics.received(m, len(header)+len(body))
+		l.mu.Unlock()
+		if r != nil {
+			r.record(s.ID, header, body, m)
+		}
+	}
+	for {
+		m, err := d.Next()
+		if err != nil && s.packets && isDecodeError(err) {
+			// The datagrams of UDP sessions are standalone messages
+			l.logf("nslogger: datagram from %v: %v", s.RemoteAddr, err)
+			l.droppedDatagram()
+			continue
+		}
+		if err != nil {
+			if err != io.EOF && !l.isClosed() {
+				l.logf("nslogger: connection from %v: %v", s.RemoteAddr, err)
+			}
+			if isDecodeError(err) {
+				l.mu.Lock()
+				l.metrics.decodeErrors++
+				l.mu.Unlock()
+			}
+			deliver(&Message{
+				Type:      LogmsgTypeDisconnect,
+				Timestamp: time.Now(),
+				Client:    s.ClientInfo(),
+				Duration:  time.Since(s.Start),
+			})
+			return
+		}
+
+		if m.IsClientInfo() {
+			s.setClientInfo(m.Client)
+			if l.StitchSessions {
+				var reconnected bool
+				if s.stitched, reconnected = l.stitch(s, m.Client); reconnected {
+					d.o.release(m) // not delivered
+					continue
+				}
+			}
+		} else if m.Client == nil {
+			m.Client = s.ClientInfo()
+		}
+		if s.stitched != nil && l.resent(s.stitched, m) {
+			d.o.release(m) // not delivered
+			continue
+		}
+		s.addThread(m)
+		deliver(m)
+	}
+}
+
+/** deliver passes m, its SessionID set, to the handlers of l. */
+func (l *Listener) deliver(s *Session, m *Message) {
+	if l.Handler != nil {
+		l.Handler(m)
+	}
+	if s.ch != nil {
+		s.ch <- m
+	}
+}
+
+func (l *Listener) isClosed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closed
+}
+
+func (l *Listener) logf(format string, args ...interface{}) {
+	if l.ErrorLog != nil {
+		l.ErrorLog.Printf(format, args...)
+	}
+}
@@ -0,0 +1,70 @@
+package nslogger
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// LogfmtColumns are the default columns of logfmt output, output as
+// time=... level=... tag=... thread=... msg=... file=... line=... func=...
+// Timestamps are in RFC 3339 format unless a layout is set with WithTimeLayout.
+var LogfmtColumns = []string{"time", "levelName", "tag", "thread", "message", "file", "line", "function"}
+
+/** logfmtKeys are the logfmt keys of the columns named differently. */
+var logfmtKeys = map[string]string{
+	"levelName": "level",
+	"message":   "msg",
+	"function":  "func",
+}
+
+/** formatLogfmt formats m as a logfmt line, without the columns for which m
+ * has no value. */
+func (o *ParseOptions) formatLogfmt(m *Message) string {
+	var b strings.Builder
+	for _, name := range o.columns(LogfmtColumns) {
+		value := o.field(m, name)
+		if name == "time" && o.TimeLayout == "" {
+			value = m.Timestamp.Format(time.RFC3339Nano)
+		}
+		if name == "levelName" && value == "" && m.Type == LogmsgTypeLog {
+			value = strconv.Itoa(m.Level)
+		}
+		if value == "" {
+			continue
+		}
+
+		key := name
+		if k, ok := logfmtKeys[name]; ok {
+			key = k
+		}
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(logfmtValue(value))
+	}
+	return b.String()
+}
+
+/** logfmtValue quotes s if it holds spaces, quotes, equal signs or control
+ * characters. */
+func logfmtValue(s string) string {
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError || r == 0x7f {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
+
+/** writeLogfmt decodes b and writes each message as a logfmt line. */
+func writeLogfmt(w io.Writer, b []byte, o *ParseOptions) error {
+	return eachMessage(b, o, func(m *Message) error {
+		_, err := io.WriteString(w, o.formatLogfmt(m)+"\n")
+		return err
+	})
+}
@@ -0,0 +1,230 @@
+package nslogger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the LokiPusher batching settings.
+const (
+	DefaultLokiBatchSize = 500
+	DefaultLokiBatchWait = time.Second
+)
+
+/** lokiLineColumns are the message fields in the log lines pushed to Loki,
+ * the others being labels. */
+var lokiLineColumns = []string{"thread", "message", "file", "line", "function"}
+
+// LokiPusher batches messages and pushes them to the HTTP push API of Grafana
+// Loki, so device logs show up in Grafana next to backend logs. Each message
+// is labeled with its tag, level, client name and device ID, when known, and
+// its other fields are pushed as a logfmt line.
+//
+// Its Handle method is meant to be used as a Listener handler:
+//
+//	p := &nslogger.LokiPusher{URL: "http://localhost:3100/loki/api/v1/push"}
+//	l := &nslogger.Listener{Handler: p.Handle}
+type LokiPusher struct {
+	URL      string            // push endpoint, e.g. http://localhost:3100/loki/api/v1/push
+	TenantID string            // sent as X-Scope-OrgID to multi-tenant Loki servers, if set
+	Labels   map[string]string // static labels of every message, e.g. {"job": "ios"}
+
+	BatchSize int           // messages pushed at once, DefaultLokiBatchSize if 0
+	BatchWait time.Duration // longest time a message waits to be pushed, DefaultLokiBatchWait if 0
+
+	Client   *http.Client // http.DefaultClient if nil
+	ErrorLog *log.Logger  // logs push errors of Handle, discarded if nil
+
+	mu    sync.Mutex
+	batch []lokiEntry
+	timer *time.Timer
+}
+
+/** lokiEntry is a message ready to be pushed. */
+type lokiEntry struct {
+	labels map[string]string
+	time   time.Time
+	line   string
+}
+
+// Handle adds m to the current batch, pushing the batch once it is full.
+// Errors are logged to ErrorLog.
+func (p *LokiPusher) Handle(m *Message) {
+	e := p.entry(m)
+
+	p.mu.Lock()
+	p.batch = append(p.batch, e)
+	var batch []lokiEntry
+	if len(p.batch) >= p.batchSize() {
+		batch = p.take()
+	} else if p.timer == nil {
+		p.timer = time.AfterFunc(p.batchWait(), func() {
+			if err := p.Flush(); err != nil {
+				p.logf("loki: %v", err)
+			}
+		})
+	}
+	p.mu.Unlock()
+
+	if batch != nil {
+		if err := p.push(batch); err != nil {
+			p.logf("loki: %v", err)
+		}
+	}
+}
+
+// Flush pushes the messages of the current batch.
+func (p *LokiPusher) Flush() error {
+	p.mu.Lock()
+	batch := p.take()
+	p.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+	return p.push(batch)
+}
+
+// Close pushes the remaining messages, once the handler is no longer called.
+func (p *LokiPusher) Close() error {
+	return p.Flush()
+}
+
+/** take empties the current batch and returns its messages, with p.mu held. */
+func (p *LokiPusher) take() []lokiEntry {
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	batch := p.batch
+	p.batch = nil
+	return batch
+}
+
+func (p *LokiPusher) batchSize() int {
+	if p.BatchSize > 0 {
+		return p.BatchSize
+	}
+	return DefaultLokiBatchSize
+}
+
+func (p *LokiPusher) batchWait() time.Duration {
+	if p.BatchWait > 0 {
+		return p.BatchWait
+	}
+	return DefaultLokiBatchWait
+}
+
+/** entry returns the labels and line of m. */
+func (p *LokiPusher) entry(m *Message) lokiEntry {
+	labels := make(map[string]string, len(p.Labels)+4)
+	for k, v := range p.Labels {
+		labels[k] = v
+	}
+	if m.Tag != "" {
+		labels["tag"] = m.Tag
+	}
+	if m.Type == LogmsgTypeLog {
+		level := m.LevelName
+		if level == "" {
+			level = strconv.Itoa(m.Level)
+		}
+		labels["level"] = level
+	}
+	if m.Client != nil {
+		if m.Client.Name != "" {
+			labels["client"] = m.Client.Name
+		}
+		if m.Client.UniqueID != "" {
+			labels["device"] = m.Client.UniqueID
+		}
+	}
+
+	o := &ParseOptions{Columns: lokiLineColumns}
+	return lokiEntry{labels: labels, time: m.Timestamp, line: o.formatLogfmt(m)}
+}
+
+/** lokiStream is a stream of the push API request body. */
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+/** push sends batch to Loki, grouping its messages in streams by labels. */
+func (p *LokiPusher) push(batch []lokiEntry) error {
+	var streams []*lokiStream
+	byLabels := make(map[string]*lokiStream)
+	for _, e := range batch {
+		key := lokiLabelsKey(e.labels)
+		s := byLabels[key]
+		if s == nil {
+			s = &lokiStream{Stream: e.labels}
+			byLabels[key] = s
+			streams = append(streams, s)
+		}
+		s.Values = append(s.Values, [2]string{strconv.FormatInt(e.time.UnixNano(), 10), e.line})
+	}
+
+	body, err := json.Marshal(map[string][]*lokiStream{"streams": streams})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", p.TenantID)
+	}
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("push of %d messages failed: %s: %s", len(batch), resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+/** lokiLabelsKey returns a string identifying the set of labels. */
+func lokiLabelsKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(strconv.Quote(k))
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[k]))
+		b.WriteByte(',')
+	}
+	return b.String()
+}
+
+func (p *LokiPusher) logf(format string, args ...interface{}) {
+	if p.ErrorLog != nil {
+		p.ErrorLog.Printf(format, args...)
+	}
+}
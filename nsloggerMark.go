@@ -0,0 +1,117 @@
+package nslogger
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Mark is a mark placed by the user in the log flow, usually to annotate an
+// interesting moment of a capture.
+type Mark struct {
+	Label     string
+	Timestamp time.Time
+}
+
+// IsMark reports whether m is a LogmsgTypeMark message.
+func (m *Message) IsMark() bool {
+	return m.Type == LogmsgTypeMark
+}
+
+// Mark returns the mark m stands for, if it is a mark message.
+func (m *Message) Mark() (Mark, bool) {
+	if !m.IsMark() {
+		return Mark{}, false
+	}
+	return Mark{Label: m.Payload, Timestamp: m.Timestamp}, true
+}
+
+// Marks returns the marks found in msgs, in order.
+func Marks(msgs []Message) []Mark {
+	var marks []Mark
+	for i := range msgs {
+		if mark, ok := msgs[i].Mark(); ok {
+			marks = append(marks, mark)
+		}
+	}
+	return marks
+}
+
+/** markDivider returns the divider line standing for mark in text output. */
+func (o *ParseOptions) markDivider(mark Mark) string {
+	return "---------- " + mark.Label + " (" + o.formatTime(mark.Timestamp) + ") ----------"
+}
+
+// ErrMarkNotFound is returned by SliceByMarks when a mark is missing.
+var ErrMarkNotFound = errors.New("nslogger: mark not found")
+
+// WithMarkRange keeps only the messages between the marks labeled from and
+// to, the marks included, since marks are how testers annotate the region of
+// interest of a manual test session. An empty from starts at the beginning of
+// the capture, and an empty to ends at its end. Every from mark opens a new
+// region. Client info messages are kept wherever they are, for the messages
+// that follow to have a client.
+func WithMarkRange(from, to string) Option {
+	return func(o *ParseOptions) {
+		o.MarkRange = &MarkRange{From: from, To: to}
+		o.inMarkRange = from == ""
+	}
+}
+
+// MarkRange is the region of a capture between two marks, see WithMarkRange.
+type MarkRange struct {
+	From, To string // labels of the marks, empty for the start and end of the capture
+}
+
+/** sliceMarks reports whether m is in the mark range of o. */
+func (o *ParseOptions) sliceMarks(m *Message) bool {
+	r := o.MarkRange
+	if r == nil || m.IsClientInfo() {
+		return true
+	}
+	if mark, ok := m.Mark(); ok {
+		if !o.inMarkRange && mark.Label == r.From {
+			o.inMarkRange = true
+			return true
+		}
+		if o.inMarkRange && r.To != "" && mark.Label == r.To {
+			o.inMarkRange = false
+			return true
+		}
+	}
+	return o.inMarkRange
+}
+
+// SliceByMarks returns the messages of msgs between the first mark labeled
+// from and the following mark labeled to, the marks included. Unlike
+// WithMarkRange, it returns the first region only, without the client info
+// messages preceding it. It returns an error wrapping ErrMarkNotFound if either
+// mark is missing.
+func SliceByMarks(msgs []Message, from, to string) ([]Message, error) {
+	start, end := 0, len(msgs)
+	if from != "" {
+		start = markIndex(msgs, 0, from)
+		if start < 0 {
+			return nil, fmt.Errorf("%w: %q", ErrMarkNotFound, from)
+		}
+	}
+	if to != "" {
+		end = markIndex(msgs, start, to)
+		if end < 0 {
+			return nil, fmt.Errorf("%w: %q after %q", ErrMarkNotFound, to, from)
+		}
+		end++
+	}
+	return msgs[start:end], nil
+}
+
+/** markIndex returns the index of the first mark labeled label in msgs from
+ * index i, -1 if there is none. */
+func markIndex(msgs []Message, i int, label string) int {
+	for ; i < len(msgs); i++ {
+		if mark, ok := msgs[i].Mark(); ok && mark.Label == label {
+			return i
+		}
+	}
+	return -1
+}
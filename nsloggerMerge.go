@@ -0,0 +1,73 @@
+package nslogger
+
+import (
+	"io"
+	"path/filepath"
+	"strconv"
+)
+
+/** merger interleaves the messages of several decoders by timestamp. */
+type merger struct {
+	decoders []*Decoder
+	labels   []string
+	heads    []*Message // next message of each decoder, nil once it is exhausted
+}
+
+// Merge returns a Decoder interleaving the messages of several captures, e.g.
+// recorded from different devices during the same test run, into a single
+// timeline ordered by timestamp. Each capture is expected to be in timestamp
+// order, as written by clients. Messages have their Source set to the base
+// name of the file they come from, or to the position of their reader in
+// readers (starting at 1) for readers other than files.
+func Merge(readers ...io.Reader) (*Decoder, error) {
+	mg := &merger{heads: make([]*Message, len(readers))}
+	for i, r := range readers {
+		label := strconv.Itoa(i + 1)
+		if f, ok := r.(interface{ Name() string }); ok {
+			label = filepath.Base(f.Name())
+		}
+		mg.decoders = append(mg.decoders, NewDecoder(r))
+		mg.labels = append(mg.labels, label)
+		if err := mg.advance(i); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Decoder{o: newParseOptions(nil), merge: mg}, nil
+}
+
+/** advance reads the next message of decoder i. */
+func (mg *merger) advance(i int) error {
+	m, err := mg.decoders[i].Next()
+	if err == io.EOF {
+		mg.heads[i] = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	m.Source = mg.labels[i]
+	mg.heads[i] = m
+	return nil
+}
+
+/** next returns the earliest message of all decoders, or io.EOF once they
+ * are all exhausted. Messages with the same timestamp are returned in the
+ * order of the decoders. */
+func (mg *merger) next() (*Message, error) {
+	first := -1
+	for i, m := range mg.heads {
+		if m != nil && (first < 0 || m.Timestamp.Before(mg.heads[first].Timestamp)) {
+			first = i
+		}
+	}
+	if first < 0 {
+		return nil, io.EOF
+	}
+
+	m := mg.heads[first]
+	if err := mg.advance(first); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -1,38 +1,128 @@
 package nslogger
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
+// Message is a decoded NSLogger log entry with its parts stored in typed fields.
+type Message struct {
+	Type         int                    `json:"type"` // one of the LogmsgType* values
+	Timestamp    time.Time              `json:"timestamp"`
+	ThreadID     string                 `json:"thread,omitempty"`
+	Tag          string                 `json:"tag,omitempty"`
+	Level        int                    `json:"level"`
+	LevelName    string                 `json:"levelName,omitempty"` // symbolic name of Level, see WithLevelNames
+	Seq          int                    `json:"seq"`                 // sequence number assigned by the client
+	Lost         int                    `json:"lost,omitempty"`      // number of messages missing before this one, from a gap in sequence numbers
+	Repeated     int                    `json:"repeated,omitempty"`  // number of identical messages following this one collapsed into it, see WithCollapse
+	Filename     string                 `json:"file,omitempty"`
+	LineNumber   int                    `json:"line,omitempty"`
+	FunctionName string                 `json:"function,omitempty"`
+	Payload      string                 `json:"message,omitempty"` // message text
+	Binary       []byte                 `json:"binary,omitempty"`  // message data, for binary messages
+	Image        []byte                 `json:"image,omitempty"`   // PNG data, for image messages
+	ImageWidth   int                    `json:"imageWidth,omitempty"`
+	ImageHeight  int                    `json:"imageHeight,omitempty"`
+	Client       *ClientInfo            `json:"client,omitempty"`   // set on client info and disconnect messages, and by Listener
+	SessionID    uint64                 `json:"session,omitempty"`  // Listener connection the message was received on
+	Depth        int                    `json:"depth,omitempty"`    // number of enclosing blocks
+	Duration     time.Duration          `json:"duration,omitempty"` // session duration, for disconnect messages, or block duration, for block ends
+	Source       string                 `json:"source,omitempty"`   // label of the capture the message comes from, set by Merge
+	Elapsed      time.Duration          `json:"elapsed,omitempty"`  // time since the start of the capture, see WithRelativeTimes
+	Delta        time.Duration          `json:"delta,omitempty"`    // time since the previous message output, see WithRelativeTimes
+	Extra        map[string]interface{} `json:"extra,omitempty"`    // user-defined parts, see RegisterPartKey
+}
+
+// ClientInfo describes the client application that produced the messages.
+type ClientInfo struct {
+	Name      string `json:"name,omitempty"`
+	Version   string `json:"version,omitempty"`
+	OSName    string `json:"osName,omitempty"`
+	OSVersion string `json:"osVersion,omitempty"`
+	Model     string `json:"model,omitempty"` // device model, e.g. iPhone or iPad
+	UniqueID  string `json:"uniqueId,omitempty"`
+}
+
+// String summarizes c on a single line, e.g. "MyApp 1.2 (iOS 17.0, iPhone) ABC-123".
+func (c *ClientInfo) String() string {
+	s := strings.TrimSpace(c.Name + " " + c.Version)
+	var system []string
+	if osName := strings.TrimSpace(c.OSName + " " + c.OSVersion); osName != "" {
+		system = append(system, osName)
+	}
+	if c.Model != "" {
+		system = append(system, c.Model)
+	}
+	if len(system) > 0 {
+		s += " (" + strings.Join(system, ", ") + ")"
+	}
+	if c.UniqueID != "" {
+		s += " " + c.UniqueID
+	}
+	return strings.TrimSpace(s)
+}
 
-type logMessage interface {
-	addString(value string)
-	addInt16(value int16)
-	addInt32(value int32)
-	addInt64(value int64)
+// IsClientInfo reports whether m is a LogmsgTypeClientinfo message, in which
+// case m.Client describes the client that produced the following messages.
+func (m *Message) IsClientInfo() bool {
+	return m.Type == LogmsgTypeClientinfo
 }
 
+// IsDisconnect reports whether m is a LogmsgTypeDisconnect message, marking
+// the end of a client session. m.Client then describes the client that went
+// away, if it sent its info, and m.Duration how long the session lasted.
+func (m *Message) IsDisconnect() bool {
+	return m.Type == LogmsgTypeDisconnect
+}
+
+/** clientEvent describes a client info or disconnect message in text output. */
+func clientEvent(m *Message) string {
+	var s string
+	if m.IsDisconnect() {
+		s = "Client disconnected"
+	} else {
+		s = "Client info"
+	}
+	if m.Client != nil {
+		s += ": " + m.Client.String()
+	}
+	if m.Duration != 0 {
+		s += fmt.Sprintf(" after %v", m.Duration.Round(time.Millisecond))
+	}
+	return s
+}
+
+func (m *Message) clientInfo() *ClientInfo {
+	if m.Client == nil {
+		m.Client = &ClientInfo{}
+	}
+	return m.Client
+}
+
+/** logMessageString builds a line of text output, each field followed by
+ * the separator. */
 type logMessageString struct {
-	value     string
+	buf       []byte
 	separator string
+	indent    string // prefix showing the block depth
 }
 
 func (t *logMessageString) String() string {
-	return (t).value
+	return t.indent + string(t.buf)
 }
 
+/** addString adds value as a field, unless it is empty. */
 func (t *logMessageString) addString(value string) {
 	if value != "" {
-		t.value += (value + t.separator)
+		t.addField(value)
 	}
 }
 
-func (t *logMessageString) addInt16(value int16) {
-	t.value += fmt.Sprintf("%v"+t.separator, value)
-}
-
-func (t *logMessageString) addInt32(value int32) {
-	t.value += fmt.Sprintf("%v"+t.separator, value)
-}
-
-func (t *logMessageString) addInt64(value int64) {
-	t.value += fmt.Sprintf("%v"+t.separator, value)
+/** addField adds value as a field, even if empty so that the fields of
+ * successive lines line up. */
+func (t *logMessageString) addField(value string) {
+	t.buf = append(t.buf, value...)
+	t.buf = append(t.buf, t.separator...)
 }
@@ -0,0 +1,119 @@
+package nslogger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/** metricsMaxTags is the number of distinct tags messages are counted by in
+ * metrics, the messages of other tags being counted with the tag "_other", so
+ * that a client logging with generated tags cannot grow them unbounded. */
+const metricsMaxTags = 100
+
+/** listenerMetrics are the counters of a Listener exposed as Prometheus
+ * metrics, guarded by the mutex of the listener. */
+type listenerMetrics struct {
+	connections      int64
+	bytes            int64
+	decodeErrors     int64
+	droppedDatagrams int64
+	rejected         int64
+	paused           int64
+	messages         map[metricsKey]int64
+	tags             map[string]bool // tags counted by
+}
+
+/** metricsKey are the labels messages are counted by. */
+type metricsKey struct {
+	level, tag string
+}
+
+/** received counts a message m received in a frame of n bytes. */
+func (c *listenerMetrics) received(m *Message, n int) {
+	c.bytes += int64(n)
+	key := metricsKey{tag: m.Tag}
+	if m.Type == LogmsgTypeLog || m.Type == LogmsgTypeBlockstart {
+		key.level = DefaultLevelNames[m.Level]
+		if key.level == "" {
+			key.level = strconv.Itoa(m.Level)
+		}
+	}
+	if key.tag != "" && !c.tags[key.tag] {
+		if len(c.tags) >= metricsMaxTags {
+			key.tag = "_other"
+		} else {
+			if c.tags == nil {
+				c.tags = make(map[string]bool)
+			}
+			c.tags[key.tag] = true
+		}
+	}
+	if c.messages == nil {
+		c.messages = make(map[metricsKey]int64)
+	}
+	c.messages[key]++
+}
+
+// WriteMetrics writes the metrics of the listener to w in the Prometheus text
+// exposition format: connected clients, connections accepted, messages and
+// bytes received, messages being counted by level and tag, connections
+// closed on decoding errors, connections rejected as unauthorized, reads
+// paused by FlowControl and UDP datagrams dropped.
+func (l *Listener) WriteMetrics(w io.Writer) error {
+	l.mu.Lock()
+	c := l.metrics
+	clients := len(l.sessions)
+	keys := make([]metricsKey, 0, len(c.messages))
+	counts := make(map[metricsKey]int64, len(c.messages))
+	for key, n := range c.messages {
+		keys = append(keys, key)
+		counts[key] = n
+	}
+	l.mu.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].level != keys[j].level {
+			return keys[i].level < keys[j].level
+		}
+		return keys[i].tag < keys[j].tag
+	})
+
+	bw := bufio.NewWriter(w)
+	writeMetric(bw, "nslogger_connected_clients", "gauge", "Number of connected clients.", int64(clients))
+	writeMetric(bw, "nslogger_connections_total", "counter", "Number of client connections accepted.", c.connections)
+	fmt.Fprintf(bw, "# HELP nslogger_messages_received_total Number of messages received, by level and tag.\n")
+	fmt.Fprintf(bw, "# TYPE nslogger_messages_received_total counter\n")
+	for _, key := range keys {
+		fmt.Fprintf(bw, "nslogger_messages_received_total{level=\"%s\",tag=\"%s\"} %d\n",
+			metricsLabel(key.level), metricsLabel(key.tag), counts[key])
+	}
+	writeMetric(bw, "nslogger_bytes_received_total", "counter", "Number of bytes of the messages received.", c.bytes)
+	writeMetric(bw, "nslogger_decode_errors_total", "counter", "Number of connections closed on a decoding error.", c.decodeErrors)
+	writeMetric(bw, "nslogger_connections_rejected_total", "counter", "Number of client connections rejected as unauthorized.", c.rejected)
+	writeMetric(bw, "nslogger_reads_paused_total", "counter", "Number of times the reading of a connection was paused, its queue of messages being full.", c.paused)
+	writeMetric(bw, "nslogger_datagrams_dropped_total", "counter", "Number of UDP datagrams dropped, invalid, received faster than decoded or from clients beyond the maximum.", c.droppedDatagrams)
+	return bw.Flush()
+}
+
+// MetricsHandler returns an HTTP handler serving the metrics of the listener
+// to Prometheus, as written by WriteMetrics.
+func (l *Listener) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		l.WriteMetrics(w)
+	})
+}
+
+func writeMetric(w io.Writer, name, kind, help string, value int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, kind, name, value)
+}
+
+/** metricsLabel escapes s as a label value. */
+func metricsLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,380 @@
+package nslogger
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// BinaryFormat selects how binary payloads are rendered in text output.
+type BinaryFormat int
+
+const (
+	BinaryHex    BinaryFormat = iota // hexadecimal string
+	BinaryBase64                     // standard base64 encoding
+
+	// BinaryHexDump renders binary payloads as the desktop viewer shows them:
+	// 16 bytes per line in hexadecimal and ASCII, as hexdump -C does. Text
+	// output writes these lines after the line of their message.
+	BinaryHexDump
+)
+
+func (f BinaryFormat) format(data []byte) string {
+	switch f {
+	case BinaryBase64:
+		return base64.StdEncoding.EncodeToString(data)
+	case BinaryHexDump:
+		return strings.TrimSuffix(hex.Dump(data), "\n")
+	default:
+		return hex.EncodeToString(data)
+	}
+}
+
+/** formatBinary renders the binary payload data, truncated to
+ * o.BinaryMaxBytes. */
+func (o *ParseOptions) formatBinary(data []byte) string {
+	if o.BinaryMaxBytes <= 0 || len(data) <= o.BinaryMaxBytes {
+		return o.BinaryFormat.format(data)
+	}
+	more := fmt.Sprintf("... (%d more bytes)", len(data)-o.BinaryMaxBytes)
+	if o.BinaryFormat == BinaryHexDump {
+		return o.BinaryFormat.format(data[:o.BinaryMaxBytes]) + "\n" + more
+	}
+	return o.BinaryFormat.format(data[:o.BinaryMaxBytes]) + more
+}
+
+// Format selects the output format of NsLoggerParse.
+type Format int
+
+const (
+	FormatText     Format = iota // message parts joined with the separator
+	FormatJSON                   // one JSON object per line
+	FormatCSV                    // CSV with a header row
+	FormatTemplate               // one line per message produced by a template, see WithTemplate
+	FormatLogfmt                 // one logfmt line per message, e.g. time=... level=... msg=...
+	FormatHTML                   // standalone HTML report, see WriteHTML
+	FormatTable                  // columns aligned for terminals, with a header row, see WithTableWidths
+)
+
+// DefaultTimeLayout is the layout of output timestamps, with microseconds as
+// NSLogger clients record them.
+const DefaultTimeLayout = "2006-01-02 15:04:05.000000"
+
+// Special time layouts outputting timestamps as numbers since the Unix epoch.
+const (
+	TimeLayoutUnix      = "unix"      // seconds, with a microseconds fraction
+	TimeLayoutUnixMilli = "unixmilli" // milliseconds
+)
+
+// DefaultSeparator is the separator of text output fields used by
+// ParseToWriter when none is set with WithSeparator.
+const DefaultSeparator = ","
+
+// ParseOptions holds the settings used when parsing and formatting messages.
+type ParseOptions struct {
+	Format    Format
+	Separator string // separator of text output fields for ParseToWriter
+	Header    bool   // start text output with a line naming its columns
+
+	// Columns are the columns of text, CSV and logfmt output, in order, in
+	// place of TextColumns, CSVColumns and LogfmtColumns. Columns can be any
+	// of time, elapsed, delta, type, seq, lost, thread, tag, level, levelName, message,
+	// repeated, file, line, function, depth and source; fields missing from a
+	// message, like unknown columns, are empty.
+	Columns []string
+
+	Template    *template.Template // template of FormatTemplate output
+	TableWidths TableWidths        // widths of the columns of FormatTable output
+
+	BinaryFormat    BinaryFormat
+	BinaryMaxBytes  int              // number of bytes of binary payloads rendered, all if 0
+	ImageDir        string           // directory where image payloads are written, if set
+	ImageConversion *ImageConversion // re-encodes image payloads, see WithImageConversion
+	Filter          *Filter
+	Sampling        *Sampling      // keeps a sample of log messages, see WithSampling
+	Hooks           []Hook         // transform or drop messages, see WithHooks
+	Redaction       *Redaction     // masks sensitive content in message texts, see WithRedaction
+	Grep            *Grep          // selects messages matching a pattern, with context, see WithGrep
+	Highlight       *regexp.Regexp // matches highlighted in colored text output, see WithHighlight
+	LevelNames      map[int]string // names of the log levels, DefaultLevelNames if nil
+	TimeLayout      string         // time.Format layout of timestamps, DefaultTimeLayout if empty
+	Location        *time.Location // time zone of timestamps, time.Local if nil
+	BlockIndent     string         // repeated before text lines once per enclosing block
+	MarkDividers    bool           // output marks as divider lines in text output
+	MarkRange       *MarkRange     // keeps the messages between two marks, see WithMarkRange
+	Color           bool           // color text output with ANSI escape sequences, see WithColor
+	RelativeTimes   bool           // set the Elapsed and Delta fields of messages, see WithRelativeTimes
+
+	// Recover skips corrupt and truncated messages instead of failing, and
+	// reports the skipped bytes to OnSkip if set.
+	Recover bool
+	OnSkip  func(SkippedRange)
+
+	// Lenient skips the message parts that cannot be decoded, such as parts of
+	// unknown types, using their declared size, instead of failing. Skipped
+	// parts are reported to OnSkipPart if set.
+	Lenient    bool
+	OnSkipPart func(SkippedPart)
+
+	Quirks Quirks // encoding deviations of client ports accepted, see WithQuirks
+	Limits Limits // bounds of the messages accepted, see WithLimits
+
+	OnWarning   func(Warning) // called with non-fatal anomalies, see WithWarnings
+	Diagnostics *slog.Logger  // logs the anomalies found, see WithDiagnostics
+
+	// Strict makes an incomplete message at the end of the input an error
+	// wrapping ErrTruncatedMessage. It is ignored otherwise, as when a client
+	// was interrupted while writing a capture.
+	Strict bool
+
+	Collapse  bool // collapse runs of identical messages, see WithCollapse
+	Stitching bool // merge the reconnections of clients, see WithStitching
+	Interning bool // share the storage of repeated strings, see WithInterning
+
+	// PoolMessages makes Decoder.Next return messages taken from a pool, see
+	// WithMessagePool.
+	PoolMessages bool
+
+	// Reorder is the number of messages held back to output them in sequence
+	// order, see WithReorder.
+	Reorder int
+
+	// Workers is the number of goroutines decoding the messages of in-memory
+	// captures in parallel. Captures are decoded sequentially if it is lower
+	// than 2, and in recovery mode.
+	Workers int
+
+	ctx      context.Context // set by WithContext
+	sampler  *sampler        // state of Sampling
+	stitcher *stitcher       // state of Stitching
+	relative *relativeTimes  // state of RelativeTimes
+	strings  *stringTable    // state of Interning
+
+	inMarkRange bool // the messages decoded are in MarkRange
+}
+
+// Option modifies ParseOptions.
+type Option func(*ParseOptions)
+
+// WithFormat sets the output format of NsLoggerParse.
+func WithFormat(f Format) Option {
+	return func(o *ParseOptions) {
+		o.Format = f
+	}
+}
+
+// WithSeparator sets the separator of the fields of text output lines, and
+// the delimiter of CSV output if it is a single character, for ParseToWriter.
+func WithSeparator(separator string) Option {
+	return func(o *ParseOptions) {
+		o.Separator = separator
+	}
+}
+
+// WithHeader starts text output with a header line naming its columns.
+func WithHeader() Option {
+	return func(o *ParseOptions) {
+		o.Header = true
+	}
+}
+
+// WithColumns selects the columns of text, CSV and logfmt output and their order,
+// e.g. WithColumns("time", "level", "tag", "thread", "message").
+func WithColumns(columns ...string) Option {
+	return func(o *ParseOptions) {
+		o.Columns = columns
+	}
+}
+
+// WithBinaryFormat sets how binary payloads are rendered in text output.
+func WithBinaryFormat(f BinaryFormat) Option {
+	return func(o *ParseOptions) {
+		o.BinaryFormat = f
+	}
+}
+
+// WithBinaryMaxBytes truncates the binary payloads rendered in text output
+// to their first n bytes, followed by the number of bytes left out.
+func WithBinaryMaxBytes(n int) Option {
+	return func(o *ParseOptions) {
+		o.BinaryMaxBytes = n
+	}
+}
+
+// WithImageDir writes image payloads as files to dir while parsing, named by
+// ImageFilename.
+func WithImageDir(dir string) Option {
+	return func(o *ParseOptions) {
+		o.ImageDir = dir
+	}
+}
+
+// WithFilter only outputs the messages matching f.
+func WithFilter(f *Filter) Option {
+	return func(o *ParseOptions) {
+		o.Filter = f
+	}
+}
+
+// WithTimeRange only outputs the messages logged between start (inclusive)
+// and end (exclusive). A zero time leaves that side of the window open. It
+// applies on top of a filter set by a preceding WithFilter.
+func WithTimeRange(start, end time.Time) Option {
+	return func(o *ParseOptions) {
+		var f Filter
+		if o.Filter != nil {
+			f = *o.Filter
+		}
+		f.Start, f.End = start, end
+		o.Filter = &f
+	}
+}
+
+// WithTimeLayout sets the layout used to output timestamps: either a layout
+// accepted by time.Format, such as time.RFC3339, or one of TimeLayoutUnix and
+// TimeLayoutUnixMilli.
+func WithTimeLayout(layout string) Option {
+	return func(o *ParseOptions) {
+		o.TimeLayout = layout
+	}
+}
+
+// WithLocation sets the time zone in which timestamps are expressed, e.g.
+// time.UTC.
+func WithLocation(loc *time.Location) Option {
+	return func(o *ParseOptions) {
+		o.Location = loc
+	}
+}
+
+/** formatTime formats t according to the time layout and location of o. */
+func (o *ParseOptions) formatTime(t time.Time) string {
+	if o.Location != nil {
+		t = t.In(o.Location)
+	}
+
+	switch o.TimeLayout {
+	case "":
+		return t.Format(DefaultTimeLayout)
+	case TimeLayoutUnix:
+		return fmt.Sprintf("%d.%06d", t.Unix(), t.Nanosecond()/int(time.Microsecond))
+	case TimeLayoutUnixMilli:
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	}
+	return t.Format(o.TimeLayout)
+}
+
+// WithBlockIndent indents text output lines with indent repeated once per
+// enclosing block, to show the blocks created by the client.
+func WithBlockIndent(indent string) Option {
+	return func(o *ParseOptions) {
+		o.BlockIndent = indent
+	}
+}
+
+// WithMarkDividers outputs marks as visible divider lines in text output.
+func WithMarkDividers() Option {
+	return func(o *ParseOptions) {
+		o.MarkDividers = true
+	}
+}
+
+// WithRecovery enables recovery mode: decoding resumes at the next plausible
+// message after a corrupt or truncated one instead of failing, as needed to
+// read the files of crashed apps. report, if not nil, is called with every
+// range of bytes skipped.
+func WithRecovery(report func(SkippedRange)) Option {
+	return func(o *ParseOptions) {
+		o.Recover = true
+		o.OnSkip = report
+	}
+}
+
+// WithLenient enables lenient mode: message parts that cannot be decoded,
+// such as parts of unknown types sent by newer clients, are skipped instead of
+// failing the decoding of their message. Parts of unknown types are assumed
+// to have their data preceded by its size, as strings do. report, if not nil,
+// is called with every part skipped.
+func WithLenient(report func(SkippedPart)) Option {
+	return func(o *ParseOptions) {
+		o.Lenient = true
+		o.OnSkipPart = report
+	}
+}
+
+// WithStrict enables strict mode, where an incomplete message at the end of
+// the input is an error instead of being ignored.
+func WithStrict() Option {
+	return func(o *ParseOptions) {
+		o.Strict = true
+	}
+}
+
+/** ignoreTrailing reports whether an incomplete message ending the input is
+ * silently ignored, recovery mode reporting it as skipped instead. */
+func (o *ParseOptions) ignoreTrailing() bool {
+	return !o.Strict && !o.Recover
+}
+
+// WithWorkers decodes captures with n goroutines, to speed up the decoding of
+// large files by Decode and NsLoggerParse. runtime.GOMAXPROCS(0) is a good
+// value for n.
+func WithWorkers(n int) Option {
+	return func(o *ParseOptions) {
+		o.Workers = n
+	}
+}
+
+// WithLevelNames sets the names given to the log levels in place of
+// DefaultLevelNames.
+func WithLevelNames(names map[int]string) Option {
+	return func(o *ParseOptions) {
+		o.LevelNames = names
+	}
+}
+
+/** keep reports whether m passes the message filters of o. */
+func (o *ParseOptions) keep(m *Message) bool {
+	return o.Filter == nil || o.Filter.Match(m)
+}
+
+/** process applies o to a freshly decoded message: it sets its time zone
+ * and names the level of log entries, then saves its image if the message
+ * passes the filters, which it reports. */
+func (o *ParseOptions) process(m *Message) (bool, error) {
+	if o.Location != nil {
+		m.Timestamp = m.Timestamp.In(o.Location)
+	}
+	if m.Type == LogmsgTypeLog {
+		m.LevelName = o.levelName(m.Level)
+	}
+	o.setElapsed(m)
+	if !o.stitch(m) || !o.sliceMarks(m) || !o.keep(m) || !o.sample(m) || !o.runHooks(m) {
+		return false, nil
+	}
+	o.setDelta(m)
+	o.redact(m)
+	convertImage(o.ImageConversion, m, o.Limits.MaxImagePixels)
+	if _, err := saveImage(o.ImageDir, m); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func newParseOptions(opts []Option) *ParseOptions {
+	o := &ParseOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.Interning {
+		o.strings = newStringTable() // created here, parallel decoding sharing it
+	}
+	return o
+}
@@ -0,0 +1,185 @@
+package nslogger
+
+import (
+	"bufio"
+	"sync"
+)
+
+/** indexedMessage is a message located in a capture by indexMessages. */
+type indexedMessage struct {
+	body     []byte
+	offset   int64 // offset of body in the capture
+	msg      Message
+	warnings []Warning // anomalies found, located in body
+	err      error     // decoding error, located in the capture
+}
+
+/** indexMessages locates the messages of b from their size headers, without
+ * decoding them. The error, if any, concerns the message following the last
+ * one returned. An incomplete message ending b is ignored unless in strict
+ * mode. */
+func indexMessages(b []byte, o *ParseOptions) ([]indexedMessage, error) {
+	if err := checkCaptureSize(b); err != nil {
+		return nil, err
+	}
+	var msgs []indexedMessage
+	for off := uint32(0); off < uint32(len(b)); {
+		if o.ignoreTrailing() && !frameComplete(b, off, o.Quirks) {
+			break
+		}
+		if err := need(b, off, 4); err != nil {
+			return msgs, err
+		}
+		totalSize := o.Quirks.order().Uint32(b[off : off+4])
+		if err := o.checkMessageSize(totalSize); err != nil {
+			return msgs, atOffset(err, int64(off))
+		}
+		if err := need(b, off+4, totalSize); err != nil {
+			return msgs, atOffset(ErrTruncatedMessage, int64(off))
+		}
+		msgs = append(msgs, indexedMessage{body: b[off+4 : off+4+totalSize], offset: int64(off) + 4})
+		off += 4 + totalSize
+	}
+	return msgs, nil
+}
+
+/** parallel reports whether in-memory captures are decoded in parallel. */
+func (o *ParseOptions) parallel() bool {
+	return o.Workers > 1 && !o.Recover
+}
+
+/** runParallel calls f for every index from 0 to n-1, spreading the calls
+ * over workers goroutines. */
+func runParallel(n, workers int, f func(i int)) {
+	if workers > n {
+		workers = n
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				f(i)
+			}
+		}(n*w/workers, n*(w+1)/workers)
+	}
+	wg.Wait()
+}
+
+/** decodeIndexed indexes b and decodes its messages in parallel, then
+ * applies the stream state and o to them in order. It returns the messages
+ * kept up to the first error, with nil entries separating groups of grep
+ * output. */
+func decodeIndexed(b []byte, o *ParseOptions) ([]*Message, error) {
+	msgs, indexErr := indexMessages(b, o)
+	runParallel(len(msgs), o.Workers, func(i int) {
+		if o.canceled() != nil {
+			return
+		}
+		m := &msgs[i]
+		if m.msg, m.warnings, m.err = decodeMessage(m.body, o.Lenient, o); m.err != nil {
+			m.err = atOffset(m.err, m.offset)
+		}
+	})
+
+	var kept []*Message
+	var state streamState
+	grep := o.newGrepper()
+	collapse := o.newCollapser()
+	order := reorderer{window: o.Reorder}
+
+	add := func(m *Message) {
+		if grep != nil {
+			kept = append(kept, grep.feed(m)...)
+		} else {
+			kept = append(kept, m)
+		}
+	}
+	// keepReady applies the state and o to the messages released by order
+	keepReady := func() error {
+		for dm, ok := order.pop(); ok; dm, ok = order.pop() {
+			m := dm.msg
+			o.warned(append(dm.warnings, state.update(m)...), dm.body)
+			keep, err := o.process(m)
+			if err != nil {
+				return err
+			}
+			if keep && collapse != nil {
+				m = collapse.feed(m)
+			}
+			if keep && m != nil {
+				add(m)
+			}
+		}
+		return nil
+	}
+	// finish keeps the messages still held back, at the end of the input
+	finish := func() error {
+		order.flush()
+		if err := keepReady(); err != nil {
+			return err
+		}
+		if m := collapse.flush(); m != nil {
+			add(m)
+		}
+		return nil
+	}
+
+	for i := range msgs {
+		if err := o.canceled(); err != nil {
+			return kept, err
+		}
+		m := &msgs[i]
+		if m.err != nil {
+			if err := finish(); err != nil {
+				return kept, err
+			}
+			return kept, m.err
+		}
+		order.push(decodedMessage{msg: &m.msg, warnings: m.warnings, body: m.offset})
+		if err := keepReady(); err != nil {
+			return kept, err
+		}
+	}
+
+	if err := finish(); err != nil {
+		return kept, err
+	}
+	return kept, indexErr
+}
+
+/** decodeParallel is decode using o.Workers goroutines. */
+func decodeParallel(b []byte, o *ParseOptions) ([]Message, error) {
+	kept, err := decodeIndexed(b, o)
+	msgs := make([]Message, 0, len(kept))
+	for _, m := range kept {
+		if m != nil {
+			msgs = append(msgs, *m)
+		}
+	}
+	return msgs, err
+}
+
+/** parseParallel is parseText using o.Workers goroutines, the lines being
+ * formatted in parallel too. */
+func parseParallel(w *bufio.Writer, b []byte, separator string, o *ParseOptions) error {
+	kept, err := decodeIndexed(b, o)
+
+	lines := make([]string, len(kept))
+	runParallel(len(kept), o.Workers, func(i int) {
+		if kept[i] == nil {
+			lines[i] = "--"
+		} else {
+			lines[i] = o.formatText(kept[i], separator)
+		}
+	})
+
+	for _, line := range lines {
+		w.WriteString(line)
+		if err := w.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,171 @@
+package nslogger
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Part is a message part as read from the stream. Integer parts hold their
+// value in Value, string, binary and image parts their bytes in Data. Parts of
+// registered types hold their bytes in Data and their decoded value in
+// Decoded.
+type Part struct {
+	Key     uint8
+	Type    uint8
+	Value   int64
+	Data    []byte
+	Decoded interface{}
+}
+
+// PartHandler decodes a user-defined part into m. p.Data is only valid during
+// the call and must be copied to be kept.
+type PartHandler func(m *Message, p Part) error
+
+/** partKey is a part key registered with RegisterPartKey. */
+type partKey struct {
+	name    string
+	handler PartHandler
+}
+
+var partKeys struct {
+	sync.RWMutex
+	m map[uint8]partKey
+}
+
+// RegisterPartKey registers a user-defined part key, for applications
+// extending the NSLogger protocol with parts of their own. Parts with that
+// key are decoded by handler or, if handler is nil, stored in the Extra
+// field of their message under name: as strings, int64 values or byte
+// slices depending on their type. Parts with keys that are not registered
+// are skipped.
+//
+// It panics if key is lower than PartKeyUserDefined, the keys below being
+// reserved for the NSLogger protocol.
+func RegisterPartKey(key uint8, name string, handler PartHandler) {
+	if key < PartKeyUserDefined {
+		panic(fmt.Sprintf("nslogger: part key %d is reserved, user-defined keys start at %d", key, PartKeyUserDefined))
+	}
+
+	partKeys.Lock()
+	defer partKeys.Unlock()
+	if partKeys.m == nil {
+		partKeys.m = make(map[uint8]partKey)
+	}
+	partKeys.m[key] = partKey{name: name, handler: handler}
+}
+
+// PartTypeDecoder decodes the data of a part of a custom type into its value.
+// data is only valid during the call.
+type PartTypeDecoder func(data []byte) (interface{}, error)
+
+/** partType is a part type registered with RegisterPartType. */
+type partType struct {
+	size   int
+	decode PartTypeDecoder
+}
+
+var partTypes struct {
+	sync.RWMutex
+	m map[uint8]partType
+}
+
+// RegisterPartType registers a custom part type, for protocol extensions or
+// vendor-specific payloads such as protobuf messages. size is the size of the
+// data of its parts in bytes or, if 0, the data is preceded by its size as a
+// 32-bit big-endian integer, as the data of string parts is. The data is
+// decoded by decode, or kept as is if decode is nil.
+//
+// Parts of a custom type with a key of the protocol are converted to the type
+// of their field with fmt.Sprint, e.g. message parts set the message text.
+// Those with a user-defined key are passed to its handler, or stored in Extra
+// as decoded. Parts of types that are not registered make decoding fail.
+//
+// It panics if typ is a type of the NSLogger protocol or size is negative.
+func RegisterPartType(typ uint8, size int, decode PartTypeDecoder) {
+	if typ <= PartTypeImage {
+		panic(fmt.Sprintf("nslogger: part type %d is reserved", typ))
+	}
+	if size < 0 {
+		panic(fmt.Sprintf("nslogger: negative size for part type %d", typ))
+	}
+
+	partTypes.Lock()
+	defer partTypes.Unlock()
+	if partTypes.m == nil {
+		partTypes.m = make(map[uint8]partType)
+	}
+	partTypes.m[typ] = partType{size: size, decode: decode}
+}
+
+/** registeredPartType returns the registration of typ, if any. */
+func registeredPartType(typ uint8) (partType, bool) {
+	partTypes.RLock()
+	defer partTypes.RUnlock()
+	t, ok := partTypes.m[typ]
+	return t, ok
+}
+
+/** registeredPartKey returns the registration of key, if any. */
+func registeredPartKey(key uint8) (partKey, bool) {
+	partKeys.RLock()
+	defer partKeys.RUnlock()
+	k, ok := partKeys.m[key]
+	return k, ok
+}
+
+/** partKeyNamed returns the registered key stored in Extra under name. */
+func partKeyNamed(name string) (uint8, bool) {
+	partKeys.RLock()
+	defer partKeys.RUnlock()
+	for key, k := range partKeys.m {
+		if k.name == name && k.handler == nil {
+			return key, true
+		}
+	}
+	return 0, false
+}
+
+/** decodeUserPart decodes a part with a key unknown to the protocol into m,
+ * skipping it if its key is not registered. */
+func decodeUserPart(m *Message, p part) error {
+	k, ok := registeredPartKey(p.key)
+	if !ok {
+		return nil
+	}
+	if k.handler != nil {
+		return k.handler(m, Part{Key: p.key, Type: p.typ, Value: p.value, Data: p.data, Decoded: p.decoded})
+	}
+
+	if m.Extra == nil {
+		m.Extra = make(map[string]interface{})
+	}
+	switch {
+	case p.decoded != nil:
+		m.Extra[k.name] = p.decoded
+	case p.typ == PartTypeString:
+		m.Extra[k.name] = string(p.data)
+	case p.typ == PartTypeInt16 || p.typ == PartTypeInt32 || p.typ == PartTypeInt64:
+		m.Extra[k.name] = p.value
+	default:
+		m.Extra[k.name] = append([]byte(nil), p.data...)
+	}
+	return nil
+}
+
+/** addExtra adds the Extra values of m stored under registered keys. */
+func (e *messageEncoder) addExtra(m *Message) {
+	for name, value := range m.Extra {
+		key, ok := partKeyNamed(name)
+		if !ok {
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			e.addString(key, v)
+		case int64:
+			e.addInt64(key, v)
+		case []byte:
+			e.addData(key, PartTypeBinary, v)
+		}
+	}
+}
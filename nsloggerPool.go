@@ -0,0 +1,47 @@
+package nslogger
+
+import "sync"
+
+/** messagePool holds the messages released, for decoders with PoolMessages
+ * to reuse. */
+var messagePool = sync.Pool{New: func() interface{} { return new(Message) }}
+
+// WithMessagePool makes Decoder.Next return messages taken from a pool, for
+// the callers handling tens of thousands of messages per second, such as
+// listeners receiving the logs of many devices, to release them with Release
+// once handled instead of leaving them to the garbage collector. Messages not
+// released are collected as usual, and those dropped by options are released
+// by the decoder. Decode, which copies the messages it returns, reuses the
+// same few messages of the pool.
+func WithMessagePool() Option {
+	return func(o *ParseOptions) {
+		o.PoolMessages = true
+	}
+}
+
+// Release returns m to the pool of messages of WithMessagePool, to be reused
+// by the next message decoded. Neither m nor its fields may be used once
+// released, by the caller or by anything m was passed to, such as a Store:
+// messages kept must be copied first. It must be called at most once, and
+// only on the messages returned by Next, or delivered by a Listener, with
+// WithMessagePool.
+func (m *Message) Release() {
+	*m = Message{}
+	messagePool.Put(m)
+}
+
+/** newMessage returns a zero message, from the pool with PoolMessages. */
+func (o *ParseOptions) newMessage() *Message {
+	if o.PoolMessages {
+		return messagePool.Get().(*Message)
+	}
+	return new(Message)
+}
+
+/** release returns m to the pool with PoolMessages, for the messages the
+ * package itself is done with. */
+func (o *ParseOptions) release(m *Message) {
+	if o.PoolMessages {
+		m.Release()
+	}
+}
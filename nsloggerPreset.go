@@ -0,0 +1,144 @@
+package nslogger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// ErrUnknownPreset is returned when applying a filter preset that is not
+// defined.
+var ErrUnknownPreset = errors.New("nslogger: unknown filter preset")
+
+// PresetsEnv names the environment variable holding the path of the filter
+// presets file of the nslogger command.
+const PresetsEnv = "NSLOGGER_PRESETS"
+
+// Presets are named filters, such as "networking-only" or
+// "errors-and-marks", shared by a team as a standard view of their logs.
+type Presets map[string]*Filter
+
+// Preset is the JSON definition of a filter in a presets file. Levels are
+// numbers or names, e.g. "info", and times are in RFC 3339 format.
+type Preset struct {
+	Tags        []string               `json:"tags,omitempty"`
+	ExcludeTags []string               `json:"excludeTags,omitempty"`
+	Threads     []string               `json:"threads,omitempty"`
+	Level       *PresetLevel           `json:"level,omitempty"`
+	TagLevels   map[string]PresetLevel `json:"tagLevels,omitempty"`
+	Pattern     string                 `json:"pattern,omitempty"`
+	Since       *time.Time             `json:"since,omitempty"`
+	Until       *time.Time             `json:"until,omitempty"`
+}
+
+// PresetLevel is a log level in a presets file, given as a number or as a
+// name parsed by ParseLevel.
+type PresetLevel int
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (l *PresetLevel) UnmarshalJSON(b []byte) error {
+	var n int
+	if err := json.Unmarshal(b, &n); err == nil {
+		*l = PresetLevel(n)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("nslogger: invalid level %s", b)
+	}
+	level, err := ParseLevel(s)
+	*l = PresetLevel(level)
+	return err
+}
+
+// Filter returns the filter defined by p.
+func (p *Preset) Filter() (*Filter, error) {
+	f := &Filter{
+		Tags:        p.Tags,
+		ExcludeTags: p.ExcludeTags,
+		Threads:     p.Threads,
+	}
+	if p.Since != nil {
+		f.Start = *p.Since
+	}
+	if p.Until != nil {
+		f.End = *p.Until
+	}
+	if p.Level != nil {
+		level := int(*p.Level)
+		f.MinLevel = &level
+	}
+	for tag, level := range p.TagLevels {
+		if f.TagLevels == nil {
+			f.TagLevels = make(map[string]int)
+		}
+		f.TagLevels[tag] = int(level)
+	}
+	if p.Pattern != "" {
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		f.Pattern = re
+	}
+	return f, nil
+}
+
+// ParsePresets parses the filter presets defined in JSON by b, an object
+// mapping the names of presets to their definition:
+//
+//	{
+//		"networking-only": {"tags": ["network"], "level": "verbose"},
+//		"errors-and-marks": {"level": "error"}
+//	}
+func ParsePresets(b []byte) (Presets, error) {
+	var defs map[string]*Preset
+	if err := json.Unmarshal(b, &defs); err != nil {
+		return nil, fmt.Errorf("nslogger: invalid filter presets: %w", err)
+	}
+	presets := make(Presets, len(defs))
+	for name, def := range defs {
+		if def == nil {
+			def = &Preset{}
+		}
+		f, err := def.Filter()
+		if err != nil {
+			return nil, fmt.Errorf("nslogger: filter preset %q: %w", name, err)
+		}
+		presets[name] = f
+	}
+	return presets, nil
+}
+
+// LoadPresets reads the filter presets defined in the JSON file name, as
+// parsed by ParsePresets.
+func LoadPresets(name string) (Presets, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePresets(b)
+}
+
+// Filter returns the filter of the preset name.
+func (p Presets) Filter(name string) (*Filter, error) {
+	f, ok := p[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownPreset, name)
+	}
+	return f, nil
+}
+
+// Names returns the names of the presets, sorted.
+func (p Presets) Names() []string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,57 @@
+package nslogger
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Quirks are deviations from the NSLogger binary format found in captures of
+// older or third-party client ports, which decoding accepts when enabled with
+// WithQuirks. Captures written by the reference clients need none.
+type Quirks uint
+
+const (
+	// QuirkLittleEndian decodes sizes and integers in little-endian byte
+	// order instead of network order.
+	QuirkLittleEndian Quirks = 1 << iota
+
+	// QuirkInt16ImageSize decodes image width and height parts of type int32
+	// as holding 16-bit values, as written by ports sending image dimensions
+	// as 16-bit integers.
+	QuirkInt16ImageSize
+
+	// QuirkUnsizedStrings decodes string parts whose size is missing, their
+	// data following their type directly, as NUL-terminated strings ending
+	// at the end of their message at the latest. Strings whose size is
+	// consistent with their message are decoded as usual.
+	QuirkUnsizedStrings
+)
+
+// WithQuirks decodes captures with the deviations from the binary format q.
+// Messages can only be written back in the standard format.
+func WithQuirks(q Quirks) Option {
+	return func(o *ParseOptions) {
+		o.Quirks = q
+	}
+}
+
+/** order returns the byte order of the integers of captures with quirks q. */
+func (q Quirks) order() binary.ByteOrder {
+	if q&QuirkLittleEndian != 0 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+/** unsizedString reads the data of the string part p starting at nBytes in
+ * b, without size, up to a NUL byte or the end of b. Like readPart, it
+ * returns the number of bytes following the key/type header. */
+func unsizedString(b []byte, nBytes uint32, p part) (part, uint32, error) {
+	data := b[nBytes+2:]
+	if end := bytes.IndexByte(data, 0); end >= 0 {
+		p.data = data[:end]
+		return p, uint32(end) + 1, nil
+	}
+	p.data = data
+	return p, uint32(len(data)), nil
+}
@@ -0,0 +1,385 @@
+package nslogger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RecordOptions sets when a Recorder rotates its capture file, and what
+// becomes of the rotated files. Limits that are zero do not apply; with none,
+// a single file is written.
+type RecordOptions struct {
+	MaxSize  int64         // maximum size per file in bytes, a file holding at least one message
+	Interval time.Duration // time window per file, aligned on multiples of Interval, e.g. on hours
+
+	// MaxFiles is the number of files kept, the current one included. The
+	// oldest rotated files are deleted past it, including those recorded
+	// before the Recorder was created.
+	MaxFiles int
+
+	// Compress gzip-compresses rotated files, adding a .gz extension, in the
+	// background so that recording goes on meanwhile.
+	Compress bool
+}
+
+// Recorder writes the frames received by a Listener verbatim to a capture
+// file, as the desktop viewer saves them, so that the listener records its
+// clients even when no one is watching live. Set it as the Recorder of the
+// listener.
+//
+// Without rotation, the file is the named one. With rotation, files are named
+// after it with the time they were created: "capture.rawnsloggerdata" is
+// recorded to "capture-20240501T090000.rawnsloggerdata" and so on. Every file
+// starts with the client info messages of the clients connected when it was
+// created. Names with a .gz extension, e.g. "capture.rawnsloggerdata.gz",
+// make gzip-compressed files, complete once closed or rotated.
+type Recorder struct {
+	base, ext string
+	opts      RecordOptions
+
+	mu      sync.Mutex
+	w       *FileWriter
+	files   []string
+	size    int64             // bytes written to the current file
+	written bool              // frames were recorded to the current file
+	window  time.Time         // start of the time window of the current file
+	clients map[uint64][]byte // last client info frame of each session
+	stamp   string            // name of the last file created, without number and extension
+	n       int               // number of the last file created among those of stamp
+	err     error             // error that stopped the recording
+	closed  bool
+
+	archiving  sync.WaitGroup // rotated files being compressed and pruned
+	archiveMu  sync.Mutex     // serializes archiving
+	archiveErr error          // first error archiving rotated files
+}
+
+// NewRecorder returns a Recorder writing to the file name, or files named
+// after it if opts rotates them, creating the first file.
+func NewRecorder(name string, opts RecordOptions) (*Recorder, error) {
+	return newRecorder(name, opts, make(map[uint64][]byte))
+}
+
+// newRecorder returns a Recorder whose files start with the client info
+// frames of clients, by session.
+func newRecorder(name string, opts RecordOptions, clients map[uint64][]byte) (*Recorder, error) {
+	ext := filepath.Ext(name)
+	if ext == ".gz" {
+		ext = filepath.Ext(strings.TrimSuffix(name, ext)) + ext
+	}
+	r := &Recorder{base: strings.TrimSuffix(name, ext), ext: ext, opts: opts, clients: clients}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.rotate(time.Now()); err != nil {
+		return nil, err
+	}
+	if r.rotating() && opts.MaxFiles > 0 {
+		r.archiving.Add(1)
+		go r.archive("")
+	}
+	return r, nil
+}
+
+// Files returns the names of the files created and still kept, in order, the
+// last one being the file currently written. Compressed files are named with
+// their .gz extension once compressed.
+func (r *Recorder) Files() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.files...)
+}
+
+// Err returns the error that stopped the recording, if any.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Close closes the current file and waits for rotated files to be archived,
+// returning the first error compressing or deleting them. Frames received
+// afterwards are dropped.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	var err error
+	if !r.closed && r.w != nil {
+		err = r.w.Close()
+		r.w = nil
+	}
+	r.closed = true
+	r.mu.Unlock()
+
+	r.archiving.Wait()
+	if err == nil {
+		r.archiveMu.Lock()
+		err = r.archiveErr
+		r.archiveMu.Unlock()
+	}
+	return err
+}
+
+// record writes the frame of message m, made of its size header and body,
+// received from the client of session. Recording stops at the first error,
+// returned by Err.
+func (r *Recorder) record(session uint64, header, body []byte, m *Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed || r.err != nil {
+		return
+	}
+
+	if m.Type == LogmsgTypeClientinfo {
+		r.clients[session] = append(append(r.clients[session][:0], header...), body...)
+	}
+	now := time.Now()
+	if r.full(len(header)+len(body), now) {
+		if r.err = r.rotate(now); r.err != nil || m.Type == LogmsgTypeClientinfo {
+			// The new file starts with the client info frame
+			return
+		}
+	}
+	r.err = r.write(header, body)
+	r.written = true
+}
+
+// forget drops the client info of session, when its client disconnects.
+func (r *Recorder) forget(session uint64) {
+	r.mu.Lock()
+	delete(r.clients, session)
+	r.mu.Unlock()
+}
+
+// full reports whether a frame of n bytes received at now must be written
+// to the next file.
+func (r *Recorder) full(n int, now time.Time) bool {
+	if !r.written {
+		return false
+	}
+	o := r.opts
+	switch {
+	case o.MaxSize > 0 && r.size+int64(n) > o.MaxSize:
+		return true
+	case o.Interval > 0:
+		return !now.Before(r.window.Add(o.Interval))
+	}
+	return false
+}
+
+// rotate closes the current file and creates the next one, starting with
+// the client info frames of the connected clients.
+func (r *Recorder) rotate(now time.Time) error {
+	if r.w != nil {
+		err := r.w.Close()
+		r.w = nil
+		if err != nil {
+			return err
+		}
+		if r.opts.Compress || r.opts.MaxFiles > 0 {
+			r.archiving.Add(1)
+			go r.archive(r.files[len(r.files)-1])
+		}
+	}
+
+	name := r.base + r.ext
+	if r.rotating() {
+		name = r.fileName(now)
+	}
+	w, err := CreateFile(name)
+	if err != nil {
+		return err
+	}
+	r.w = w
+	r.files = append(r.files, name)
+	r.size, r.written = 0, false
+	if r.opts.Interval > 0 {
+		r.window = now.Truncate(r.opts.Interval)
+	}
+
+	sessions := make([]uint64, 0, len(r.clients))
+	for session := range r.clients {
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i] < sessions[j] })
+	for _, session := range sessions {
+		if err := r.write(r.clients[session], nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rotating reports whether files are rotated, and named with their time of
+// creation.
+func (r *Recorder) rotating() bool {
+	return r.opts.MaxSize > 0 || r.opts.Interval > 0
+}
+
+// fileName returns the name of a file created at now, numbered after the
+// files created the same second, by r or before it.
+func (r *Recorder) fileName(now time.Time) string {
+	stamp := r.base + "-" + now.Format("20060102T150405")
+	n := 1
+	if stamp == r.stamp {
+		n = r.n + 1 // the previous files may have been compressed or deleted since
+	}
+	for ; ; n++ {
+		name := stamp + r.ext
+		if n > 1 {
+			name = fmt.Sprintf("%s-%d%s", stamp, n, r.ext)
+		}
+		if !exists(name) && !exists(name+".gz") {
+			r.stamp, r.n = stamp, n
+			return name
+		}
+	}
+}
+
+// exists reports whether the file name exists.
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return !os.IsNotExist(err)
+}
+
+// write writes a frame to the current file, flushing it so that a crash of
+// the listener loses as little as possible.
+func (r *Recorder) write(header, body []byte) error {
+	if _, err := r.w.bw.Write(header); err != nil {
+		return err
+	}
+	if _, err := r.w.bw.Write(body); err != nil {
+		return err
+	}
+	r.size += int64(len(header) + len(body))
+	return r.w.bw.Flush()
+}
+
+// archive compresses the rotated file name if requested, then deletes the
+// oldest rotated files past the retention limit. With no name, it only does
+// the latter.
+func (r *Recorder) archive(name string) {
+	defer r.archiving.Done()
+	r.archiveMu.Lock()
+	defer r.archiveMu.Unlock()
+
+	var err error
+	if name != "" && r.opts.Compress && !strings.HasSuffix(name, ".gz") {
+		err = r.compress(name)
+	}
+	if r.opts.MaxFiles > 0 {
+		if perr := r.prune(); err == nil {
+			err = perr
+		}
+	}
+	if err != nil && r.archiveErr == nil {
+		r.archiveErr = err
+	}
+}
+
+// compress gzip-compresses the file name to name.gz and deletes it.
+func (r *Recorder) compress(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := name + ".gz.tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if zerr := zw.Close(); err == nil {
+		err = zerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, name+".gz")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	r.mu.Lock()
+	for i, f := range r.files {
+		if f == name {
+			r.files[i] = name + ".gz"
+		}
+	}
+	r.mu.Unlock()
+	return os.Remove(name)
+}
+
+// prune deletes the oldest files recorded with the name of r past
+// opts.MaxFiles, the current file included in the count.
+func (r *Recorder) prune() error {
+	dir, base := filepath.Split(r.base)
+	entries, err := os.ReadDir(filepath.Clean(dir + "."))
+	if err != nil {
+		return err
+	}
+	pattern := regexp.MustCompile(`^` + regexp.QuoteMeta(base) + `-(\d{8}T\d{6})(?:-(\d+))?` + regexp.QuoteMeta(r.ext) + `(?:\.gz)?$`)
+	type recorded struct {
+		name, stamp string
+		n           int
+	}
+	var files []recorded
+	for _, e := range entries {
+		match := pattern.FindStringSubmatch(e.Name())
+		if match == nil || !e.Type().IsRegular() {
+			continue
+		}
+		n := 1
+		if match[2] != "" {
+			n, _ = strconv.Atoi(match[2])
+		}
+		files = append(files, recorded{dir + e.Name(), match[1], n})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].stamp != files[j].stamp {
+			return files[i].stamp < files[j].stamp
+		}
+		return files[i].n < files[j].n
+	})
+
+	r.mu.Lock()
+	current := r.files[len(r.files)-1]
+	r.mu.Unlock()
+	if len(files) <= r.opts.MaxFiles {
+		return nil
+	}
+	for _, f := range files[:len(files)-r.opts.MaxFiles] {
+		if f.name == current {
+			continue
+		}
+		if rerr := os.Remove(f.name); rerr != nil && !os.IsNotExist(rerr) {
+			if err == nil {
+				err = rerr
+			}
+			continue
+		}
+		r.mu.Lock()
+		for i, name := range r.files {
+			if name == f.name {
+				r.files = append(r.files[:i], r.files[i+1:]...)
+				break
+			}
+		}
+		r.mu.Unlock()
+	}
+	return err
+}
@@ -0,0 +1,125 @@
+package nslogger
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// maxResyncMessageSize is the largest message size accepted while looking for
+// the next message after a corrupt one. Larger sizes are taken for garbage.
+const maxResyncMessageSize = 16 << 20
+
+// SkippedRange is a range of input bytes skipped in recovery mode to get past
+// a corrupt or truncated message.
+type SkippedRange struct {
+	Start, End int64 // byte offsets in the input, End excluded
+	Err        error // error that caused the bytes to be skipped
+}
+
+/** plausible reports whether body looks like the body of a message, as
+ * opposed to bytes picked in the middle of one. */
+func plausible(body []byte, q Quirks) bool {
+	if len(body) < 2 || len(body) > maxResyncMessageSize {
+		return false
+	}
+	partCount := q.order().Uint16(body[0:2])
+	return partCount > 0 && 2+4*uint64(partCount) <= uint64(len(body))
+}
+
+/** plausiblePrefix reports whether b may be the start of a message body,
+ * the parts it holds entirely being valid. */
+func plausiblePrefix(b []byte, q Quirks) bool {
+	if len(b) < 2 {
+		return true
+	}
+	partCount := q.order().Uint16(b[0:2])
+	if partCount == 0 {
+		return false
+	}
+
+	off := uint32(2)
+	for ; partCount > 0; partCount-- {
+		_, size, err := readPart(b, off, q)
+		if err != nil {
+			return errors.Is(err, ErrTruncatedMessage)
+		}
+		off += 2 + size
+	}
+	return true
+}
+
+/** messageAt decodes the message starting at off in b and returns it along
+ * with its body and the anomalies found, located in the body. */
+func messageAt(b []byte, off uint32, lenient bool, o *ParseOptions) (Message, []byte, []Warning, error) {
+	if err := need(b, off, 4); err != nil {
+		return Message{}, nil, nil, err
+	}
+	totalSize := o.Quirks.order().Uint32(b[off : off+4])
+	if err := o.checkMessageSize(totalSize); err != nil {
+		return Message{}, nil, nil, atOffset(err, int64(off))
+	}
+	if err := need(b, off+4, totalSize); err != nil {
+		return Message{}, nil, nil, atOffset(ErrTruncatedMessage, int64(off))
+	}
+
+	body := b[off+4 : off+4+totalSize]
+	m, warnings, err := decodeMessage(body, lenient, o)
+	if err != nil {
+		return m, body, nil, atOffset(err, int64(off)+4)
+	}
+	return m, body, warnings, nil
+}
+
+/** resync returns the offset of the first plausible message found at or
+ * after off in b, or len(b) if there is none. */
+func resync(b []byte, off uint32, o *ParseOptions) uint32 {
+	for ; uint64(off)+4 <= uint64(len(b)); off++ {
+		if _, body, _, err := messageAt(b, off, false, o); err == nil && plausible(body, o.Quirks) {
+			return off
+		}
+	}
+	return uint32(len(b))
+}
+
+/** skipped reports r to the recovery callback and diagnostics logger of o. */
+func (o *ParseOptions) skipped(r SkippedRange) {
+	if o.OnSkip != nil {
+		o.OnSkip(r)
+	}
+	if o.Diagnostics != nil {
+		o.Diagnostics.Warn("nslogger: skipped bytes", "start", r.Start, "end", r.End, "err", r.Err)
+	}
+}
+
+/** unread pushes b back in front of the rest of the stream. */
+func (d *Decoder) unread(b []byte) {
+	d.r = io.MultiReader(bytes.NewReader(append([]byte(nil), b...)), d.r)
+}
+
+/** recover decodes the next message of the stream in recovery mode: after a
+ * corrupt or truncated message it moves forward one byte at a time until a
+ * plausible message decodes, and reports the bytes skipped to get there. */
+func (d *Decoder) recover() (*Message, error) {
+	var skip *SkippedRange
+	for {
+		offset := d.offset
+		m, raw, err := d.read(skip != nil)
+		if err == nil || (len(raw) == 0 && err == io.EOF) {
+			if skip != nil {
+				skip.End = offset
+				d.o.skipped(*skip)
+			}
+			return m, err
+		}
+		if len(raw) == 0 || !isDecodeError(err) {
+			return nil, err
+		}
+
+		if skip == nil {
+			skip = &SkippedRange{Start: offset, Err: err}
+		}
+		d.unread(raw[1:])
+		d.offset = offset + 1
+	}
+}
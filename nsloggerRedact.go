@@ -0,0 +1,90 @@
+package nslogger
+
+import "regexp"
+
+// Built-in detectors of sensitive content for Redaction. Where a detector
+// has a capture group, only the text it matches is masked.
+var (
+	RedactEmails = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`)
+
+	// RedactPhoneNumbers matches international numbers starting with a plus
+	// sign and North American numbers such as "(555) 123-4567", but not dates
+	// or unseparated runs of digits.
+	RedactPhoneNumbers = regexp.MustCompile(`\+\d{1,3}(?:[ .\-]?\(?\d{1,4}\)?){2,5}|(?:\(\d{3}\) ?|\b\d{3}[ .\-]?)\d{3}[ .\-]\d{4}\b`)
+
+	RedactBearerTokens = regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]+=*)`)
+)
+
+// DefaultRedactionMask replaces the sensitive content of messages when
+// Redaction.Mask is empty.
+const DefaultRedactionMask = "[REDACTED]"
+
+// Redaction masks sensitive content in the text of messages, so that
+// captures from real devices can be attached to public bug trackers.
+type Redaction struct {
+	// Patterns are the detectors of sensitive content, such as RedactEmails,
+	// RedactPhoneNumbers, RedactBearerTokens or application specific ones.
+	// The text of patterns with capture groups is masked only in the groups.
+	Patterns []*regexp.Regexp
+
+	Mask string // replaces sensitive content, DefaultRedactionMask if empty
+}
+
+// DefaultRedaction masks email addresses, phone numbers and bearer tokens.
+func DefaultRedaction() Redaction {
+	return Redaction{Patterns: []*regexp.Regexp{RedactEmails, RedactPhoneNumbers, RedactBearerTokens}}
+}
+
+// WithRedaction masks the content matching the patterns of r in the text of
+// the messages kept, before they are output or exported. Other fields, and
+// image and binary payloads, are left as they are.
+func WithRedaction(r Redaction) Option {
+	return func(o *ParseOptions) {
+		o.Redaction = &r
+	}
+}
+
+// Redact returns s with its content matching the patterns of r masked.
+func (r *Redaction) Redact(s string) string {
+	mask := r.Mask
+	if mask == "" {
+		mask = DefaultRedactionMask
+	}
+	for _, re := range r.Patterns {
+		if re.NumSubexp() == 0 {
+			s = re.ReplaceAllLiteralString(s, mask)
+			continue
+		}
+		s = redactGroups(re, s, mask)
+	}
+	return s
+}
+
+/** redactGroups returns s with the text of the capture groups of the matches
+ * of re replaced by mask. */
+func redactGroups(re *regexp.Regexp, s, mask string) string {
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+	var b []byte
+	last := 0
+	for _, loc := range matches {
+		for g := 2; g < len(loc); g += 2 {
+			if loc[g] < last {
+				continue // unmatched group, or nested in one masked already
+			}
+			b = append(b, s[last:loc[g]]...)
+			b = append(b, mask...)
+			last = loc[g+1]
+		}
+	}
+	return string(append(b, s[last:]...))
+}
+
+/** redact masks the sensitive content of the text of m. */
+func (o *ParseOptions) redact(m *Message) {
+	if o.Redaction != nil && m.Payload != "" {
+		m.Payload = o.Redaction.Redact(m.Payload)
+	}
+}
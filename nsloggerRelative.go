@@ -0,0 +1,69 @@
+package nslogger
+
+import (
+	"strconv"
+	"time"
+)
+
+// WithRelativeTimes sets the Elapsed and Delta fields of messages: the time
+// since the first message of the capture, or of the connection for a
+// Listener, and the time since the previous message output. Text, table, CSV
+// and logfmt output then show them in their elapsed and delta columns in
+// place of the time column, unless other columns are set with WithColumns.
+// When debugging performance issues, the delta between consecutive lines
+// matters more than the wall-clock time.
+func WithRelativeTimes() Option {
+	return func(o *ParseOptions) {
+		o.RelativeTimes = true
+	}
+}
+
+/** relativeTimes holds the times messages are relative to in a decoding. */
+type relativeTimes struct {
+	start    time.Time // of the first message decoded
+	previous time.Time // of the last message kept
+}
+
+/** setElapsed sets the elapsed time of m, the first message of a
+ * decoding being the start of its capture. */
+func (o *ParseOptions) setElapsed(m *Message) {
+	if !o.RelativeTimes {
+		return
+	}
+	if o.relative == nil {
+		o.relative = &relativeTimes{start: m.Timestamp}
+	}
+	m.Elapsed = m.Timestamp.Sub(o.relative.start)
+}
+
+/** setDelta sets the time elapsed since the previous message kept on m, 0
+ * for the first one. */
+func (o *ParseOptions) setDelta(m *Message) {
+	if !o.RelativeTimes {
+		return
+	}
+	if !o.relative.previous.IsZero() {
+		m.Delta = m.Timestamp.Sub(o.relative.previous)
+	}
+	o.relative.previous = m.Timestamp
+}
+
+/** relativeColumns returns columns with the time column replaced by the
+ * elapsed and delta columns. */
+func relativeColumns(columns []string) []string {
+	var list []string
+	for _, name := range columns {
+		if name == "time" {
+			list = append(list, "elapsed", "delta")
+		} else {
+			list = append(list, name)
+		}
+	}
+	return list
+}
+
+/** formatSeconds formats d as a number of seconds with microseconds, as
+ * NSLogger clients record timestamps. */
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 6, 64)
+}
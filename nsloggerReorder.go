@@ -0,0 +1,80 @@
+package nslogger
+
+// WithReorder re-sorts messages by client sequence number before outputting
+// them, as delivered out of order after reconnections or by client-side
+// buffering. Up to window messages are held back: a message arriving more than
+// window messages late is output where it arrived. Client info messages, and
+// messages without sequence numbers such as marks, are output in place, the
+// messages held back before them being output first.
+func WithReorder(window int) Option {
+	return func(o *ParseOptions) {
+		o.Reorder = window
+	}
+}
+
+/** decodedMessage is a message along with the anomalies found decoding it,
+ * located in its body starting at offset body. */
+type decodedMessage struct {
+	msg      *Message
+	warnings []Warning
+	body     int64
+}
+
+/** reorderer holds back messages to release them in sequence order. With a
+ * window of 0, messages are released as they are pushed. */
+type reorderer struct {
+	window int
+	held   []decodedMessage // sorted by sequence number
+	ready  []decodedMessage // released messages, in order
+	next   int              // index of the next message of ready to pop
+}
+
+/** sequenced reports whether m is ordered by its sequence number. */
+func sequenced(m *Message) bool {
+	return m.Seq != 0 && (m.Type == LogmsgTypeLog || m.Type == LogmsgTypeBlockstart || m.Type == LogmsgTypeBlockend ||
+		m.Type == LogmsgTypeMark)
+}
+
+/** push adds dm, releasing the lowest message held if the window is full. */
+func (r *reorderer) push(dm decodedMessage) {
+	if !sequenced(dm.msg) {
+		r.flush()
+		r.ready = append(r.ready, dm)
+		return
+	}
+
+	i := len(r.held)
+	for i > 0 && r.held[i-1].msg.Seq > dm.msg.Seq {
+		i--
+	}
+	r.held = append(r.held, decodedMessage{})
+	copy(r.held[i+1:], r.held[i:])
+	r.held[i] = dm
+
+	if len(r.held) > r.window {
+		r.ready = append(r.ready, r.held[0])
+		r.held = append(r.held[:0], r.held[1:]...)
+	}
+}
+
+/** flush releases all the messages held, reporting whether there were any. */
+func (r *reorderer) flush() bool {
+	if len(r.held) == 0 {
+		return false
+	}
+	r.ready = append(r.ready, r.held...)
+	r.held = r.held[:0]
+	return true
+}
+
+/** pop returns the next message released, if any. */
+func (r *reorderer) pop() (decodedMessage, bool) {
+	if r.next == len(r.ready) {
+		r.ready, r.next = r.ready[:0], 0
+		return decodedMessage{}, false
+	}
+	dm := r.ready[r.next]
+	r.ready[r.next] = decodedMessage{}
+	r.next++
+	return dm, true
+}
@@ -0,0 +1,86 @@
+package nslogger
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// ReplayOptions sets the pace at which Replay sends messages.
+type ReplayOptions struct {
+	// Timing waits between messages as long as elapsed between them when
+	// they were logged, rather than sending them at once.
+	Timing bool
+
+	Speed    float64       // with Timing, factor the waits are divided by, e.g. 10 to replay 10 times faster; 0 is 1
+	MaxDelay time.Duration // with Timing, if not zero, longest wait between two messages, to skip idle periods
+}
+
+// Replay reads the capture r and writes its messages verbatim to w, usually
+// a connection to a desktop viewer, so that archived captures can be
+// inspected with it:
+//
+//	conn, err := tls.Dial("tcp", "localhost:50000", &tls.Config{InsecureSkipVerify: true})
+//	...
+//	n, err := nslogger.Replay(ctx, conn, f, nslogger.ReplayOptions{Timing: true})
+//
+// It returns the number of messages written. Replay stops when ctx is done,
+// returning its error.
+func Replay(ctx context.Context, w io.Writer, r io.Reader, opts ReplayOptions) (int, error) {
+	speed := opts.Speed
+	if speed <= 0 {
+		speed = 1
+	}
+
+	d := NewDecoder(r)
+	var frame []byte
+	d.record = func(header, body []byte, m *Message) {
+		frame = append(append(frame[:0], header...), body...)
+	}
+
+	var last time.Time // timestamp of the last message written
+	n := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		m, err := d.next()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+
+		if opts.Timing && m.Timestamp.After(last) {
+			// Messages logged out of order are sent without waiting
+			if !last.IsZero() {
+				delay := time.Duration(float64(m.Timestamp.Sub(last)) / speed)
+				if opts.MaxDelay > 0 && delay > opts.MaxDelay {
+					delay = opts.MaxDelay
+				}
+				if err := sleep(ctx, delay); err != nil {
+					return n, err
+				}
+			}
+			last = m.Timestamp
+		}
+
+		if _, err := w.Write(frame); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+/** sleep waits for d, or until ctx is done. */
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
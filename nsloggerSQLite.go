@@ -0,0 +1,181 @@
+package nslogger
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+)
+
+// SQLiteDriver is the database/sql driver used by ExportSQLite. This package
+// does not depend on any: the driver must be registered by importing a
+// SQLite driver package, such as github.com/mattn/go-sqlite3 ("sqlite3") or
+// modernc.org/sqlite ("sqlite").
+var SQLiteDriver = "sqlite3"
+
+// SQLTimeLayout is the layout of the times stored by ExportSQL, in UTC, as
+// understood by the SQLite date and time functions.
+const SQLTimeLayout = "2006-01-02 15:04:05.000000"
+
+/** sqlSchema creates the tables filled by ExportSQL. */
+var sqlSchema = []string{
+	`CREATE TABLE IF NOT EXISTS clients (
+	id INTEGER PRIMARY KEY,
+	name TEXT,
+	version TEXT,
+	os_name TEXT,
+	os_version TEXT,
+	model TEXT,
+	unique_id TEXT
+)`,
+	`CREATE TABLE IF NOT EXISTS logs (
+	id INTEGER PRIMARY KEY,
+	seq INTEGER,
+	type INTEGER,
+	time TEXT,
+	thread TEXT,
+	tag TEXT,
+	level INTEGER,
+	level_name TEXT,
+	message TEXT,
+	binary BLOB,
+	file TEXT,
+	line INTEGER,
+	function TEXT,
+	depth INTEGER,
+	session INTEGER,
+	source TEXT,
+	client_id INTEGER REFERENCES clients(id)
+)`,
+	`CREATE TABLE IF NOT EXISTS images (
+	log_id INTEGER REFERENCES logs(id),
+	width INTEGER,
+	height INTEGER,
+	data BLOB
+)`,
+	`CREATE INDEX IF NOT EXISTS logs_time ON logs(time)`,
+	`CREATE INDEX IF NOT EXISTS logs_tag ON logs(tag)`,
+}
+
+// ExportSQLite writes msgs to the SQLite database file at path, created if
+// needed, with ExportSQL. The SQLiteDriver driver must be registered, e.g.
+// for the pure Go driver of modernc.org/sqlite:
+//
+//	import _ "modernc.org/sqlite"
+//
+//	nslogger.SQLiteDriver = "sqlite"
+//	err := nslogger.ExportSQLite("capture.db", msgs)
+func ExportSQLite(path string, msgs []Message) error {
+	if !slices.Contains(sql.Drivers(), SQLiteDriver) {
+		return fmt.Errorf("nslogger: SQL driver %q not registered, import a SQLite driver package such as modernc.org/sqlite and set SQLiteDriver to its name", SQLiteDriver)
+	}
+	db, err := sql.Open(SQLiteDriver, path)
+	if err != nil {
+		return err
+	}
+	if err := ExportSQL(db, msgs); err != nil {
+		db.Close()
+		return err
+	}
+	return db.Close()
+}
+
+// ExportSQL writes msgs to db in a single transaction, so that captures can
+// be queried with SQL, e.g. to count errors per minute:
+//
+//	SELECT strftime('%Y-%m-%d %H:%M', time) AS minute, count(*)
+//	FROM logs WHERE type = 0 AND level = 0 GROUP BY minute
+//
+// Messages are stored in the logs table, their times in UTC with
+// SQLTimeLayout. The clients table holds the client infos, referenced by the
+// client_id column of the messages they sent, and the images table the image
+// payloads, referenced by log_id. Tables are created if needed, and messages
+// appended to those already exported.
+func ExportSQL(db *sql.DB, msgs []Message) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := exportSQL(tx, msgs); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func exportSQL(tx *sql.Tx, msgs []Message) error {
+	for _, stmt := range sqlSchema {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	insertClient, err := tx.Prepare(`INSERT INTO clients (name, version, os_name, os_version, model, unique_id) VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insertClient.Close()
+	insertLog, err := tx.Prepare(`INSERT INTO logs (seq, type, time, thread, tag, level, level_name, message, binary, file, line, function, depth, session, source, client_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insertLog.Close()
+	insertImage, err := tx.Prepare(`INSERT INTO images (log_id, width, height, data) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insertImage.Close()
+
+	// Captures only attach the client info to the client info message: it
+	// applies to the following messages of the same session, as stored in
+	// the logs table, and of the same capture when merged.
+	type session struct {
+		id     uint64
+		source string
+	}
+	clients := make(map[ClientInfo]int64)
+	current := make(map[session]sql.NullInt64)
+	for i := range msgs {
+		m := &msgs[i]
+
+		if m.Client != nil {
+			id, ok := clients[*m.Client]
+			if !ok {
+				c := m.Client
+				res, err := insertClient.Exec(c.Name, c.Version, c.OSName, c.OSVersion, c.Model, c.UniqueID)
+				if err != nil {
+					return err
+				}
+				if id, err = res.LastInsertId(); err != nil {
+					return err
+				}
+				clients[*c] = id
+			}
+			current[session{m.SessionID, m.Source}] = sql.NullInt64{Int64: id, Valid: true}
+		}
+
+		res, err := insertLog.Exec(m.Seq, m.Type, m.Timestamp.UTC().Format(SQLTimeLayout),
+			sqlText(m.ThreadID), sqlText(m.Tag), m.Level, sqlText(m.LevelName), sqlText(m.Payload), m.Binary,
+			sqlText(m.Filename), m.LineNumber, sqlText(m.FunctionName), m.Depth, int64(m.SessionID),
+			sqlText(m.Source), current[session{m.SessionID, m.Source}])
+		if err != nil {
+			return err
+		}
+
+		if m.Image != nil {
+			id, err := res.LastInsertId()
+			if err != nil {
+				return err
+			}
+			if _, err := insertImage.Exec(id, m.ImageWidth, m.ImageHeight, m.Image); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+/** sqlText stores empty strings as NULL. */
+func sqlText(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,82 @@
+package nslogger
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Sampling thins out the log messages of extremely chatty clients, so that
+// they do not overwhelm the sinks messages are sent to. Only log messages are
+// sampled: client info, blocks, marks and disconnects are always kept. The
+// criteria apply in order to the messages passing the filters.
+type Sampling struct {
+	Every int // keep one log message out of Every, all if 0 or 1
+
+	// TagRates are the probabilities, between 0 and 1, of keeping the log
+	// messages of tags, e.g. 0.1 to keep one in ten on average. Messages of
+	// other tags are kept.
+	TagRates map[string]float64
+
+	// PerSecond, if not zero, is the maximum number of log messages kept per
+	// second, the second messages were logged in.
+	PerSecond int
+
+	Seed int64 // seed of the random choices of TagRates, from the current time if 0
+}
+
+// WithSampling keeps only a sample of log messages, as set by s. Each
+// decoding, and each connection of a Listener, is sampled on its own.
+func WithSampling(s Sampling) Option {
+	return func(o *ParseOptions) {
+		o.Sampling = &s
+		o.sampler = nil
+	}
+}
+
+/** sampler holds the sampling state of a decoding. */
+type sampler struct {
+	s      *Sampling
+	rand   *rand.Rand
+	n      int       // log messages seen, for Every
+	second time.Time // second of the messages counted in kept
+	kept   int       // log messages kept in second
+}
+
+/** sample reports whether the log message m is kept by the sampling of o. */
+func (o *ParseOptions) sample(m *Message) bool {
+	if o.Sampling == nil || m.Type != LogmsgTypeLog {
+		return true
+	}
+	if o.sampler == nil || o.sampler.s != o.Sampling {
+		seed := o.Sampling.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		o.sampler = &sampler{s: o.Sampling, rand: rand.New(rand.NewSource(seed))}
+	}
+	return o.sampler.keep(m)
+}
+
+func (sp *sampler) keep(m *Message) bool {
+	s := sp.s
+	if s.Every > 1 {
+		sp.n++
+		if (sp.n-1)%s.Every != 0 {
+			return false
+		}
+	}
+	if rate, ok := s.TagRates[m.Tag]; ok && sp.rand.Float64() >= rate {
+		return false
+	}
+	if s.PerSecond > 0 {
+		second := m.Timestamp.Truncate(time.Second)
+		if !second.Equal(sp.second) {
+			sp.second, sp.kept = second, 0
+		}
+		if sp.kept >= s.PerSecond {
+			return false
+		}
+		sp.kept++
+	}
+	return true
+}
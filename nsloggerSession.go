@@ -0,0 +1,144 @@
+package nslogger
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// Session is a client connection to a Listener, or the datagrams a client
+// sends to it over UDP.
+type Session struct {
+	ID         uint64 // unique within the listener, starting at 1
+	RemoteAddr net.Addr
+	Start      time.Time
+
+	// Messages delivers the messages received on this connection only, when
+	// the Listener has a SessionHandler. It is closed after the disconnect
+	// message.
+	Messages <-chan *Message
+
+	conn        net.Conn
+	ch          chan *Message
+	mu          sync.Mutex
+	client      *ClientInfo
+	clientFrame []byte // frame of the last client info message, for recorders started later
+	threads     threadTracker
+	messages    int64
+	rate        rateMeter
+	stitched    *stitchedClient // client s is a connection of, with Listener.StitchSessions, only used by the goroutine serving s
+	packets     bool            // the client sends datagrams to Listener.ServeUDP
+}
+
+// ClientInfo returns the description the client sent of itself, or nil if it
+// was not received yet.
+func (s *Session) ClientInfo() *ClientInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.client
+}
+
+// Threads returns the summaries of the threads of the client that logged the
+// messages received so far, in order of their first message.
+func (s *Session) Threads() []Thread {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.threads.summary()
+}
+
+// MessageCount returns the number of messages received so far, including
+// those the options of the listener filter out.
+func (s *Session) MessageCount() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.messages
+}
+
+// Rate returns the number of messages received per second, averaged over the
+// last RateWindow.
+func (s *Session) Rate() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rate.rate(time.Now())
+}
+
+/** addThread records m in the thread summaries of s. */
+func (s *Session) addThread(m *Message) {
+	s.mu.Lock()
+	s.threads.add(m)
+	s.mu.Unlock()
+}
+
+/** sessionID returns the SessionID of the messages of s, that of the first
+ * connection of its client when stitched. */
+func (s *Session) sessionID() uint64 {
+	if s.stitched != nil {
+		return s.stitched.sessionID
+	}
+	return s.ID
+}
+
+/** received counts a message received, whether or not filtered out. */
+func (s *Session) received(now time.Time) {
+	s.mu.Lock()
+	s.messages++
+	s.rate.add(now)
+	s.mu.Unlock()
+}
+
+/** setClientFrame keeps a copy of the frame of the client info message of
+ * the session. */
+func (s *Session) setClientFrame(header, body []byte) {
+	s.mu.Lock()
+	s.clientFrame = append(append(s.clientFrame[:0], header...), body...)
+	s.mu.Unlock()
+}
+
+func (s *Session) setClientInfo(c *ClientInfo) {
+	s.mu.Lock()
+	s.client = c
+	s.mu.Unlock()
+}
+
+// RateWindow is the time window message rates are averaged over.
+const RateWindow = 10 * time.Second
+
+/** rateMeter counts events per second over the last RateWindow. */
+type rateMeter struct {
+	counts [int(RateWindow/time.Second) + 1]int64 // per second, including the current one, a ring
+	sec    int64                                  // Unix time of the current second
+}
+
+/** add counts an event at now. */
+func (r *rateMeter) add(now time.Time) {
+	r.advance(now.Unix())
+	r.counts[r.sec%int64(len(r.counts))]++
+}
+
+/** rate returns the number of events per second over the full seconds of
+ * the window ending at now. */
+func (r *rateMeter) rate(now time.Time) float64 {
+	r.advance(now.Unix())
+	var n int64
+	for i, c := range r.counts {
+		if int64(i) != r.sec%int64(len(r.counts)) {
+			n += c
+		}
+	}
+	return float64(n) / RateWindow.Seconds()
+}
+
+/** advance moves the current second to sec, clearing the seconds past. */
+func (r *rateMeter) advance(sec int64) {
+	if sec <= r.sec {
+		return
+	}
+	if sec-r.sec >= int64(len(r.counts)) {
+		r.counts = [len(r.counts)]int64{}
+	} else {
+		for t := r.sec + 1; t <= sec; t++ {
+			r.counts[t%int64(len(r.counts))] = 0
+		}
+	}
+	r.sec = sec
+}
@@ -0,0 +1,89 @@
+package nslogger
+
+import (
+	"context"
+	"errors"
+)
+
+// Shutdown gracefully shuts the listener down, so that it can be restarted
+// during deployments without losing the last messages of its clients. It
+// stops accepting connections and datagrams, notifies the connected clients
+// by closing the sending side of their connections, or with a close frame
+// for WebSocket clients, and keeps decoding what they sent until they close
+// their connections. Once all sessions have ended and their messages are
+// delivered, it stops recording and calls the functions registered with
+// RegisterOnShutdown, such as the Close method of a LokiPusher.
+//
+// If ctx is done first, the remaining connections are closed as by Close,
+// and Shutdown returns the error of ctx. Otherwise it returns the errors of
+// the recorder and of the functions registered. Serve, ServeUDP and
+// ListenAndServe return ErrListenerClosed as soon as Shutdown is called:
+// programs must wait for Shutdown to return before exiting.
+func (l *Listener) Shutdown(ctx context.Context) error {
+	l.mu.Lock()
+	l.closed = true
+	if l.ln != nil {
+		l.ln.Close()
+	}
+	if l.pc != nil {
+		l.pc.Close()
+	}
+	if l.adv != nil {
+		l.adv.Close()
+	}
+	sessions := make([]*Session, 0, len(l.sessions))
+	for _, s := range l.sessions {
+		sessions = append(sessions, s)
+	}
+	l.mu.Unlock()
+	for _, s := range sessions {
+		s.drain()
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(drained)
+	}()
+	var errs []error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		l.Close()
+		errs = append(errs, ctx.Err())
+	}
+
+	if err := l.StopRecording(); err != nil {
+		errs = append(errs, err)
+	}
+	l.mu.Lock()
+	onShutdown := l.onShutdown
+	l.mu.Unlock()
+	for _, f := range onShutdown {
+		if err := f(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RegisterOnShutdown registers a function for Shutdown to call once all
+// sessions have ended, to flush and close the sinks messages are handled
+// with.
+func (l *Listener) RegisterOnShutdown(f func() error) {
+	l.mu.Lock()
+	l.onShutdown = append(l.onShutdown, f)
+	l.mu.Unlock()
+}
+
+/** drain notifies the client of s that the listener shuts down, the session
+ * ending once the client closes its connection or, for UDP sessions, once
+ * the datagrams received are decoded. */
+func (s *Session) drain() {
+	switch c := s.conn.(type) {
+	case interface{ drain() }:
+		c.drain()
+	case interface{ CloseWrite() error }:
+		c.CloseWrite()
+	}
+}
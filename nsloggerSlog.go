@@ -0,0 +1,177 @@
+package nslogger
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// SlogOptions configures a SlogHandler.
+type SlogOptions struct {
+	// Level is the minimum level of the records handled, slog.LevelInfo if nil.
+	Level slog.Leveler
+
+	// TagKey is the key of the attribute used as message tag, "tag" if empty.
+	TagKey string
+
+	// AttrKeys maps attribute keys to the user-defined part keys (from
+	// PartKeyUserDefined) under which they are also sent as separate parts,
+	// for viewers extended to display them. Attributes of groups have their
+	// keys prefixed with the group names, separated by dots.
+	AttrKeys map[string]uint8
+}
+
+// SlogHandler is a slog.Handler sending log records to an NSLogger viewer
+// through a Logger. Record levels are mapped to NSLogger levels and attributes
+// are appended to the message text as key=value pairs.
+type SlogHandler struct {
+	l      *Logger
+	opts   SlogOptions
+	attrs  []slogAttr
+	prefix string // dotted names of the open groups
+}
+
+/** slogAttr is an attribute flattened out of its groups. */
+type slogAttr struct {
+	key   string
+	value slog.Value
+}
+
+// NewSlogHandler returns a handler sending records through l. opts may be nil.
+func NewSlogHandler(l *Logger, opts *SlogOptions) *SlogHandler {
+	h := &SlogHandler{l: l}
+	if opts != nil {
+		h.opts = *opts
+	}
+	if h.opts.TagKey == "" {
+		h.opts.TagKey = "tag"
+	}
+	return h
+}
+
+// Enabled reports whether records of the given level are handled.
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	min := slog.LevelInfo
+	if h.opts.Level != nil {
+		min = h.opts.Level.Level()
+	}
+	return level >= min
+}
+
+// Handle sends r to the viewer.
+func (h *SlogHandler) Handle(_ context.Context, r slog.Record) error {
+	m := &Message{
+		Type:      LogmsgTypeLog,
+		Timestamp: r.Time,
+		Level:     slogLevel(r.Level),
+	}
+
+	if r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		m.Filename = frame.File
+		m.LineNumber = frame.Line
+		m.FunctionName = frame.Function
+	}
+
+	attrs := append([]slogAttr(nil), h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = flattenAttr(attrs, h.prefix, a)
+		return true
+	})
+
+	var text strings.Builder
+	text.WriteString(r.Message)
+	var parts []slogAttr
+	for _, a := range attrs {
+		if a.key == h.opts.TagKey {
+			m.Tag = a.value.String()
+			continue
+		}
+		if _, ok := h.opts.AttrKeys[a.key]; ok {
+			parts = append(parts, a)
+		}
+		text.WriteByte(' ')
+		text.WriteString(a.key)
+		text.WriteByte('=')
+		text.WriteString(attrText(a.value))
+	}
+	m.Payload = text.String()
+
+	return h.l.send(m, func(e *messageEncoder) {
+		for _, a := range parts {
+			key := h.opts.AttrKeys[a.key]
+			if a.value.Kind() == slog.KindInt64 {
+				e.addInt64(key, a.value.Int64())
+			} else {
+				e.addString(key, a.value.String())
+			}
+		}
+	})
+}
+
+// WithAttrs returns a handler adding attrs to every record.
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = append([]slogAttr(nil), h.attrs...)
+	for _, a := range attrs {
+		h2.attrs = flattenAttr(h2.attrs, h.prefix, a)
+	}
+	return &h2
+}
+
+// WithGroup returns a handler nesting the following attributes in a group.
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+/** flattenAttr appends a to attrs, along with the attributes of its
+ * groups, their keys prefixed with prefix and the group names. */
+func flattenAttr(attrs []slogAttr, prefix string, a slog.Attr) []slogAttr {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return attrs
+	}
+
+	if a.Value.Kind() != slog.KindGroup {
+		return append(attrs, slogAttr{key: prefix + a.Key, value: a.Value})
+	}
+	if a.Key != "" {
+		prefix += a.Key + "."
+	}
+	for _, ga := range a.Value.Group() {
+		attrs = flattenAttr(attrs, prefix, ga)
+	}
+	return attrs
+}
+
+/** attrText formats v as the value of a key=value pair, quoted when needed
+ * to keep the pairs apart. */
+func attrText(v slog.Value) string {
+	s := v.String()
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+/** slogLevel maps a slog level to the nearest NSLogger level. */
+func slogLevel(l slog.Level) int {
+	switch {
+	case l >= slog.LevelError:
+		return LevelError
+	case l >= slog.LevelWarn:
+		return LevelWarning
+	case l >= slog.LevelInfo:
+		return LevelInfo
+	case l >= slog.LevelDebug:
+		return LevelDebug
+	}
+	return LevelVerbose
+}
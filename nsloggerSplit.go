@@ -0,0 +1,209 @@
+package nslogger
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SplitOptions sets how a Splitter partitions messages. Limits that are zero
+// do not apply; with none, a single file is written per tag, or in all.
+type SplitOptions struct {
+	MaxMessages int           // maximum number of messages per file
+	MaxSize     int64         // maximum size per file in bytes, a file holding at least one message
+	Window      time.Duration // time window per file, aligned on multiples of Window, e.g. on hours
+	ByTag       bool          // write the messages of each tag to files of their own
+}
+
+// Splitter writes messages to a series of smaller capture files, each of them
+// a valid capture the desktop viewer opens: files start with the client info
+// message of the messages they hold, and client info and disconnect messages
+// are written to the files of all tags.
+//
+// Files are named after a base name: "app.rawnsloggerdata" is split into
+// "app-001.rawnsloggerdata", "app-002.rawnsloggerdata" and so on, and by tag
+// into "app-network-001.rawnsloggerdata", messages without a tag going to
+// "app-untagged-001.rawnsloggerdata". Base names with a .gz extension, e.g.
+// "app.rawnsloggerdata.gz", make gzip-compressed files.
+type Splitter struct {
+	Files []string // names of the files created, in order
+
+	base, ext string
+	opts      SplitOptions
+	client    *Message // last client info message
+	outputs   map[string]*splitOutput
+	tags      []string // keys of outputs, in order of creation
+}
+
+/** splitOutput is the file messages of a tag are currently written to. */
+type splitOutput struct {
+	w        *FileWriter
+	part     int       // number of the file, from 1
+	messages int       // number of messages written to the file
+	size     int64     // bytes written to the file
+	window   time.Time // start of the time window of the file
+}
+
+// NewSplitter returns a Splitter creating files named after base.
+func NewSplitter(base string, opts SplitOptions) *Splitter {
+	ext := filepath.Ext(base)
+	if ext == ".gz" {
+		ext = filepath.Ext(strings.TrimSuffix(base, ext)) + ext
+	}
+	if ext == "" {
+		ext = ".rawnsloggerdata"
+	}
+	return &Splitter{base: strings.TrimSuffix(base, ext), ext: ext, opts: opts,
+		outputs: make(map[string]*splitOutput)}
+}
+
+// Write writes m to the file of its tag, starting a new one if m exceeds the
+// limits of the current one.
+func (s *Splitter) Write(m *Message) error {
+	if m.Type == LogmsgTypeClientinfo {
+		s.client = m
+	}
+	if !s.opts.ByTag {
+		return s.writeTo("", m)
+	}
+
+	switch {
+	case m.Type == LogmsgTypeClientinfo || m.Type == LogmsgTypeDisconnect:
+		// Files created later start with the client info message
+		for _, tag := range s.tags {
+			if err := s.writeTo(tag, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	case m.Tag == "":
+		return s.writeTo("untagged", m)
+	}
+	return s.writeTo(m.Tag, m)
+}
+
+/** writeTo writes m to the output of tag, starting a new file as needed. */
+func (s *Splitter) writeTo(tag string, m *Message) error {
+	b := encodeMessage(m)
+	out := s.outputs[tag]
+	if out == nil {
+		out = &splitOutput{}
+		s.outputs[tag] = out
+		s.tags = append(s.tags, tag)
+	}
+
+	if out.w == nil || s.full(out, m, len(b)) {
+		if err := s.next(tag, out, m); err != nil {
+			return err
+		}
+	}
+	if _, err := out.w.bw.Write(b); err != nil {
+		return err
+	}
+	out.messages++
+	out.size += int64(len(b))
+	return nil
+}
+
+/** full reports whether m, of n bytes once encoded, must be written to the
+ * next file of out. */
+func (s *Splitter) full(out *splitOutput, m *Message, n int) bool {
+	if out.messages == 0 {
+		return false
+	}
+	o := s.opts
+	switch {
+	case o.MaxMessages > 0 && out.messages >= o.MaxMessages:
+		return true
+	case o.MaxSize > 0 && out.size+int64(n) > o.MaxSize:
+		return true
+	case o.Window > 0 && !m.Timestamp.IsZero():
+		if out.window.IsZero() {
+			out.window = m.Timestamp.Truncate(o.Window)
+		}
+		return !m.Timestamp.Before(out.window.Add(o.Window))
+	}
+	return false
+}
+
+/** next closes the current file of out and creates the next one, starting
+ * with the last client info message unless m is one. */
+func (s *Splitter) next(tag string, out *splitOutput, m *Message) error {
+	if out.w != nil {
+		if err := out.w.Close(); err != nil {
+			return err
+		}
+	}
+
+	out.part++
+	name := fmt.Sprintf("%s-%03d%s", s.base, out.part, s.ext)
+	if tag != "" {
+		name = fmt.Sprintf("%s-%s-%03d%s", s.base, fileNamePart(tag), out.part, s.ext)
+	}
+	w, err := CreateFile(name)
+	if err != nil {
+		out.w = nil
+		return err
+	}
+	s.Files = append(s.Files, name)
+	*out = splitOutput{w: w, part: out.part}
+	if s.opts.Window > 0 && !m.Timestamp.IsZero() {
+		out.window = m.Timestamp.Truncate(s.opts.Window)
+	}
+
+	if s.client != nil && m.Type != LogmsgTypeClientinfo {
+		b := encodeMessage(s.client)
+		if _, err := w.bw.Write(b); err != nil {
+			return err
+		}
+		out.size += int64(len(b))
+	}
+	return nil
+}
+
+// Close closes the files still open.
+func (s *Splitter) Close() error {
+	var err error
+	for _, tag := range s.tags {
+		if out := s.outputs[tag]; out.w != nil {
+			if cerr := out.w.Close(); err == nil {
+				err = cerr
+			}
+			out.w = nil
+		}
+	}
+	return err
+}
+
+// Split writes the messages decoded by d to files named after base, as
+// partitioned by opts. It returns the names of the files created.
+func Split(d *Decoder, base string, opts SplitOptions) ([]string, error) {
+	s := NewSplitter(base, opts)
+	for {
+		m, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			s.Close()
+			return s.Files, err
+		}
+		if err := s.Write(m); err != nil {
+			s.Close()
+			return s.Files, err
+		}
+	}
+	return s.Files, s.Close()
+}
+
+/** fileNamePart replaces the characters of s that are unsafe in file names. */
+func fileNamePart(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, s)
+}
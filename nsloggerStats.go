@@ -0,0 +1,136 @@
+package nslogger
+
+import (
+	"io"
+	"sort"
+	"time"
+)
+
+// Stats summarizes the content of a log stream. Tag, level and thread counts
+// only cover log messages (LogmsgTypeLog).
+type Stats struct {
+	Messages    int            // number of messages of all types
+	Lost        int            // number of messages missing from gaps in sequence numbers
+	Types       map[int]int    // message count per LogmsgType* value
+	Tags        map[string]int // log count per tag, untagged logs under ""
+	Levels      map[int]int    // log count per level
+	Threads     map[string]int // log count per thread
+	PerSecond   map[int64]int  // message count per Unix second
+	Images      int            // number of image messages
+	ImageBytes  int64          // total size of the images
+	BinaryBytes int64          // total size of the binary payloads
+	Start, End  time.Time      // timestamps of the earliest and latest messages
+
+	Blocks  int             // number of blocks ended
+	Slowest []BlockDuration // the StatsSlowestBlocks longest blocks, longest first
+
+	open []BlockDuration // blocks started and not ended yet, innermost last
+}
+
+// StatsSlowestBlocks is the number of longest blocks listed by Stats.
+const StatsSlowestBlocks = 10
+
+// NewStats returns empty statistics, ready to Add messages.
+func NewStats() *Stats {
+	return &Stats{
+		Types:     make(map[int]int),
+		Tags:      make(map[string]int),
+		Levels:    make(map[int]int),
+		Threads:   make(map[string]int),
+		PerSecond: make(map[int64]int),
+	}
+}
+
+// CollectStats reads d until the end of the stream and returns the statistics
+// of its messages.
+func CollectStats(d *Decoder) (*Stats, error) {
+	s := NewStats()
+	for {
+		m, err := d.Next()
+		if err == io.EOF {
+			return s, nil
+		}
+		if err != nil {
+			return s, err
+		}
+		s.Add(m)
+	}
+}
+
+// Add counts m in the statistics.
+func (s *Stats) Add(m *Message) {
+	s.Messages++
+	s.Lost += m.Lost
+	s.Types[m.Type]++
+	s.PerSecond[m.Timestamp.Unix()]++
+
+	if s.Start.IsZero() || m.Timestamp.Before(s.Start) {
+		s.Start = m.Timestamp
+	}
+	if m.Timestamp.After(s.End) {
+		s.End = m.Timestamp
+	}
+
+	switch m.Type {
+	case LogmsgTypeBlockstart:
+		s.open = append(s.open, BlockDuration{Label: m.Payload, Thread: m.ThreadID, Start: m.Timestamp,
+			Seq: m.Seq, Depth: len(s.open)})
+	case LogmsgTypeBlockend:
+		if len(s.open) > 0 {
+			b := s.open[len(s.open)-1]
+			s.open = s.open[:len(s.open)-1]
+			b.Duration = m.Timestamp.Sub(b.Start)
+			s.addBlock(b)
+		}
+	}
+
+	if m.Type != LogmsgTypeLog {
+		return
+	}
+	s.Tags[m.Tag]++
+	s.Levels[m.Level]++
+	s.Threads[m.ThreadID]++
+	if m.Image != nil {
+		s.Images++
+		s.ImageBytes += int64(len(m.Image))
+	}
+	s.BinaryBytes += int64(len(m.Binary))
+}
+
+// Duration returns the time elapsed between the earliest and latest messages.
+func (s *Stats) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// Histogram returns the number of messages logged during each interval of
+// the given length, the first one starting at s.Start.
+func (s *Stats) Histogram(interval time.Duration) []int {
+	if s.Messages == 0 || interval <= 0 {
+		return nil
+	}
+
+	start := s.Start.Unix()
+	step := int64(interval / time.Second)
+	if step < 1 {
+		step = 1
+	}
+	h := make([]int, (s.End.Unix()-start)/step+1)
+	for sec, n := range s.PerSecond {
+		h[(sec-start)/step] += n
+	}
+	return h
+}
+
+/** addBlock counts the ended block b, listing it if among the slowest. */
+func (s *Stats) addBlock(b BlockDuration) {
+	s.Blocks++
+	i := sort.Search(len(s.Slowest), func(i int) bool { return s.Slowest[i].Duration < b.Duration })
+	if i == StatsSlowestBlocks {
+		return
+	}
+	if len(s.Slowest) < StatsSlowestBlocks {
+		s.Slowest = append(s.Slowest, BlockDuration{})
+	}
+	copy(s.Slowest[i+1:], s.Slowest[i:])
+	s.Slowest[i] = b
+}
@@ -0,0 +1,141 @@
+package nslogger
+
+import "time"
+
+// WithStitching merges the reconnections of clients in captures holding the
+// messages of one client at a time, such as the recordings of a Listener: the
+// client info messages of clients reconnecting, recognized by their UniqueID,
+// are dropped, and so are the messages they resend after reconnecting, which
+// have the sequence number and timestamp of a message already decoded. To
+// stitch the connections received by a Listener, set its StitchSessions
+// field.
+func WithStitching() Option {
+	return func(o *ParseOptions) {
+		o.Stitching = true
+	}
+}
+
+// DefaultStitchTimeout is the time after which a Listener stitching sessions
+// forgets a client whose connections all closed, when its StitchTimeout is 0.
+const DefaultStitchTimeout = time.Hour
+
+/** stitchWindow is the number of the last messages of a client remembered
+ * to recognize those it resends after reconnecting. */
+const stitchWindow = 10000
+
+/** stitchedClient is a client whose reconnections are stitched into one
+ * logical session. */
+type stitchedClient struct {
+	sessionID uint64    // of the first connection of the client, for a Listener
+	conns     int       // number of open connections of the client, for a Listener
+	left      time.Time // when the last connection of the client closed, if none is open
+
+	// Timestamps of the last messages received, by sequence number, in two
+	// generations so that at least the last stitchWindow are remembered
+	seen, older map[int]time.Time
+}
+
+/** resent reports whether m is a message of c received already, remembering
+ * it otherwise. Sequence numbers restart when applications are relaunched,
+ * so messages are told apart by timestamp as well. */
+func (c *stitchedClient) resent(m *Message) bool {
+	if !sequenced(m) {
+		return false
+	}
+	if t, ok := c.seen[m.Seq]; ok && t.Equal(m.Timestamp) {
+		return true
+	}
+	if t, ok := c.older[m.Seq]; ok && t.Equal(m.Timestamp) {
+		return true
+	}
+	if c.seen == nil || len(c.seen) >= stitchWindow {
+		c.older, c.seen = c.seen, make(map[int]time.Time)
+	}
+	c.seen[m.Seq] = m.Timestamp
+	return false
+}
+
+/** leave records that a connection of c closed at t. */
+func (c *stitchedClient) leave(t time.Time) {
+	c.conns--
+	if c.conns == 0 {
+		c.left = t
+	}
+}
+
+/** stitcher holds the stitching state of a decoding. */
+type stitcher struct {
+	clients map[string]*stitchedClient // by UniqueID
+	current *stitchedClient            // client of the last client info message, if identified
+}
+
+/** stitch reports whether m is kept by the stitching of o. */
+func (o *ParseOptions) stitch(m *Message) bool {
+	if !o.Stitching {
+		return true
+	}
+	if o.stitcher == nil {
+		o.stitcher = &stitcher{clients: make(map[string]*stitchedClient)}
+	}
+	st := o.stitcher
+
+	if m.IsClientInfo() {
+		id := m.clientInfo().UniqueID
+		if id == "" {
+			st.current = nil
+			return true
+		}
+		c, reconnected := st.clients[id]
+		if !reconnected {
+			c = &stitchedClient{}
+			st.clients[id] = c
+		}
+		st.current = c
+		return !reconnected
+	}
+	return st.current == nil || !st.current.resent(m)
+}
+
+/** stitch returns the client s is a connection of when stitching sessions,
+ * described by its client info c, reporting whether it connected before, or
+ * nil if the client did not identify itself. Clients gone for longer than
+ * the stitch timeout are forgotten on the way. */
+func (l *Listener) stitch(s *Session, c *ClientInfo) (*stitchedClient, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if s.stitched != nil {
+		s.stitched.leave(now) // s described another client before
+	}
+	timeout := l.StitchTimeout
+	if timeout <= 0 {
+		timeout = DefaultStitchTimeout
+	}
+	for id, sc := range l.stitched {
+		if sc.conns == 0 && now.Sub(sc.left) > timeout {
+			delete(l.stitched, id)
+		}
+	}
+
+	if c == nil || c.UniqueID == "" {
+		return nil, false
+	}
+	sc, reconnected := l.stitched[c.UniqueID]
+	if !reconnected {
+		sc = &stitchedClient{sessionID: s.ID}
+		if l.stitched == nil {
+			l.stitched = make(map[string]*stitchedClient)
+		}
+		l.stitched[c.UniqueID] = sc
+	}
+	sc.conns++
+	return sc, reconnected
+}
+
+/** resent reports whether m was received already on an earlier connection of
+ * the stitched client sc. */
+func (l *Listener) resent(sc *stitchedClient, m *Message) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return sc.resent(m)
+}
@@ -0,0 +1,130 @@
+package nslogger
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultStoreSize is the number of messages a Store retains when neither
+// of its limits is set.
+const DefaultStoreSize = 10000
+
+// StoreOptions bounds the messages a Store retains. When both limits are
+// set, messages are dropped as soon as they exceed either.
+type StoreOptions struct {
+	MaxMessages int           // number of last messages retained
+	MaxAge      time.Duration // how long messages are retained after being added
+}
+
+// Store retains the last messages received by a live Listener in memory, so
+// that they can be queried, e.g. by a ListenerAPI or a WebViewer, without
+// writing them to disk. Its Add method is meant to be used as a Listener
+// handler:
+//
+//	s := nslogger.NewStore(nslogger.StoreOptions{MaxAge: 30 * time.Minute})
+//	l := &nslogger.Listener{Handler: s.Add}
+//
+// It is safe for concurrent use.
+type Store struct {
+	opts StoreOptions
+
+	mu    sync.Mutex
+	ring  []storedMessage // a ring once full
+	first int             // index of the oldest message
+	n     int             // number of messages retained
+}
+
+/** storedMessage is a message retained by a Store, with the time it was
+ * added, which MaxAge applies to rather than its timestamp, since the clocks
+ * of clients may be off. */
+type storedMessage struct {
+	m     *Message
+	added time.Time
+}
+
+// NewStore returns an empty Store retaining messages as set by opts.
+func NewStore(opts StoreOptions) *Store {
+	if opts.MaxMessages <= 0 && opts.MaxAge <= 0 {
+		opts.MaxMessages = DefaultStoreSize
+	}
+	return &Store{opts: opts}
+}
+
+// Add retains m, dropping the oldest messages beyond the limits of the
+// store. m must not be modified afterwards.
+func (s *Store) Add(m *Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.expire(now)
+	if s.opts.MaxMessages > 0 && s.n == s.opts.MaxMessages {
+		s.ring[s.first] = storedMessage{}
+		s.first = (s.first + 1) % len(s.ring)
+		s.n--
+	}
+	if s.n == len(s.ring) {
+		s.grow()
+	}
+	s.ring[(s.first+s.n)%len(s.ring)] = storedMessage{m, now}
+	s.n++
+}
+
+// Len returns the number of messages retained.
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(time.Now())
+	return s.n
+}
+
+// Messages returns the messages retained, oldest first.
+func (s *Store) Messages() []*Message {
+	return s.Query(nil, 0)
+}
+
+// Query returns the messages retained passing f, all if f is nil, oldest
+// first. If limit is not zero, only the last limit messages passing f are
+// returned.
+func (s *Store) Query(f *Filter, limit int) []*Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(time.Now())
+
+	var msgs []*Message
+	for i := s.n - 1; i >= 0 && (limit <= 0 || len(msgs) < limit); i-- {
+		m := s.ring[(s.first+i)%len(s.ring)].m
+		if f == nil || f.Match(m) {
+			msgs = append(msgs, m)
+		}
+	}
+	for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
+		msgs[i], msgs[j] = msgs[j], msgs[i]
+	}
+	return msgs
+}
+
+/** expire drops the messages older than MaxAge at now. */
+func (s *Store) expire(now time.Time) {
+	if s.opts.MaxAge <= 0 {
+		return
+	}
+	for s.n > 0 && now.Sub(s.ring[s.first].added) > s.opts.MaxAge {
+		s.ring[s.first] = storedMessage{}
+		s.first = (s.first + 1) % len(s.ring)
+		s.n--
+	}
+}
+
+/** grow enlarges the ring, which is full, up to MaxMessages. */
+func (s *Store) grow() {
+	size := max(2*len(s.ring), 64)
+	if s.opts.MaxMessages > 0 {
+		size = min(size, s.opts.MaxMessages)
+	}
+	ring := make([]storedMessage, size)
+	for i := 0; i < s.n; i++ {
+		ring[i] = s.ring[(s.first+i)%len(s.ring)]
+	}
+	s.ring, s.first = ring, 0
+}
@@ -0,0 +1,276 @@
+package nslogger
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Decoder reads messages one at a time from an NSLogger binary stream such as
+// a capture file or a client connection.
+type Decoder struct {
+	r      io.Reader
+	o      *ParseOptions
+	buf    []byte
+	offset int64 // offset of the next message in the stream
+	state  streamState
+	merge  *merger // sources of a Merge decoder
+
+	warnings []Warning // anomalies of the last message read, located in its body
+	body     int64     // offset of the body of the last message read
+
+	order    reorderer // messages held back by WithReorder
+	orderErr error     // error of the stream, returned after the messages held back
+
+	grep     *grepper
+	collapse *collapser
+	pending  []*Message // messages selected by grep, to be returned
+	started  bool       // grep and collapse are set up
+	sniffed  bool       // the stream was checked for compression
+
+	record func(header, body []byte, m *Message) // called with the frame of every message decoded, before options apply
+}
+
+/** streamState is the state carried from one message of a stream to the next. */
+type streamState struct {
+	client *ClientInfo
+	depth  int         // number of blocks currently open
+	starts []time.Time // start times of the blocks currently open, innermost last
+	seq    int         // sequence number of the last message of the client
+}
+
+/** update records m in the state and sets the fields of m depending on it.
+ * It returns the anomalies of m in the stream, located at its body. */
+func (s *streamState) update(m *Message) []Warning {
+	var warnings []Warning
+	switch m.Type {
+	case LogmsgTypeClientinfo:
+		s.client = m.Client
+		s.seq = 0
+	case LogmsgTypeBlockend:
+		if s.depth > 0 {
+			s.depth--
+			m.Duration = m.Timestamp.Sub(s.starts[s.depth])
+			s.starts = s.starts[:s.depth]
+		}
+	}
+
+	m.Depth = s.depth
+	if m.Type == LogmsgTypeBlockstart {
+		s.depth++
+		s.starts = append(s.starts, m.Timestamp)
+	}
+
+	// Clients number their marks along with their logs, but disconnections
+	// are added by the desktop viewer, out of sequence. s.seq stays the
+	// highest number seen, late messages not opening new gaps.
+	if m.Seq != 0 && m.Type != LogmsgTypeDisconnect {
+		switch {
+		case m.Seq <= s.seq:
+			warnings = append(warnings, Warning{Kind: WarningSeqOrder, Key: PartKeyMessageSeq,
+				Err: fmt.Errorf("sequence number %d following %d", m.Seq, s.seq)})
+			return warnings
+		case s.seq != 0 && m.Seq > s.seq+1:
+			m.Lost = m.Seq - s.seq - 1
+			warnings = append(warnings, Warning{Kind: WarningSeqGap, Key: PartKeyMessageSeq,
+				Err: fmt.Errorf("%d messages lost before sequence number %d", m.Lost, m.Seq)})
+		}
+		s.seq = m.Seq
+	}
+	return warnings
+}
+
+// NewDecoder returns a Decoder reading from r.
+func NewDecoder(r io.Reader, opts ...Option) *Decoder {
+	return &Decoder{r: r, o: newParseOptions(opts)}
+}
+
+// Next decodes the next message of the stream. It returns io.EOF at the end
+// of the stream. gzip-compressed streams are decompressed, the offsets of
+// decoding errors being those of the decompressed stream. If the stream ends
+// in the middle of a message, it returns an error wrapping
+// ErrTruncatedMessage in strict mode, and io.EOF otherwise. In recovery
+// mode, corrupt and truncated messages are skipped instead.
+func (d *Decoder) Next() (*Message, error) {
+	if !d.started {
+		d.grep, d.collapse = d.o.newGrepper(), d.o.newCollapser()
+		d.started = true
+	}
+
+	for {
+		for len(d.pending) > 0 {
+			m := d.pending[0]
+			d.pending = d.pending[1:]
+			if m != nil {
+				return m, nil
+			}
+		}
+
+		if err := d.o.canceled(); err != nil {
+			return nil, err
+		}
+		m, err := d.ordered()
+		keep := true
+		switch {
+		case err == io.EOF && d.collapse != nil && d.collapse.last != nil:
+			// The last run of identical messages ends with the stream
+			m = d.collapse.flush()
+		case err != nil:
+			return nil, err
+		default:
+			if d.merge == nil {
+				// Merged sources each keep their own state
+				d.o.warned(append(d.warnings, d.state.update(m)...), d.body)
+			}
+			if keep, err = d.o.process(m); err != nil {
+				return nil, err
+			}
+			if !keep {
+				d.o.release(m) // dropped by options
+			}
+			if keep && d.collapse != nil {
+				m = d.collapse.feed(m)
+				keep = m != nil
+			}
+		}
+		if keep && d.grep != nil {
+			d.pending = d.grep.feed(m)
+		} else if keep {
+			return m, nil
+		}
+	}
+}
+
+/** ordered returns the next message of the stream in sequence order, within
+ * the reordering window of o, with d.warnings and d.body set for it. */
+func (d *Decoder) ordered() (*Message, error) {
+	d.order.window = d.o.Reorder
+	for {
+		if dm, ok := d.order.pop(); ok {
+			d.warnings, d.body = dm.warnings, dm.body
+			return dm.msg, nil
+		}
+		if err := d.orderErr; err != nil {
+			d.orderErr = nil
+			return nil, err
+		}
+
+		m, err := d.next()
+		if err != nil {
+			if !d.order.flush() {
+				return nil, err
+			}
+			d.orderErr = err
+			continue
+		}
+		d.order.push(decodedMessage{msg: m, warnings: d.warnings, body: d.body})
+	}
+}
+
+/** next decodes the next message of the stream without applying options. */
+func (d *Decoder) next() (*Message, error) {
+	if d.merge != nil {
+		return d.merge.next()
+	}
+	if d.o.Recover {
+		return d.recover()
+	}
+	m, _, err := d.read(false)
+	return m, err
+}
+
+/** read reads and decodes the next message of the stream. It also returns
+ * the bytes consumed from the stream, which only a failed read needs. When
+ * scanning, message sizes too large to be plausible fail early. */
+func (d *Decoder) read(scanning bool) (*Message, []byte, error) {
+	offset := d.offset
+	header, body, raw, err := d.readFrame(scanning)
+	if err != nil {
+		return nil, raw, err
+	}
+
+	m := d.o.newMessage()
+	warnings, err := decodeMessageInto(m, body, d.o.Lenient && !scanning, d.o)
+	if err == nil && scanning && !plausible(body, d.o.Quirks) {
+		err = ErrCorruptPart
+	}
+	if err != nil {
+		return nil, append(header[:], body...), atOffset(err, offset+4)
+	}
+	d.warnings, d.body = warnings, offset+4
+	if d.record != nil {
+		d.record(header[:], body, m)
+	}
+
+	return m, nil, nil
+}
+
+/** readFrame reads the next message frame of the stream, returning its size
+ * header and body, valid until the next read. On failure, it returns the
+ * bytes consumed from the stream instead. */
+func (d *Decoder) readFrame(scanning bool) (header [4]byte, body, raw []byte, err error) {
+	if !d.sniffed {
+		d.sniffed = true
+		if d.offset == 0 {
+			if err := d.decompress(); err != nil {
+				return header, nil, nil, err
+			}
+		}
+	}
+
+	offset := d.offset
+	if n, err := io.ReadFull(d.r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			if d.o.ignoreTrailing() {
+				return header, nil, nil, io.EOF
+			}
+			err = atOffset(ErrTruncatedMessage, offset)
+		}
+		return header, nil, header[:n], err
+	}
+
+	totalSize := d.o.Quirks.order().Uint32(header[:])
+	if err := d.o.checkMessageSize(totalSize); err != nil {
+		return header, nil, header[:], atOffset(err, offset)
+	}
+	if scanning && totalSize > maxResyncMessageSize {
+		return header, nil, header[:], atOffset(ErrTruncatedMessage, offset)
+	}
+	body, err = d.readBody(totalSize)
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			if d.o.ignoreTrailing() {
+				return header, nil, nil, io.EOF
+			}
+			err = atOffset(ErrTruncatedMessage, offset)
+		}
+		return header, nil, append(header[:], body...), err
+	}
+	d.offset += 4 + int64(totalSize)
+	return header, body, nil, nil
+}
+
+// ClientInfo returns the description of the client that produced the stream,
+// as sent in its last client info message, or nil if none was received yet.
+func (d *Decoder) ClientInfo() *ClientInfo {
+	return d.state.client
+}
+
+/** readBody reads a message body of n bytes. Bodies larger than the buffer
+ * grow it as data arrives rather than trusting the size header, so that a
+ * corrupt header cannot exhaust memory on a short stream. */
+func (d *Decoder) readBody(n uint32) ([]byte, error) {
+	if uint32(cap(d.buf)) >= n {
+		read, err := io.ReadFull(d.r, d.buf[:n])
+		return d.buf[:read], err
+	}
+
+	buf := bytes.NewBuffer(d.buf[:0])
+	read, err := buf.ReadFrom(io.LimitReader(d.r, int64(n)))
+	d.buf = buf.Bytes()
+	if err == nil && read < int64(n) {
+		err = io.ErrUnexpectedEOF
+	}
+	return d.buf, err
+}
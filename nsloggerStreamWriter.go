@@ -0,0 +1,196 @@
+package nslogger
+
+import (
+	"errors"
+)
+
+var errStreamWriterClosed = errors.New("nslogger: write to closed StreamWriter")
+
+// StreamWriter is an io.Writer decoding the NSLogger binary stream written to
+// it, so that messages can be received over any transport: the stream can be
+// written in chunks of any size, incomplete messages being kept until the
+// rest arrives. Decoded messages are passed to the handler as soon as they are
+// complete.
+type StreamWriter struct {
+	handler  func(*Message)
+	o        *ParseOptions
+	buf      []byte
+	start    int           // start of the unconsumed bytes of buf
+	offset   int64         // offset of buf[start] in the stream
+	skip     *SkippedRange // bytes being skipped in recovery mode
+	state    streamState
+	order    reorderer // messages held back by WithReorder
+	collapse *collapser
+	grep     *grepper
+	err      error
+}
+
+// NewStreamWriter returns a StreamWriter calling handler with each decoded
+// message. The handler is called from Write.
+func NewStreamWriter(handler func(*Message), opts ...Option) *StreamWriter {
+	o := newParseOptions(opts)
+	return &StreamWriter{handler: handler, o: o, order: reorderer{window: o.Reorder}, collapse: o.newCollapser(), grep: o.newGrepper()}
+}
+
+// Write decodes the messages completed by p. Once a message fails to decode,
+// Write keeps returning the error, unless in recovery mode.
+func (w *StreamWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	w.buf = append(w.buf, p...)
+	w.err = w.decode(false)
+
+	// Move the bytes of the last incomplete message to the start of buf
+	n := copy(w.buf, w.buf[w.start:])
+	w.buf = w.buf[:n]
+	w.start = 0
+
+	return len(p), w.err
+}
+
+/** decode decodes the complete messages buffered. When final, the stream
+ * has ended and no incomplete message is waited for. */
+func (w *StreamWriter) decode(final bool) error {
+	for {
+		b := w.buf[w.start:]
+		if len(b) == 0 || (len(b) < 4 && !final) {
+			return nil
+		}
+		if final && w.o.ignoreTrailing() && !frameComplete(b, 0, w.o.Quirks) {
+			return nil
+		}
+
+		var m Message
+		var warnings []Warning
+		var totalSize uint32
+		var err, limitErr error
+		if len(b) >= 4 {
+			totalSize = w.o.Quirks.order().Uint32(b[0:4])
+			limitErr = w.o.checkMessageSize(totalSize)
+		}
+		switch {
+		case len(b) < 4 || (w.skip != nil && totalSize > maxResyncMessageSize):
+			err = ErrTruncatedMessage
+		case limitErr != nil:
+			err = atOffset(limitErr, w.offset)
+		case uint64(len(b)-4) < uint64(totalSize):
+			// Wait for the rest of the message, unless it is garbage found while skipping
+			if !final && (w.skip == nil || plausiblePrefix(b[4:], w.o.Quirks)) {
+				return nil
+			}
+			err = ErrTruncatedMessage
+		default:
+			body := b[4 : 4+totalSize]
+			m, warnings, err = decodeMessage(body, w.o.Lenient && w.skip == nil, w.o)
+			if err == nil && w.skip != nil && !plausible(body, w.o.Quirks) {
+				err = ErrCorruptPart
+			}
+			if err != nil {
+				err = atOffset(err, w.offset+4)
+			}
+		}
+
+		if err != nil {
+			if err == ErrTruncatedMessage {
+				err = atOffset(err, w.offset)
+			}
+			if !w.o.Recover {
+				w.order.flush()
+				if eerr := w.emitReady(); eerr != nil {
+					return eerr
+				}
+				return err
+			}
+			if w.skip == nil {
+				w.skip = &SkippedRange{Start: w.offset, Err: err}
+			}
+			w.advance(1)
+			continue
+		}
+
+		if w.skip != nil {
+			w.skip.End = w.offset
+			w.o.skipped(*w.skip)
+			w.skip = nil
+		}
+		w.order.push(decodedMessage{msg: &m, warnings: warnings, body: w.offset + 4})
+		w.advance(4 + int(totalSize))
+		if err := w.emitReady(); err != nil {
+			return err
+		}
+	}
+}
+
+/** emitReady applies the stream state and options to the messages released
+ * by the reordering buffer, and passes those selected to the handler. */
+func (w *StreamWriter) emitReady() error {
+	for dm, ok := w.order.pop(); ok; dm, ok = w.order.pop() {
+		m := dm.msg
+		w.o.warned(append(dm.warnings, w.state.update(m)...), dm.body)
+		keep, err := w.o.process(m)
+		if err != nil {
+			return err
+		}
+		if keep && w.collapse != nil {
+			m = w.collapse.feed(m)
+		}
+		if keep && m != nil {
+			w.handle(m)
+		}
+	}
+	return nil
+}
+
+/** handle passes m to the handler if selected by grep. */
+func (w *StreamWriter) handle(m *Message) {
+	if w.handler == nil {
+		return
+	}
+	if w.grep == nil {
+		w.handler(m)
+		return
+	}
+	for _, selected := range w.grep.feed(m) {
+		if selected != nil {
+			w.handler(selected)
+		}
+	}
+}
+
+func (w *StreamWriter) advance(n int) {
+	w.start += n
+	w.offset += int64(n)
+}
+
+// Close decodes what remains of the stream. In strict mode, it reports an
+// error wrapping ErrTruncatedMessage if the stream ended in the middle of a
+// message; in recovery mode the trailing bytes are reported as skipped.
+func (w *StreamWriter) Close() error {
+	if w.err == errStreamWriterClosed {
+		return nil
+	}
+	if w.err != nil {
+		return w.err
+	}
+
+	w.err = w.decode(true)
+	if w.order.flush() && w.err == nil {
+		w.err = w.emitReady()
+	}
+	if w.err != nil {
+		return w.err
+	}
+	if m := w.collapse.flush(); m != nil {
+		w.handle(m)
+	}
+	if w.skip != nil {
+		w.skip.End = w.offset
+		w.o.skipped(*w.skip)
+		w.skip = nil
+	}
+
+	w.err = errStreamWriterClosed
+	return nil
+}
@@ -0,0 +1,192 @@
+package nslogger
+
+import (
+	"bufio"
+	"strings"
+	"unicode/utf8"
+)
+
+// TableColumns are the default columns of table output.
+var TableColumns = []string{"time", "thread", "tag", "levelName", "message", "file", "line", "function"}
+
+// DefaultTableColumnWidth is the maximum width of the columns of table output
+// other than the message, when not set with WithTableWidths.
+const DefaultTableColumnWidth = 30
+
+/** tableGap separates the columns of table output. */
+const tableGap = "  "
+
+/** tableMinMessageWidth is the narrowest the message column gets to fit the
+ * width of table output. */
+const tableMinMessageWidth = 20
+
+// TableWidths bounds the widths, in characters, of the columns of
+// FormatTable output. Longer values are elided with "…": file paths at their
+// start, to keep the file name, and other values at their end.
+type TableWidths struct {
+	// Width, if not zero, is the width of the lines, usually that of the
+	// terminal, the message column taking the room left by the others.
+	// Otherwise messages are output in full.
+	Width int
+
+	// Columns are the maximum widths of the columns other than the message,
+	// by name, DefaultTableColumnWidth for the others.
+	Columns map[string]int
+}
+
+// WithTableWidths bounds the widths of the columns of FormatTable output.
+func WithTableWidths(t TableWidths) Option {
+	return func(o *ParseOptions) {
+		o.TableWidths = t
+	}
+}
+
+/** writeTable decodes b and writes its messages as a table with a header
+ * row, its columns sized to line up. Unlike the other formats, it needs all
+ * the messages before writing any, and writes nothing if decoding fails. */
+func writeTable(w *bufio.Writer, b []byte, o *ParseOptions) error {
+	msgs, err := decode(b, o)
+	if err != nil {
+		return err
+	}
+
+	columns := o.columns(TableColumns)
+	rows := make([][]string, len(msgs))
+	widths := make([]int, len(columns))
+	for i, name := range columns {
+		widths[i] = utf8.RuneCountInString(name)
+	}
+	for i := range msgs {
+		m := &msgs[i]
+		if m.IsClientInfo() || m.IsDisconnect() || m.IsMark() {
+			continue // lines of their own
+		}
+		row := make([]string, len(columns))
+		for j, name := range columns {
+			row[j] = o.tableField(m, name)
+			widths[j] = max(widths[j], utf8.RuneCountInString(row[j]))
+		}
+		rows[i] = row
+	}
+
+	// Bound the columns, the message taking the room left by the others
+	message := -1
+	used := 0
+	for i, name := range columns {
+		if name == "message" {
+			message = i
+			continue
+		}
+		limit, ok := o.TableWidths.Columns[name]
+		if !ok {
+			limit = DefaultTableColumnWidth
+		}
+		widths[i] = max(min(widths[i], limit), 1)
+		used += widths[i] + len(tableGap)
+	}
+	if message >= 0 && o.TableWidths.Width > 0 {
+		widths[message] = max(min(widths[message], o.TableWidths.Width-used), tableMinMessageWidth)
+	}
+
+	header := make([]string, len(columns))
+	rule := make([]string, len(columns))
+	for i, name := range columns {
+		header[i] = name
+		rule[i] = strings.Repeat("─", widths[i])
+	}
+	o.writeTableRow(w, nil, columns, header, widths)
+	w.WriteByte('\n')
+	o.writeTableRow(w, nil, columns, rule, widths)
+	w.WriteByte('\n')
+
+	for i := range msgs {
+		m := &msgs[i]
+		if rows[i] == nil {
+			line := o.tableEvent(m)
+			if o.TableWidths.Width > 0 {
+				line = elideEnd(line, o.TableWidths.Width)
+			}
+			w.WriteString(o.paint(ColorEvent, line))
+		} else {
+			o.writeTableRow(w, m, columns, rows[i], widths)
+		}
+		if err := w.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/** writeTableRow writes the values of a row, padded or elided to the widths
+ * of their columns, colored for m if not nil. The last column is not
+ * padded. */
+func (o *ParseOptions) writeTableRow(w *bufio.Writer, m *Message, columns, values []string, widths []int) {
+	for i, value := range values {
+		if i > 0 {
+			w.WriteString(tableGap)
+		}
+		if columns[i] == "file" {
+			value = elideStart(value, widths[i])
+		} else {
+			value = elideEnd(value, widths[i])
+		}
+		pad := ""
+		if i < len(values)-1 {
+			pad = strings.Repeat(" ", widths[i]-utf8.RuneCountInString(value))
+		}
+		if m != nil && o.Color {
+			value = colorField(m, columns[i], o.highlight(columns[i], value))
+		} else if m == nil && o.Color {
+			value = paint(ColorDim, value)
+		}
+		w.WriteString(value)
+		w.WriteString(pad)
+	}
+}
+
+/** tableField returns the value of the named column for m on a single
+ * line. */
+func (o *ParseOptions) tableField(m *Message, name string) string {
+	value := o.field(m, name)
+	if name == "levelName" && value == "" && m.Type == LogmsgTypeLog {
+		value = o.field(m, "level")
+	}
+	if name == "message" {
+		value = strings.Repeat(o.BlockIndent, m.Depth) + value
+		switch {
+		case m.Repeated == 1:
+			value += " (repeated once)"
+		case m.Repeated > 1:
+			value += " (repeated " + o.field(m, "repeated") + " times)"
+		}
+	}
+	return strings.NewReplacer("\r\n", " ↵ ", "\n", " ↵ ", "\t", " ").Replace(value)
+}
+
+/** tableEvent returns the line of table output of a client event or mark,
+ * across the columns. */
+func (o *ParseOptions) tableEvent(m *Message) string {
+	if mark, ok := m.Mark(); ok {
+		return o.markDivider(mark)
+	}
+	return o.formatTime(m.Timestamp) + tableGap + clientEvent(m)
+}
+
+/** elideEnd shortens s to width characters, ending it with "…". */
+func elideEnd(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:width-1]) + "…"
+}
+
+/** elideStart shortens s to width characters, starting it with "…". */
+func elideStart(s string, width int) string {
+	n := utf8.RuneCountInString(s)
+	if n <= width {
+		return s
+	}
+	r := []rune(s)
+	return "…" + string(r[n-width+1:])
+}
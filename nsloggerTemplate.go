@@ -0,0 +1,87 @@
+package nslogger
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"text/template"
+)
+
+// TemplateData holds the fields of a message made available to output
+// templates, e.g. "{{.Time}} [{{.Tag}}] {{.Message}}". Text fields are
+// formatted as in text output.
+type TemplateData struct {
+	Type     int
+	Time     string // timestamp, formatted according to the time layout and location
+	Seq      int
+	Thread   string
+	Tag      string
+	Level    string // level name, or number for log levels without a name
+	Message  string // text, binary data, image path or client event description
+	File     string
+	Line     int
+	Function string
+	Depth    int
+	Source   string
+	Msg      *Message // the message itself, for its other fields
+}
+
+// WithTemplate outputs each message on a line produced by executing tmpl on
+// its TemplateData.
+func WithTemplate(tmpl *template.Template) Option {
+	return func(o *ParseOptions) {
+		o.Format = FormatTemplate
+		o.Template = tmpl
+	}
+}
+
+// ParseTemplate parses text as an output template for WithTemplate.
+func ParseTemplate(text string) (*template.Template, error) {
+	return template.New("message").Parse(text)
+}
+
+/** templateData returns the template data of m. */
+func (o *ParseOptions) templateData(m *Message) *TemplateData {
+	level := m.LevelName
+	if level == "" && m.Type == LogmsgTypeLog {
+		level = strconv.Itoa(m.Level)
+	}
+	return &TemplateData{
+		Type:     m.Type,
+		Time:     o.formatTime(m.Timestamp),
+		Seq:      m.Seq,
+		Thread:   m.ThreadID,
+		Tag:      m.Tag,
+		Level:    level,
+		Message:  o.field(m, "message"),
+		File:     m.Filename,
+		Line:     m.LineNumber,
+		Function: m.FunctionName,
+		Depth:    m.Depth,
+		Source:   m.Source,
+		Msg:      m,
+	}
+}
+
+/** writeTemplate decodes b and writes the output of the template of o for
+ * each message, adding a newline when the template output lacks one. */
+func writeTemplate(w io.Writer, b []byte, o *ParseOptions) error {
+	var line bytes.Buffer
+	return eachMessage(b, o, func(m *Message) error {
+		return o.writeTemplateLine(w, &line, m)
+	})
+}
+
+/** writeTemplateLine writes the output of the template of o for m to w,
+ * adding a newline if it lacks one, using line as buffer. */
+func (o *ParseOptions) writeTemplateLine(w io.Writer, line *bytes.Buffer, m *Message) error {
+	line.Reset()
+	if err := o.Template.Execute(line, o.templateData(m)); err != nil {
+		return err
+	}
+	if !bytes.HasSuffix(line.Bytes(), []byte("\n")) {
+		line.WriteByte('\n')
+	}
+	_, err := w.Write(line.Bytes())
+	return err
+}
@@ -0,0 +1,108 @@
+package nslogger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Thread summarizes the messages logged by a thread of a client, as named in
+// their ThreadID.
+type Thread struct {
+	ID          string
+	Messages    int
+	Errors      int // messages of level LevelError
+	First, Last time.Time
+}
+
+/** threadTracker accumulates the summaries of the threads of a stream, in
+ * order of their first message. */
+type threadTracker struct {
+	index   map[string]int // position of threads in threads by ID
+	threads []Thread
+}
+
+/** add records m, if logged by a thread. */
+func (t *threadTracker) add(m *Message) {
+	if m.ThreadID == "" {
+		return
+	}
+	i, ok := t.index[m.ThreadID]
+	if !ok {
+		if t.index == nil {
+			t.index = make(map[string]int)
+		}
+		i = len(t.threads)
+		t.index[m.ThreadID] = i
+		t.threads = append(t.threads, Thread{ID: m.ThreadID, First: m.Timestamp})
+	}
+
+	th := &t.threads[i]
+	th.Messages++
+	if m.Type == LogmsgTypeLog && m.Level == LevelError {
+		th.Errors++
+	}
+	if m.Timestamp.Before(th.First) {
+		th.First = m.Timestamp
+	}
+	if m.Timestamp.After(th.Last) {
+		th.Last = m.Timestamp
+	}
+}
+
+/** summary returns a copy of the summaries of the threads. */
+func (t *threadTracker) summary() []Thread {
+	return append([]Thread(nil), t.threads...)
+}
+
+// Threads returns the summaries of the threads that logged msgs, in order of
+// their first message.
+func Threads(msgs []Message) []Thread {
+	var t threadTracker
+	for i := range msgs {
+		t.add(&msgs[i])
+	}
+	return t.threads
+}
+
+// WriteByThread writes the text output of msgs to w grouped by thread, in
+// order of their first message, so that the activity of a single thread or
+// queue can be followed through a noisy capture. Each group starts with a
+// divider line naming its thread. Messages without thread, such as client
+// info messages, come first. Text fields are separated by the separator set
+// with WithSeparator, DefaultSeparator if not set.
+func WriteByThread(w io.Writer, msgs []Message, opts ...Option) error {
+	o := newParseOptions(opts)
+	separator := o.Separator
+	if separator == "" {
+		separator = DefaultSeparator
+	}
+
+	groups := make(map[string][]*Message)
+	for i := range msgs {
+		groups[msgs[i].ThreadID] = append(groups[msgs[i].ThreadID], &msgs[i])
+	}
+
+	bw := bufio.NewWriter(w)
+	if o.Header {
+		bw.WriteString(o.textHeader(separator) + "\n")
+	}
+	for _, m := range groups[""] {
+		bw.WriteString(o.formatText(m, separator) + "\n")
+	}
+	for _, th := range Threads(msgs) {
+		bw.WriteString(o.paint(ColorEvent, o.threadDivider(th)) + "\n")
+		for _, m := range groups[th.ID] {
+			bw.WriteString(o.formatText(m, separator) + "\n")
+		}
+	}
+	return bw.Flush()
+}
+
+/** threadDivider returns the divider line starting the messages of th in
+ * the output of WriteByThread. */
+func (o *ParseOptions) threadDivider(th Thread) string {
+	return fmt.Sprintf("========== Thread %s: %d messages, %s - %s ==========",
+		th.ID, th.Messages, o.formatTime(th.First), o.formatTime(th.Last))
+}
@@ -0,0 +1,146 @@
+package nslogger
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+// ImageFormat is an encoding of image payloads.
+type ImageFormat int
+
+const (
+	ImagePNG  ImageFormat = iota // PNG, as sent by NSLogger clients
+	ImageJPEG                    // JPEG, much smaller for screenshots; transparent areas become white
+)
+
+// ImageConversion re-encodes and shrinks image payloads, since screenshots
+// logged at Retina resolution make HTML reports and exports enormous. WebP is
+// not supported, the standard library having no WebP encoder.
+type ImageConversion struct {
+	Format  ImageFormat
+	Quality int // JPEG quality from 1 to 100, jpeg.DefaultQuality if 0
+
+	// MaxWidth and MaxHeight, if not zero, bound the size in pixels of
+	// images, which are scaled down to fit, keeping their aspect ratio.
+	MaxWidth, MaxHeight int
+}
+
+// DefaultMaxImagePixels is the largest number of pixels of the images
+// decoded for WithImageConversion, unless Limits.MaxImagePixels is set: 8K
+// screenshots, which take 128 MiB decoded.
+const DefaultMaxImagePixels = 1 << 25
+
+// WithImageConversion re-encodes the image payloads of messages as set by c,
+// before they are written by WithImageDir or output. Images that cannot be
+// decoded are left as they are, and so are images larger than
+// Limits.MaxImagePixels, their header being checked before they are decoded
+// since a small compressed image can declare a huge size.
+func WithImageConversion(c ImageConversion) Option {
+	return func(o *ParseOptions) {
+		o.ImageConversion = &c
+	}
+}
+
+// ImageType returns the MIME type of the image of m, e.g. "image/png", or an
+// empty string if it has none.
+func ImageType(m *Message) string {
+	if m.Image == nil {
+		return ""
+	}
+	return http.DetectContentType(m.Image)
+}
+
+/** convertImage re-encodes the image of m as set by c, scaling down its
+ * declared size along with it. */
+func convertImage(c *ImageConversion, m *Message, maxPixels int64) {
+	if c == nil || m.Image == nil {
+		return
+	}
+	if maxPixels == 0 {
+		maxPixels = DefaultMaxImagePixels
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(m.Image))
+	if err != nil || int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+		return
+	}
+	img, _, err := image.Decode(bytes.NewReader(m.Image))
+	if err != nil {
+		return
+	}
+
+	b := img.Bounds()
+	w, h := fit(b.Dx(), b.Dy(), c.MaxWidth, c.MaxHeight)
+	if w != b.Dx() || h != b.Dy() {
+		img = scaleDown(img, w, h)
+		if m.ImageWidth > 0 && m.ImageHeight > 0 {
+			m.ImageWidth = max(1, m.ImageWidth*w/b.Dx())
+			m.ImageHeight = max(1, m.ImageHeight*h/b.Dy())
+		}
+	} else if c.Format == ImagePNG {
+		return // already a PNG of the right size
+	}
+
+	var buf bytes.Buffer
+	switch c.Format {
+	case ImageJPEG:
+		quality := c.Quality
+		if quality == 0 {
+			quality = jpeg.DefaultQuality
+		}
+		// Transparent areas are composed over white rather than black
+		opaque := image.NewRGBA(img.Bounds())
+		draw.Draw(opaque, opaque.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.Draw(opaque, opaque.Bounds(), img, img.Bounds().Min, draw.Over)
+		err = jpeg.Encode(&buf, opaque, &jpeg.Options{Quality: quality})
+	default:
+		err = png.Encode(&buf, img)
+	}
+	if err == nil {
+		m.Image = buf.Bytes()
+	}
+}
+
+/** fit returns the size of a w×h image scaled down to fit maxW×maxH, bounds
+ * that are zero not applying. */
+func fit(w, h, maxW, maxH int) (int, int) {
+	if maxW > 0 && w > maxW {
+		w, h = maxW, max(1, h*maxW/w)
+	}
+	if maxH > 0 && h > maxH {
+		w, h = max(1, w*maxH/h), maxH
+	}
+	return w, h
+}
+
+/** scaleDown returns img scaled down to w×h, averaging the source pixels
+ * covered by each pixel of the result. */
+func scaleDown(img image.Image, w, h int) *image.RGBA {
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	sw, sh := b.Dx(), b.Dy()
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, max((y+1)*sh/h, y*sh/h+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, max((x+1)*sw/w, x*sw/w+1)
+			var r, g, bl, a, n int
+			for sy := y0; sy < y1; sy++ {
+				p := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(p); i += 4 {
+					r, g, bl, a = r+int(p[i]), g+int(p[i+1]), bl+int(p[i+2]), a+int(p[i+3])
+					n++
+				}
+			}
+			i := y*dst.Stride + x*4
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = uint8(r/n), uint8(g/n), uint8(bl/n), uint8(a/n)
+		}
+	}
+	return dst
+}
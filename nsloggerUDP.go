@@ -0,0 +1,269 @@
+package nslogger
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultUDPTimeout is the time after which a UDP client that sent no
+// datagram is disconnected, when Listener.UDPTimeout is 0.
+const DefaultUDPTimeout = time.Minute
+
+// DefaultUDPMaxClients is the number of clients served at once by ServeUDP,
+// when Listener.UDPMaxClients is 0.
+const DefaultUDPMaxClients = 1024
+
+// DefaultUDPMaxQueuedBytes bounds the size of the datagrams waiting to be
+// decoded by ServeUDP, when Listener.UDPMaxQueuedBytes is 0.
+const DefaultUDPMaxQueuedBytes = 16 << 20
+
+/** maxDatagramSize is the largest UDP datagram received. */
+const maxDatagramSize = 65535
+
+/** udpQueueSize is the number of datagrams of a client waiting to be
+ * decoded, those arriving beyond it being dropped. */
+const udpQueueSize = 256
+
+// ListenAndServeUDP listens on the UDP port of l.Addr and serves the clients
+// sending messages in datagrams, as ServeUDP does.
+func (l *Listener) ListenAndServeUDP() error {
+	addr := l.Addr
+	if addr == "" {
+		addr = DefaultListenerAddr
+	}
+
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	return l.ServeUDP(pc)
+}
+
+// ServeUDP receives messages from clients sending one message frame, size
+// header included, per datagram on pc, as embedded clients of the NSLogger
+// protocol do. Each client address is served as a session of its own, ended
+// by a disconnect message once it sends nothing for l.UDPTimeout. Datagrams
+// are decoded as standalone messages: those that are invalid or lost do not
+// end the session, the messages following them decoding fine, and lost
+// messages are reported by the Lost field of the next one. Source addresses
+// being easily spoofed, the clients served and the datagrams queued are
+// bounded by l.UDPMaxClients and l.UDPMaxQueuedBytes. It may be called along
+// with Serve, for clients of both transports. It always returns a non-nil
+// error; after Close it returns ErrListenerClosed.
+func (l *Listener) ServeUDP(pc net.PacketConn) error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		pc.Close()
+		return ErrListenerClosed
+	}
+	l.pc = pc
+	l.mu.Unlock()
+	if err := l.FlowControl.setReadBuffer(pc); err != nil {
+		l.logf("nslogger: %v", err)
+	}
+
+	timeout := l.UDPTimeout
+	if timeout <= 0 {
+		timeout = DefaultUDPTimeout
+	}
+	maxClients := l.UDPMaxClients
+	if maxClients <= 0 {
+		maxClients = DefaultUDPMaxClients
+	}
+	queued := &atomic.Int64{} // size of the datagrams queued by all clients
+	maxQueued := l.UDPMaxQueuedBytes
+	if maxQueued <= 0 {
+		maxQueued = DefaultUDPMaxQueuedBytes
+	}
+	o := newParseOptions(append([]Option{WithLimits(DefaultListenerLimits)}, l.Options...))
+	clients := make(map[string]*packetConn)
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if l.isClosed() {
+				return ErrListenerClosed
+			}
+			return err
+		}
+		if !validDatagram(buf[:n], o) {
+			l.logf("nslogger: invalid datagram of %d bytes from %v", n, addr)
+			l.droppedDatagram()
+			continue
+		}
+
+		if queued.Add(int64(n)) > maxQueued {
+			queued.Add(-int64(n))
+			l.droppedDatagram()
+			continue
+		}
+
+		key := addr.String()
+		c := clients[key]
+		if c != nil && c.isClosed() {
+			c = nil // timed out
+		}
+		if c == nil {
+			for key, c := range clients {
+				if c.isClosed() {
+					delete(clients, key)
+				}
+			}
+			if len(clients) >= maxClients {
+				queued.Add(-int64(n))
+				l.droppedDatagram()
+				continue
+			}
+			c = newPacketConn(pc.LocalAddr(), addr, timeout, queued)
+			s := l.newSession(c)
+			if s == nil {
+				return ErrListenerClosed
+			}
+			s.packets = true
+			clients[key] = c
+			go l.serveSession(s)
+		}
+		select {
+		case c.ch <- append([]byte(nil), buf[:n]...):
+			if c.isClosed() {
+				c.discard() // closed meanwhile, nothing to read it
+			}
+		default:
+			queued.Add(-int64(n))
+			l.droppedDatagram()
+		}
+	}
+}
+
+/** validDatagram reports whether b holds a single message frame within the
+ * limits of o, so that the stream of a UDP session stays in step with its
+ * frames. */
+func validDatagram(b []byte, o *ParseOptions) bool {
+	if len(b) < 4 {
+		return false
+	}
+	size := o.Quirks.order().Uint32(b)
+	return int(size) == len(b)-4 && o.checkMessageSize(size) == nil && plausible(b[4:], o.Quirks)
+}
+
+/** droppedDatagram counts a datagram dropped, invalid, received faster than
+ * decoded or from a client beyond the maximum. */
+func (l *Listener) droppedDatagram() {
+	l.mu.Lock()
+	l.metrics.droppedDatagrams++
+	l.mu.Unlock()
+}
+
+/** packetConn is the connection of a UDP session, reading the datagrams of
+ * its client as a stream. It is closed once no datagram is received for its
+ * timeout. */
+type packetConn struct {
+	local, remote net.Addr
+	timeout       time.Duration
+	ch            chan []byte
+	queued        *atomic.Int64 // size of the datagrams in ch, those of other clients included
+	buf           []byte        // rest of the datagram being read
+	deadline      time.Time     // read deadline, set by the goroutine reading
+
+	closeOnce sync.Once
+	done      chan struct{}
+	drainOnce sync.Once
+	draining  chan struct{} // closed by Listener.Shutdown
+}
+
+func newPacketConn(local, remote net.Addr, timeout time.Duration, queued *atomic.Int64) *packetConn {
+	return &packetConn{
+		local:    local,
+		remote:   remote,
+		timeout:  timeout,
+		ch:       make(chan []byte, udpQueueSize),
+		queued:   queued,
+		done:     make(chan struct{}),
+		draining: make(chan struct{}),
+	}
+}
+
+func (c *packetConn) Read(p []byte) (int, error) {
+	if len(c.buf) == 0 {
+		wait, expired := c.timeout, false
+		if !c.deadline.IsZero() {
+			d := time.Until(c.deadline)
+			if d <= 0 {
+				return 0, os.ErrDeadlineExceeded
+			}
+			wait, expired = min(wait, d), d <= wait
+		}
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		select {
+		case c.buf = <-c.ch:
+		case <-c.done:
+			return 0, io.EOF
+		case <-c.draining:
+			select {
+			case c.buf = <-c.ch:
+			default:
+				return 0, io.EOF // all datagrams received decoded
+			}
+		case <-t.C:
+			if expired {
+				return 0, os.ErrDeadlineExceeded
+			}
+			c.Close()
+			return 0, io.EOF
+		}
+		c.queued.Add(-int64(len(c.buf)))
+	}
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+func (c *packetConn) Write(p []byte) (int, error) {
+	return 0, errors.New("nslogger: UDP sessions are receive only")
+}
+
+func (c *packetConn) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	c.discard()
+	return nil
+}
+
+/** discard drops the datagrams queued, for other clients to queue theirs. */
+func (c *packetConn) discard() {
+	for {
+		select {
+		case b := <-c.ch:
+			c.queued.Add(-int64(len(b)))
+		default:
+			return
+		}
+	}
+}
+
+/** drain makes Read return io.EOF once the datagrams received are read. */
+func (c *packetConn) drain() {
+	c.drainOnce.Do(func() { close(c.draining) })
+}
+
+func (c *packetConn) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *packetConn) LocalAddr() net.Addr                { return c.local }
+func (c *packetConn) RemoteAddr() net.Addr               { return c.remote }
+func (c *packetConn) SetDeadline(t time.Time) error      { return c.SetReadDeadline(t) }
+func (c *packetConn) SetReadDeadline(t time.Time) error  { c.deadline = t; return nil }
+func (c *packetConn) SetWriteDeadline(t time.Time) error { return nil }
@@ -0,0 +1,211 @@
+package nslogger
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// ViolationRule is the rule of the NSLogger protocol a Violation breaks.
+type ViolationRule int
+
+const (
+	ViolationTruncated     ViolationRule = iota // message extending past the end of the capture, or part past the end of its message
+	ViolationTrailingBytes                      // bytes following the last part of a message
+	ViolationPartType                           // part of a type that is unknown or not allowed for its key
+	ViolationMissingPart                        // mandatory part missing: message type, timestamp, image size
+	ViolationDuplicatePart                      // part key appearing more than once in a message
+	ViolationTimestamp                          // both milliseconds and microseconds, or fraction out of range
+	ViolationMessageType                        // unknown message type
+	ViolationMisplacedPart                      // part not belonging to its message type, e.g. client info parts in a log message
+	ViolationReservedKey                        // key reserved by the protocol but not defined
+	ViolationInvalidUTF8                        // string part that is not valid UTF-8
+)
+
+// Violation is a departure from the NSLogger protocol found by Validate.
+type Violation struct {
+	Rule    ViolationRule
+	Message int   // index of the message in the capture, from 0
+	Offset  int64 // byte offset in the capture of the part concerned, or of the message body
+	Key     uint8 // key of the part concerned, or missing
+	Err     error // description of the violation
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("message %d: %v at offset %d", v.Message, v.Err, v.Offset)
+}
+
+/** Part types allowed by the protocol for each of its keys. */
+var (
+	integerPartTypes = []uint8{PartTypeInt16, PartTypeInt32, PartTypeInt64}
+	stringPartTypes  = []uint8{PartTypeString}
+	partKeyTypes     = map[uint8][]uint8{
+		PartKeyMessageType:   integerPartTypes,
+		PartKeyTimestampS:    integerPartTypes,
+		PartKeyTimestampMs:   integerPartTypes,
+		PartKeyTimestampUs:   integerPartTypes,
+		PartKeyThreadId:      {PartTypeString, PartTypeInt16, PartTypeInt32, PartTypeInt64},
+		PartKeyTag:           stringPartTypes,
+		PartKeyLevel:         integerPartTypes,
+		PartKeyMessage:       {PartTypeString, PartTypeBinary, PartTypeImage},
+		PartKeyImageWidth:    integerPartTypes,
+		PartKeyImageHeight:   integerPartTypes,
+		PartKeyMessageSeq:    integerPartTypes,
+		PartKeyFilename:      stringPartTypes,
+		PartKeyLinenumber:    integerPartTypes,
+		PartKeyFunctionname:  stringPartTypes,
+		PartKeyClientName:    stringPartTypes,
+		PartKeyClientVersion: stringPartTypes,
+		PartKeyOsName:        stringPartTypes,
+		PartKeyOsVersion:     stringPartTypes,
+		PartKeyClientModel:   stringPartTypes,
+		PartKeyUniqueid:      stringPartTypes,
+	}
+)
+
+// Validate checks the capture b for conformance to the NSLogger protocol, for
+// people implementing their own clients, and returns the violations found, in
+// order: mandatory parts missing, milliseconds and microseconds timestamp
+// parts together, parts of types not allowed for their keys or in messages of
+// their type, duplicate parts and reserved keys, among others. Parts of types
+// registered with RegisterPartType are accepted for any key, and parts with
+// user-defined keys are not checked further. Validation stops at the first
+// message extending past the end of b. gzip-compressed captures are
+// decompressed first, offsets being those of the decompressed capture.
+func Validate(b []byte) ([]Violation, error) {
+	b, err := decompressed(b, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var violations []Violation
+	q := Quirks(0)
+	for off, i := int64(0), 0; off < int64(len(b)); i++ {
+		if int64(len(b))-off < 4 {
+			return append(violations, Violation{Rule: ViolationTruncated, Message: i, Offset: off,
+				Err: errors.New("size header truncated")}), nil
+		}
+		size := int64(q.order().Uint32(b[off:]))
+		if off+4+size > int64(len(b)) {
+			return append(violations, Violation{Rule: ViolationTruncated, Message: i, Offset: off,
+				Err: fmt.Errorf("message of %d bytes extending past the end of the capture", size)}), nil
+		}
+		violations = append(violations, validateMessage(b[off+4:off+4+size], off+4, i)...)
+		off += 4 + size
+	}
+	return violations, nil
+}
+
+/** validateMessage returns the violations of the message body b, message
+ * number i starting at offset off of the capture. */
+func validateMessage(b []byte, off int64, i int) []Violation {
+	var violations []Violation
+	violate := func(rule ViolationRule, at int64, key uint8, format string, args ...interface{}) {
+		violations = append(violations, Violation{Rule: rule, Message: i, Offset: off + at, Key: key, Err: fmt.Errorf(format, args...)})
+	}
+	if len(b) < 2 {
+		violate(ViolationTruncated, 0, 0, "message without part count")
+		return violations
+	}
+
+	q := Quirks(0)
+	count := q.order().Uint16(b)
+	at := make(map[uint8]int64) // offsets of the parts by key
+	var msgType, ms, us int64
+	var image bool
+	n := uint32(2)
+	for ; count > 0; count-- {
+		p, size, err := readPart(b, n, q)
+		switch {
+		case errors.Is(err, ErrTruncatedMessage):
+			violate(ViolationTruncated, int64(n), p.key, "part extending past the end of its message")
+			return violations
+		case err != nil:
+			violate(ViolationPartType, int64(n), p.key, "unknown part type %d", p.typ)
+			return violations
+		}
+
+		partOff := int64(n)
+		n += 2 + size
+		if _, dup := at[p.key]; dup {
+			violate(ViolationDuplicatePart, partOff, p.key, "part key %d appearing more than once", p.key)
+			continue
+		}
+		at[p.key] = partOff
+
+		if p.key >= PartKeyUserDefined {
+			continue
+		}
+		types, ok := partKeyTypes[p.key]
+		if !ok {
+			violate(ViolationReservedKey, partOff, p.key, "part key %d reserved by the protocol", p.key)
+			continue
+		}
+		if _, registered := registeredPartType(p.typ); !registered && !containsType(types, p.typ) {
+			violate(ViolationPartType, partOff, p.key, "part key %d of type %d", p.key, p.typ)
+			continue
+		}
+		if p.typ == PartTypeString && !utf8.Valid(p.data) {
+			violate(ViolationInvalidUTF8, partOff, p.key, "part key %d not valid UTF-8", p.key)
+		}
+
+		switch p.key {
+		case PartKeyMessageType:
+			msgType = p.value
+		case PartKeyTimestampMs:
+			ms = p.value
+		case PartKeyTimestampUs:
+			us = p.value
+		case PartKeyMessage:
+			image = p.typ == PartTypeImage
+		}
+	}
+	if int(n) < len(b) {
+		violate(ViolationTrailingBytes, int64(n), 0, "%d bytes following the last part", len(b)-int(n))
+	}
+
+	if _, ok := at[PartKeyMessageType]; !ok {
+		violate(ViolationMissingPart, 0, PartKeyMessageType, "message without message type")
+	} else if msgType < LogmsgTypeLog || msgType > LogmsgTypeMark {
+		violate(ViolationMessageType, at[PartKeyMessageType], PartKeyMessageType, "unknown message type %d", msgType)
+	}
+	if _, ok := at[PartKeyTimestampS]; !ok {
+		violate(ViolationMissingPart, 0, PartKeyTimestampS, "message without timestamp")
+	}
+	msOff, hasMs := at[PartKeyTimestampMs]
+	usOff, hasUs := at[PartKeyTimestampUs]
+	switch {
+	case hasMs && hasUs:
+		violate(ViolationTimestamp, usOff, PartKeyTimestampUs, "both milliseconds and microseconds timestamp parts")
+	case hasMs && (ms < 0 || ms >= 1000):
+		violate(ViolationTimestamp, msOff, PartKeyTimestampMs, "milliseconds %d out of range", ms)
+	case hasUs && (us < 0 || us >= 1000000):
+		violate(ViolationTimestamp, usOff, PartKeyTimestampUs, "microseconds %d out of range", us)
+	}
+
+	for key := uint8(PartKeyClientName); key <= PartKeyUniqueid; key++ {
+		if partOff, ok := at[key]; ok && msgType != LogmsgTypeClientinfo {
+			violate(ViolationMisplacedPart, partOff, key, "client info part key %d in a message of type %d", key, msgType)
+		}
+	}
+	for _, key := range []uint8{PartKeyImageWidth, PartKeyImageHeight} {
+		partOff, ok := at[key]
+		switch {
+		case ok && !image:
+			violate(ViolationMisplacedPart, partOff, key, "image size part key %d without image", key)
+		case !ok && image:
+			violate(ViolationMissingPart, at[PartKeyMessage], key, "image without image size part key %d", key)
+		}
+	}
+	return violations
+}
+
+/** containsType reports whether types contains typ. */
+func containsType(types []uint8, typ uint8) bool {
+	for _, t := range types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,275 @@
+package nslogger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TestVector is a reference capture of the NSLogger protocol, along with the
+// result of decoding and validating it with this package.
+type TestVector struct {
+	Name        string    // name of the vector, used as file name
+	Description string    // what the vector covers
+	Data        []byte    // the capture
+	Messages    []Message // messages decoded by Decode, timestamps in UTC
+	Err         error     // error returned by Decode, for malformed captures
+	Violations  []Violation
+}
+
+/** vectorTime is the timestamp of the messages of the test vectors. */
+var vectorTime = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// TestVectors generates reference captures covering every part key and type
+// of the protocol, edge sizes and pathological cases, so that client
+// implementers can test their encoders against this package, and this
+// package be tested against captures of other implementations. The vectors
+// are the same on every call.
+func TestVectors() []TestVector {
+	s := vectorTime.Unix()
+	header := func(msgType int) [][]byte {
+		return [][]byte{vpInt32(PartKeyMessageType, int32(msgType)), vpInt64(PartKeyTimestampS, s)}
+	}
+	log := func(parts ...[]byte) []byte {
+		return vectorFrame(append(header(LogmsgTypeLog), parts...)...)
+	}
+	integers := func(key uint8, v int64) [][]byte {
+		return [][]byte{vpInt16(key, int16(v)), vpInt32(key, int32(v)), vpInt64(key, v)}
+	}
+
+	var vectors []TestVector
+	add := func(name, description string, frames ...[]byte) {
+		vectors = append(vectors, TestVector{Name: name, Description: description, Data: bytes.Join(frames, nil)})
+	}
+
+	// Conforming captures
+	add("minimal", "log message with the mandatory message type and timestamp parts only",
+		log())
+	add("timestamp-ms", "timestamp with a milliseconds complement",
+		log(vpInt16(PartKeyTimestampMs, 999)))
+	add("timestamp-us", "timestamp with a microseconds complement",
+		log(vpInt32(PartKeyTimestampUs, 999999)))
+	for i, name := range []string{"int16", "int32", "int64"} {
+		var parts [][]byte
+		for _, p := range []struct {
+			key   uint8
+			value int64
+		}{{PartKeyMessageType, LogmsgTypeLog}, {PartKeyTimestampS, 1000}, {PartKeyThreadId, 7}, {PartKeyLevel, 3},
+			{PartKeyMessageSeq, 42}, {PartKeyLinenumber, 120}} {
+			parts = append(parts, integers(p.key, p.value)[i])
+		}
+		add("integers-"+name, "integer parts all of type "+name+", thread ID included",
+			vectorFrame(parts...))
+	}
+	add("integer-limits", "integer parts holding the extreme values of their types",
+		log(vpInt16(PartKeyLevel, -32768), vpInt32(PartKeyLinenumber, 2147483647), vpInt64(PartKeyMessageSeq, -1)),
+		log(vpInt16(PartKeyLevel, 32767), vpInt32(PartKeyLinenumber, -2147483648), vpInt32(PartKeyMessageSeq, 2147483647)))
+	add("all-parts", "log message with every part of the protocol for log messages",
+		log(vpString(PartKeyThreadId, "Main thread"), vpString(PartKeyTag, "network"), vpInt32(PartKeyLevel, 2),
+			vpString(PartKeyMessage, "request sent"), vpInt32(PartKeyMessageSeq, 1), vpString(PartKeyFilename, "/src/Network.m"),
+			vpInt32(PartKeyLinenumber, 42), vpString(PartKeyFunctionname, "-[Network send:]"), vpInt32(PartKeyTimestampUs, 500)))
+	add("part-order", "log message with its parts in reverse order of their keys",
+		vectorFrame(vpString(PartKeyFunctionname, "main"), vpInt32(PartKeyLinenumber, 1), vpString(PartKeyFilename, "main.c"),
+			vpString(PartKeyMessage, "reversed"), vpString(PartKeyTag, "order"), vpInt64(PartKeyTimestampS, s),
+			vpInt32(PartKeyMessageType, LogmsgTypeLog)))
+	add("binary-message", "log message with binary data, every byte value included",
+		log(vpData(PartKeyMessage, PartTypeBinary, vectorBytes(256))))
+	add("image-message", "log message with a PNG image and its size",
+		log(vpData(PartKeyMessage, PartTypeImage, vectorPNG(2, 3)), vpInt32(PartKeyImageWidth, 2), vpInt32(PartKeyImageHeight, 3)))
+	add("client-info", "client info message with every client info part",
+		vectorFrame(append(header(LogmsgTypeClientinfo), vpString(PartKeyClientName, "Demo"), vpString(PartKeyClientVersion, "1.0"),
+			vpString(PartKeyOsName, "iOS"), vpString(PartKeyOsVersion, "17.2"), vpString(PartKeyClientModel, "iPhone"),
+			vpString(PartKeyUniqueid, "0123-4567"))...))
+	add("message-types", "one message of each type: client info, block start, log, mark, block end and disconnect",
+		vectorFrame(append(header(LogmsgTypeClientinfo), vpString(PartKeyClientName, "Demo"))...),
+		vectorFrame(append(header(LogmsgTypeBlockstart), vpString(PartKeyMessage, "block"), vpInt32(PartKeyMessageSeq, 1))...),
+		vectorFrame(append(header(LogmsgTypeLog), vpString(PartKeyMessage, "inside"), vpInt32(PartKeyMessageSeq, 2))...),
+		vectorFrame(append(header(LogmsgTypeMark), vpString(PartKeyMessage, "mark"), vpInt32(PartKeyMessageSeq, 3))...),
+		vectorFrame(append(header(LogmsgTypeBlockend), vpInt32(PartKeyMessageSeq, 4))...),
+		vectorFrame(header(LogmsgTypeDisconnect)...))
+	add("empty-parts", "string and binary parts of zero length",
+		log(vpString(PartKeyTag, ""), vpString(PartKeyThreadId, ""), vpData(PartKeyMessage, PartTypeBinary, nil)))
+	add("utf8", "strings with multibyte UTF-8 characters",
+		log(vpString(PartKeyTag, "réseau"), vpString(PartKeyMessage, "日本語 ✓ 🚀"), vpString(PartKeyFunctionname, "naïve()")))
+	add("large-message", "log message text of 1 MiB",
+		log(vpString(PartKeyMessage, strings.Repeat("0123456789abcdef", 1<<16))))
+	add("user-defined-key", "log message with a part of a user-defined key, skipped when not registered",
+		log(vpString(PartKeyMessage, "extended"), vpString(PartKeyUserDefined, "custom"), vpInt64(PartKeyUserDefined+1, 7)))
+	var many [][]byte
+	for i := 1; i <= 1000; i++ {
+		many = append(many, log(vpInt32(PartKeyMessageSeq, int32(i)), vpInt32(PartKeyTimestampMs, int32(i%1000))))
+	}
+	add("many-messages", "1000 log messages numbered in sequence", many...)
+
+	// Decodable captures that do not conform to the protocol
+	add("no-parts", "message without any part", vectorFrame())
+	add("missing-timestamp", "log message without timestamp",
+		vectorFrame(vpInt32(PartKeyMessageType, LogmsgTypeLog), vpString(PartKeyMessage, "when?")))
+	add("ms-and-us", "timestamp with both milliseconds and microseconds complements, which are added",
+		log(vpInt32(PartKeyTimestampMs, 5), vpInt32(PartKeyTimestampUs, 5)))
+	add("duplicate-part", "log message with two message parts, the last one winning",
+		log(vpString(PartKeyMessage, "first"), vpString(PartKeyMessage, "second")))
+	add("wrong-part-type", "tag as an integer part and level as a string part",
+		log(vpInt32(PartKeyTag, 5), vpString(PartKeyLevel, "3")))
+	add("misplaced-parts", "log message with client info parts and an image size without image",
+		log(vpString(PartKeyClientName, "Demo"), vpInt32(PartKeyImageWidth, 10)))
+	add("unknown-message-type", "message of a type not defined by the protocol",
+		vectorFrame(header(9)...))
+	add("reserved-key", "log message with a part of a key reserved by the protocol",
+		log(vpString(15, "reserved")))
+	add("invalid-utf8", "log message text that is not valid UTF-8",
+		log(vpString(PartKeyMessage, "\xff\xfe")))
+	add("trailing-bytes", "message with bytes following its last part",
+		func() []byte {
+			b := append(log(), 0xde, 0xad)
+			binary.BigEndian.PutUint32(b, uint32(len(b)-4))
+			return b
+		}())
+
+	// Malformed captures
+	add("truncated-capture", "capture ending in the middle of a message",
+		log(vpString(PartKeyMessage, "complete")), log(vpString(PartKeyMessage, "cut"))[:20])
+	add("truncated-part", "part extending past the end of its message",
+		vectorFrame(vpInt32(PartKeyMessageType, LogmsgTypeLog), vpString(PartKeyMessage, "cut")[:8]))
+	add("empty-message", "message of zero bytes, without part count",
+		[]byte{0, 0, 0, 0})
+	add("part-size-overflow", "part declaring a size of 4 GiB, the largest possible",
+		log([]byte{PartKeyMessage, PartTypeString, 0xff, 0xff, 0xff, 0xff, 'x'}))
+	add("unknown-part-type", "part of a type not defined by the protocol",
+		log([]byte{PartKeyMessage, 9, 0, 0, 0, 1, 'x'}))
+	add("part-count-overflow", "message announcing more parts than it holds",
+		func() []byte {
+			b := log(vpString(PartKeyMessage, "short"))
+			binary.BigEndian.PutUint16(b[4:], 100)
+			return b
+		}())
+
+	// Compressed captures
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(vectors[0].Data)
+	zw.Close()
+	add("gzip", "gzip-compressed capture, as written for files named with a .gz extension", gz.Bytes())
+
+	for i := range vectors {
+		v := &vectors[i]
+		v.Messages, v.Err = Decode(v.Data)
+		for j := range v.Messages {
+			v.Messages[j].Timestamp = v.Messages[j].Timestamp.UTC()
+		}
+		v.Violations, _ = Validate(v.Data)
+	}
+	return vectors
+}
+
+// WriteTestVectors writes the test vectors to dir, created if needed: the
+// capture of each as <name>.rawnsloggerdata, except for compressed ones
+// written as <name>.rawnsloggerdata.gz, the messages decoded from it as
+// newline-delimited JSON in <name>.json, and an index of the vectors with
+// their descriptions, decoding errors and protocol violations in
+// vectors.json.
+func WriteTestVectors(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	type entry struct {
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		Capture     string   `json:"capture"`
+		Messages    int      `json:"messages"`
+		Error       string   `json:"error,omitempty"`
+		Violations  []string `json:"violations,omitempty"`
+	}
+	var index []entry
+	for _, v := range TestVectors() {
+		e := entry{Name: v.Name, Description: v.Description, Capture: v.Name + ".rawnsloggerdata", Messages: len(v.Messages)}
+		if compression(v.Data) == "gzip" {
+			e.Capture += ".gz"
+		}
+		if v.Err != nil {
+			e.Error = v.Err.Error()
+		}
+		for _, viol := range v.Violations {
+			e.Violations = append(e.Violations, viol.String())
+		}
+		index = append(index, e)
+
+		if err := os.WriteFile(filepath.Join(dir, e.Capture), v.Data, 0644); err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for i := range v.Messages {
+			if err := enc.Encode(&v.Messages[i]); err != nil {
+				return err
+			}
+		}
+		if err := os.WriteFile(filepath.Join(dir, v.Name+".json"), buf.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+
+	b, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "vectors.json"), append(b, '\n'), 0644)
+}
+
+/** vectorFrame frames parts into a message, with its part count and size
+ * header. */
+func vectorFrame(parts ...[]byte) []byte {
+	body := binary.BigEndian.AppendUint16(nil, uint16(len(parts)))
+	for _, p := range parts {
+		body = append(body, p...)
+	}
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(body))), body...)
+}
+
+func vpInt16(key uint8, v int16) []byte {
+	return binary.BigEndian.AppendUint16([]byte{key, PartTypeInt16}, uint16(v))
+}
+
+func vpInt32(key uint8, v int32) []byte {
+	return binary.BigEndian.AppendUint32([]byte{key, PartTypeInt32}, uint32(v))
+}
+
+func vpInt64(key uint8, v int64) []byte {
+	return binary.BigEndian.AppendUint64([]byte{key, PartTypeInt64}, uint64(v))
+}
+
+func vpData(key, typ uint8, data []byte) []byte {
+	return append(binary.BigEndian.AppendUint32([]byte{key, typ}, uint32(len(data))), data...)
+}
+
+func vpString(key uint8, s string) []byte {
+	return vpData(key, PartTypeString, []byte(s))
+}
+
+/** vectorBytes returns n bytes cycling through every byte value. */
+func vectorBytes(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	return b
+}
+
+/** vectorPNG returns a PNG image of the given size. */
+func vectorPNG(width, height int) []byte {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i * 40)
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
@@ -0,0 +1,70 @@
+package nslogger
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// WarningKind is the kind of anomaly a Warning reports.
+type WarningKind int
+
+const (
+	WarningSkippedPart    WarningKind = iota // part that cannot be decoded, skipped in lenient mode
+	WarningMissingPart                       // message without its message type or timestamp part
+	WarningSeqOrder                          // sequence number not greater than the previous one of the client
+	WarningSeqGap                            // sequence number skipping some, messages having been lost
+	WarningUnknownPartKey                    // part with a key neither of the protocol nor registered, skipped
+)
+
+// Warning is a non-fatal anomaly found in the input while decoding, reported
+// to the callback set with WithWarnings.
+type Warning struct {
+	Kind   WarningKind
+	Offset int64 // byte offset in the input of the part concerned, or of the message body
+	Key    uint8 // key of the part concerned, or missing
+	Type   uint8 // type of the part concerned, for skipped parts
+	Err    error // description of the anomaly
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%v at offset %d", w.Err, w.Offset)
+}
+
+// WithWarnings calls report with the non-fatal anomalies found while
+// decoding: parts skipped in lenient mode or with unknown keys, messages
+// missing mandatory parts, sequence numbers out of order and gaps in sequence
+// numbers.
+func WithWarnings(report func(Warning)) Option {
+	return func(o *ParseOptions) {
+		o.OnWarning = report
+	}
+}
+
+// WithDiagnostics logs the anomalies found while decoding to l at the warning
+// level: the ranges of bytes skipped in recovery mode and the warnings also
+// reported to the callback set with WithWarnings. The package never writes
+// to standard output or error by itself.
+func WithDiagnostics(l *slog.Logger) Option {
+	return func(o *ParseOptions) {
+		o.Diagnostics = l
+	}
+}
+
+/** warned reports ws, located relative to the message body starting at
+ * offset, to the callbacks of o: all of them to the warning callback, and
+ * the skipped parts to the lenient mode callback. */
+func (o *ParseOptions) warned(ws []Warning, offset int64) {
+	for _, w := range ws {
+		w.Offset += offset
+		w.Err = shifted(w.Err, offset)
+		if w.Kind == WarningSkippedPart && o.OnSkipPart != nil {
+			o.OnSkipPart(SkippedPart{Offset: w.Offset, Key: w.Key, Type: w.Type, Err: w.Err})
+		}
+		if o.OnWarning != nil {
+			o.OnWarning(w)
+		}
+		if o.Diagnostics != nil {
+			o.Diagnostics.Warn("nslogger: "+w.Err.Error(), "offset", w.Offset)
+		}
+	}
+}
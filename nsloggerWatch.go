@@ -0,0 +1,201 @@
+package nslogger
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Defaults of the WatchDir settings.
+const (
+	DefaultWatchInterval = 2 * time.Second
+	DefaultWatchPattern  = "*.rawnsloggerdata*"
+)
+
+// WatchHandler processes a capture file dropped in a directory watched by
+// WatchDir, such as the handlers returned by ConvertTo and HandleMessages.
+type WatchHandler func(path string) error
+
+// WatchOptions sets how WatchDir watches a directory.
+type WatchOptions struct {
+	// Pattern selects the capture files by name, DefaultWatchPattern if
+	// empty, which also matches gzip-compressed captures.
+	Pattern string
+
+	// Interval is the interval at which the directory is listed,
+	// DefaultWatchInterval if 0. A file is handled once its size and
+	// modification time are unchanged for an interval, so that files still
+	// being copied are not handled half written.
+	Interval time.Duration
+
+	Existing bool   // also handle the files already in the directory when watching starts
+	DoneDir  string // directory handled files are moved to, left in place if empty
+
+	ErrorLog *log.Logger // logs the errors of the handler, discarded if nil
+}
+
+// WatchDir watches the directory dir for capture files dropped in it, as
+// synced from devices or downloaded from CI artifacts, and calls h with each,
+// once they are completely written, until ctx is done. Files are handled one
+// at a time, in order of their names, and again when they are replaced. A
+// file that fails to be handled is logged to opts.ErrorLog and left in place.
+// WatchDir returns the error of ctx, or an error if dir cannot be listed when
+// watching starts or the pattern is malformed.
+func WatchDir(ctx context.Context, dir string, h WatchHandler, opts WatchOptions) error {
+	if opts.Pattern == "" {
+		opts.Pattern = DefaultWatchPattern
+	}
+	if _, err := filepath.Match(opts.Pattern, ""); err != nil {
+		return fmt.Errorf("nslogger: %q: %w", opts.Pattern, err)
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultWatchInterval
+	}
+
+	w := &watcher{dir: dir, h: h, opts: opts}
+	files, err := w.list()
+	if err != nil {
+		return err
+	}
+	for name, f := range files {
+		f.handled = !opts.Existing
+		files[name] = f
+	}
+	w.files = files
+
+	t := time.NewTicker(opts.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			w.poll(ctx)
+		}
+	}
+}
+
+// ConvertTo returns a WatchHandler converting captures to files in outputDir,
+// or next to them if empty, named as by ConvertFiles, in the output format
+// set by opts.
+func ConvertTo(outputDir string, opts ...Option) WatchHandler {
+	ext := formatExt(newParseOptions(opts).Format)
+	return func(path string) error {
+		dir := outputDir
+		if dir == "" {
+			dir = filepath.Dir(path)
+		}
+		return convertFile(path, filepath.Join(dir, captureBase(path)+ext), opts)
+	}
+}
+
+// HandleMessages returns a WatchHandler calling handler with each message of
+// captures selected and processed by opts, as a Listener does with the
+// messages it receives, so that the handlers of LokiPusher or Store can be
+// fed with dropped captures.
+func HandleMessages(handler func(*Message), opts ...Option) WatchHandler {
+	return func(path string) error {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ParseFunc(b, func(m *Message) bool {
+			handler(m)
+			return true
+		}, opts...)
+	}
+}
+
+/** watcher is the state of WatchDir. */
+type watcher struct {
+	dir   string
+	h     WatchHandler
+	opts  WatchOptions
+	files map[string]watchedFile // by name, as of the last listing
+}
+
+/** watchedFile is a file of a watched directory. */
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+	handled bool
+}
+
+/** list returns the files of the directory matching the pattern, none
+ * marked as handled. */
+func (w *watcher) list() (map[string]watchedFile, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]watchedFile)
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		if ok, _ := filepath.Match(w.opts.Pattern, e.Name()); !ok {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue // removed since listed
+		}
+		files[e.Name()] = watchedFile{size: info.Size(), modTime: info.ModTime()}
+	}
+	return files, nil
+}
+
+/** poll lists the directory and handles the files unchanged since the last
+ * listing. */
+func (w *watcher) poll(ctx context.Context) {
+	files, err := w.list()
+	if err != nil {
+		w.logf("nslogger: watching %s: %v", w.dir, err)
+		return
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := files[name]
+		last, ok := w.files[name]
+		if !ok || last.size != f.size || !last.modTime.Equal(f.modTime) {
+			continue // new or still being written
+		}
+		f.handled = last.handled
+		if !f.handled && ctx.Err() == nil {
+			w.handle(name)
+			f.handled = true
+		}
+		files[name] = f
+	}
+	w.files = files
+}
+
+/** handle calls the handler with the file name, moving the file to DoneDir
+ * once handled. */
+func (w *watcher) handle(name string) {
+	path := filepath.Join(w.dir, name)
+	if err := w.h(path); err != nil {
+		w.logf("nslogger: %s: %v", path, err)
+		return
+	}
+	if w.opts.DoneDir != "" {
+		if err := os.Rename(path, filepath.Join(w.opts.DoneDir, name)); err != nil {
+			w.logf("nslogger: %v", err)
+		}
+	}
+}
+
+func (w *watcher) logf(format string, args ...interface{}) {
+	if w.opts.ErrorLog != nil {
+		w.opts.ErrorLog.Printf(format, args...)
+	}
+}
@@ -0,0 +1,323 @@
+package nslogger
+
+import (
+	"encoding/json"
+	"html"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DefaultWebHistory is the number of messages a WebViewer sends to browsers
+// as they connect, if its History is 0.
+const DefaultWebHistory = 10000
+
+/** webClientBuffer is the number of messages queued for a browser before it
+ * is considered too slow and disconnected. */
+const webClientBuffer = 1024
+
+/** webMaxPageMessage bounds the messages read from pages, which send none. */
+const webMaxPageMessage = 4 << 10
+
+// WebViewer serves a single-page log viewer and streams messages to the
+// browsers viewing it over WebSocket, so that logs can be watched on systems
+// where the NSLogger desktop viewer does not run. Browsers first receive the
+// last messages handled, then messages as they are handled. Pages of other
+// hosts may not stream them.
+//
+// Its Handle method is meant to be used as a Listener handler:
+//
+//	v := &nslogger.WebViewer{}
+//	l := &nslogger.Listener{Handler: v.Handle}
+//	go l.ListenAndServe()
+//	log.Fatal(http.ListenAndServe(":8080", v))
+type WebViewer struct {
+	Title   string // title of the page, "NSLogger" if empty
+	History int    // number of messages kept for browsers connecting later, DefaultWebHistory if 0
+
+	// Store, if set, replaces History: browsers connecting receive the
+	// messages it retains, which Handle adds to it.
+	Store *Store
+
+	mu      sync.Mutex
+	history [][]byte // JSON of the last messages, a ring once full
+	next    int      // index of the oldest message in a full history
+	clients map[*webClient]struct{}
+}
+
+/** webClient is a browser connected to a WebViewer. */
+type webClient struct {
+	ws   *wsConn
+	send chan []byte
+}
+
+// Handle sends m to the connected browsers. Browsers that do not keep up with
+// the messages are disconnected.
+func (v *WebViewer) Handle(m *Message) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	history := v.History
+	if history <= 0 {
+		history = DefaultWebHistory
+	}
+	if v.Store != nil {
+		v.Store.Add(m)
+	} else if len(v.history) < history {
+		v.history = append(v.history, data)
+	} else {
+		v.history[v.next] = data
+		v.next = (v.next + 1) % len(v.history)
+	}
+
+	for c := range v.clients {
+		select {
+		case c.send <- data:
+		default:
+			delete(v.clients, c)
+			close(c.send)
+		}
+	}
+}
+
+// ServeHTTP serves the viewer page at the root path and streams the messages
+// to the page over WebSocket at ws.
+func (v *WebViewer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch strings.TrimPrefix(r.URL.Path, "/") {
+	case "":
+		title := v.Title
+		if title == "" {
+			title = "NSLogger"
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, strings.Replace(webPage, "%TITLE%", html.EscapeString(title), 2))
+	case "ws":
+		v.serveWebSocket(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (v *WebViewer) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgradeWebSocket(w, r, webMaxPageMessage, nil)
+	if err != nil {
+		return
+	}
+	defer ws.close()
+
+	c := &webClient{ws: ws}
+	v.mu.Lock()
+	if v.Store != nil {
+		msgs := v.Store.Messages()
+		c.send = make(chan []byte, len(msgs)+webClientBuffer)
+		for _, m := range msgs {
+			if data, err := json.Marshal(m); err == nil {
+				c.send <- data
+			}
+		}
+	} else {
+		c.send = make(chan []byte, len(v.history)+webClientBuffer)
+		for i := range v.history {
+			c.send <- v.history[(v.next+i)%len(v.history)]
+		}
+	}
+	if v.clients == nil {
+		v.clients = make(map[*webClient]struct{})
+	}
+	v.clients[c] = struct{}{}
+	v.mu.Unlock()
+
+	// Messages from the page are not expected: reading detects its closing.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, _, err := ws.read(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case data, ok := <-c.send:
+			if !ok {
+				return
+			}
+			if err := ws.write(wsText, data); err != nil {
+				v.remove(c)
+				return
+			}
+		case <-done:
+			v.remove(c)
+			return
+		}
+	}
+}
+
+/** remove forgets c, if not already done because it was too slow. */
+func (v *WebViewer) remove(c *webClient) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.clients[c]; ok {
+		delete(v.clients, c)
+		close(c.send)
+	}
+}
+
+/** webPage is the viewer page, rendering messages as they are received. */
+const webPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%TITLE%</title>
+<style>
+body { font: 13px/1.4 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 0; color: #222; }
+header { position: sticky; top: 0; background: #f4f4f6; border-bottom: 1px solid #ccc; padding: .5em 1em; display: flex; gap: 1em; align-items: center; flex-wrap: wrap; }
+header h1 { font-size: 1.1em; margin: 0; }
+#status { color: #888; }
+#log { padding: 0 1em; }
+.msg { display: flex; gap: .8em; padding: 1px 4px; border-bottom: 1px solid #f0f0f0; }
+.msg > span { white-space: nowrap; }
+.time, .thread, .loc { color: #888; font-family: Menlo, Consolas, monospace; font-size: .9em; }
+.tag { color: #2a6d3c; font-weight: bold; }
+.level { min-width: 4.5em; }
+.msg > .text { white-space: pre-wrap; word-break: break-word; flex: 1; font-family: Menlo, Consolas, monospace; }
+.l0 { background: #fdecea; } .l0 .level { color: #c62828; font-weight: bold; }
+.l1 { background: #fff6e0; } .l1 .level { color: #b26a00; font-weight: bold; }
+.l3 .text, .l4 .text { color: #666; }
+.event { margin: .5em 0; padding: .2em .5em; background: #e8eef7; border-left: 4px solid #4a76b8; }
+.mark { margin: .5em 0; padding: .2em .5em; background: #fff3b0; border: 1px dashed #d4b200; text-align: center; }
+.hidden { display: none; }
+img { max-width: 100%; border: 1px solid #ddd; }
+</style>
+</head>
+<body>
+<header>
+<h1>%TITLE%</h1>
+<label>Levels
+<input type="checkbox" class="lvl" value="0" checked>0
+<input type="checkbox" class="lvl" value="1" checked>1
+<input type="checkbox" class="lvl" value="2" checked>2
+<input type="checkbox" class="lvl" value="3" checked>3
+<input type="checkbox" class="lvl" value="4" checked>4</label>
+<label>Tag <input id="tag" size="10"></label>
+<label>Search <input id="search" size="20"></label>
+<label><input type="checkbox" id="follow" checked>Follow</label>
+<span id="status">connecting</span>
+</header>
+<div id="log"></div>
+<script>
+const log = document.getElementById("log");
+const names = {0: "Error", 1: "Warning", 2: "Info", 3: "Debug", 4: "Verbose"};
+
+function span(cls, text) {
+	const s = document.createElement("span");
+	s.className = cls;
+	s.textContent = text || "";
+	return s;
+}
+
+function time(m) {
+	return m.timestamp.replace("T", " ").replace(/(\.\d+)?(Z|[+-]\d\d:\d\d)$/, "$1");
+}
+
+function render(m) {
+	const div = document.createElement("div");
+	div.msg = m;
+	switch (m.type) {
+	case 1:
+		div.className = "event";
+		div.textContent = "\u25b6 " + (m.message || "block");
+		break;
+	case 2:
+		return null;
+	case 3:
+	case 4:
+		div.className = "event";
+		const c = m.client || {};
+		div.textContent = (m.type == 3 ? "Client info: " : "Client disconnected: ") +
+			[c.name, c.version, c.osName, c.osVersion, c.model, c.uniqueId].filter(Boolean).join(" ");
+		break;
+	case 5:
+		div.className = "mark";
+		div.textContent = m.message + " (" + time(m) + ")";
+		break;
+	default:
+		div.className = "msg l" + m.level;
+		div.append(span("time", time(m)), span("thread", m.thread), span("tag", m.tag),
+			span("level", m.levelName || names[m.level] || m.level));
+		const text = span("text", m.message);
+		if (m.image) {
+			const img = document.createElement("img");
+			img.src = "data:image/png;base64," + m.image;
+			text.append(img);
+		} else if (m.binary) {
+			text.textContent = atob(m.binary).split("").map(c => c.charCodeAt(0).toString(16).padStart(2, "0")).join("");
+		}
+		div.append(text);
+		if (m.file || m.function) {
+			div.append(span("loc", (m.file || "") + (m.line ? ":" + m.line : "") + " " + (m.function || "")));
+		}
+	}
+	div.style.marginLeft = (m.depth || 0) + "em";
+	return div;
+}
+
+function visible(m) {
+	if (m.type != 0) {
+		return true;
+	}
+	const levels = [...document.querySelectorAll(".lvl")].filter(e => e.checked).map(e => +e.value);
+	if (m.level <= 4 && !levels.includes(m.level)) {
+		return false;
+	}
+	const tag = document.getElementById("tag").value;
+	if (tag && m.tag != tag) {
+		return false;
+	}
+	const search = document.getElementById("search").value.toLowerCase();
+	return !search || [m.message, m.tag, m.file, m.function].some(s => s && s.toLowerCase().includes(search));
+}
+
+function refilter() {
+	for (const div of log.children) {
+		div.classList.toggle("hidden", !visible(div.msg));
+	}
+}
+
+document.querySelectorAll("header input").forEach(e => e.addEventListener("input", refilter));
+
+function connect() {
+	const ws = new WebSocket((location.protocol == "https:" ? "wss://" : "ws://") + location.host + location.pathname.replace(/\/?$/, "/ws"));
+	ws.onopen = () => {
+		log.replaceChildren();
+		document.getElementById("status").textContent = "connected";
+	};
+	ws.onmessage = e => {
+		const div = render(JSON.parse(e.data));
+		if (!div) {
+			return;
+		}
+		div.classList.toggle("hidden", !visible(div.msg));
+		log.append(div);
+		if (document.getElementById("follow").checked) {
+			window.scrollTo(0, document.body.scrollHeight);
+		}
+	};
+	ws.onclose = () => {
+		document.getElementById("status").textContent = "disconnected, reconnecting";
+		setTimeout(connect, 2000);
+	};
+}
+connect();
+</script>
+</body>
+</html>
+`
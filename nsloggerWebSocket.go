@@ -0,0 +1,287 @@
+package nslogger
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+)
+
+// WebSocket opcodes, RFC 6455 section 5.2.
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+)
+
+/** wsGUID is appended to the key of handshakes to compute their accept key. */
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+/** wsMaxMessageSize bounds the size of the WebSocket messages read when no
+ * other bound is given. */
+const wsMaxMessageSize = 64 << 20
+
+/** wsMaxControlSize is the maximum payload size of control frames. */
+const wsMaxControlSize = 125
+
+// WebSocket close status codes, RFC 6455 section 7.4.1.
+const (
+	wsStatusProtocolError = 1002
+	wsStatusTooBig        = 1009
+)
+
+/** errWebSocketClosed is returned by wsConn.read once a close frame is read,
+ * and by wsConn.write once one is sent. */
+var errWebSocketClosed = errors.New("nslogger: websocket closed")
+
+/** wsConn is a WebSocket connection, as much of RFC 6455 as needed to
+ * exchange log messages: no extensions, no subprotocols. */
+type wsConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+	max  int64 // maximum size of the messages read
+
+	mu        sync.Mutex // serializes writes
+	closeSent bool
+}
+
+/** wsAcceptKey returns the Sec-WebSocket-Accept value of a handshake key. */
+func wsAcceptKey(key string) string {
+	h := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+/** headerContains reports whether the comma-separated list of header name
+ * contains token, case-insensitively. */
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/** originAllowed reports whether r was sent by a page of an origin matching
+ * a pattern of allowed or, if there is none, of the host r is sent to.
+ * Requests without Origin header, not sent by browsers, are allowed. */
+func originAllowed(r *http.Request, allowed []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if len(allowed) == 0 {
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+	for _, pattern := range allowed {
+		if pattern == "*" {
+			return true
+		}
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(origin)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+/** upgradeWebSocket completes the WebSocket handshake of r, replying with
+ * an HTTP error if r is not a valid WebSocket request or comes from a page
+ * of an origin not allowed by origins, see originAllowed. Messages larger
+ * than max bytes will not be read, wsMaxMessageSize if max is 0. */
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request, max int64, origins []string) (*wsConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || key == "" ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "expected a WebSocket request", http.StatusBadRequest)
+		return nil, errors.New("not a websocket request")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("unsupported websocket version")
+	}
+	if !originAllowed(r, origins) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return nil, errors.New("websocket origin not allowed")
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return nil, errors.New("response writer cannot be hijacked")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + wsAcceptKey(key) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if max <= 0 {
+		max = wsMaxMessageSize
+	}
+	return &wsConn{conn: conn, br: rw.Reader, max: max}, nil
+}
+
+/** write sends data as a single unmasked frame of type op, as servers do. */
+func (c *wsConn) write(op byte, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closeSent {
+		return errWebSocketClosed
+	}
+	c.closeSent = op == wsClose
+
+	header := make([]byte, 2, 14)
+	header[0] = 0x80 | op
+	switch n := len(data); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xffff:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	_, err := c.conn.Write(append(header, data...))
+	return err
+}
+
+/** read returns the next data message, answering pings and reassembling
+ * fragmented messages. It returns errWebSocketClosed once the peer closes
+ * the connection, after replying to its close frame. Protocol errors and
+ * messages too large close the connection with the status they call for. */
+func (c *wsConn) read() (byte, []byte, error) {
+	var op byte
+	var msg []byte
+	for {
+		start := len(msg)
+		fin, frameOp, buf, err := c.readFrame(msg)
+		if err != nil {
+			return 0, nil, err
+		}
+		data := buf[start:]
+
+		switch frameOp {
+		case wsPing:
+			if err := c.write(wsPong, data); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			c.write(wsClose, data)
+			return 0, nil, errWebSocketClosed
+		case wsContinuation:
+			if op == 0 {
+				return 0, nil, c.fail(wsStatusProtocolError, errors.New("websocket: unexpected continuation frame"))
+			}
+		default:
+			if op != 0 {
+				return 0, nil, c.fail(wsStatusProtocolError, errors.New("websocket: interleaved data frames"))
+			}
+			op = frameOp
+		}
+
+		msg = buf
+		if fin {
+			return op, msg, nil
+		}
+	}
+}
+
+/** readFrame reads a frame, appending its unmasked payload to msg, the part
+ * of the message already read. Client frames must be masked, and data frames
+ * must not make the message larger than c.max. The payload is read as it
+ * arrives rather than allocated from the length announced. */
+func (c *wsConn) readFrame(msg []byte) (fin bool, op byte, buf []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, op = header[0]&0x80 != 0, header[0]&0x0f
+	if header[1]&0x80 == 0 {
+		return false, 0, nil, c.fail(wsStatusProtocolError, errors.New("websocket: unmasked client frame"))
+	}
+
+	n := uint64(header[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if op&0x8 != 0 {
+		if n > wsMaxControlSize || !fin {
+			return false, 0, nil, c.fail(wsStatusProtocolError, errors.New("websocket: invalid control frame"))
+		}
+	} else if n > uint64(c.max-int64(len(msg))) {
+		return false, 0, nil, c.fail(wsStatusTooBig, fmt.Errorf("websocket: message larger than %d bytes", c.max))
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	b := bytes.NewBuffer(msg)
+	read, err := b.ReadFrom(io.LimitReader(c.br, int64(n)))
+	if err == nil && uint64(read) < n {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return false, 0, nil, err
+	}
+	buf = b.Bytes()
+	data := buf[len(msg):]
+	for i := range data {
+		data[i] ^= mask[i%4]
+	}
+	return fin, op, buf, nil
+}
+
+/** fail sends a close frame with status code and returns err. */
+func (c *wsConn) fail(code uint16, err error) error {
+	c.write(wsClose, binary.BigEndian.AppendUint16(nil, code))
+	return err
+}
+
+/** close sends a close frame and closes the connection. */
+func (c *wsConn) close() error {
+	c.write(wsClose, []byte{0x03, 0xe8}) // 1000: normal closure
+	return c.conn.Close()
+}
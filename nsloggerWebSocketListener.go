@@ -0,0 +1,87 @@
+package nslogger
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// WebSocketHandler returns an HTTP handler accepting NSLogger clients over
+// WebSocket, such as JavaScript or WebAssembly clients running in browsers,
+// or proxies relaying native clients. Clients send the binary stream of the
+// protocol in binary WebSocket messages, message frames possibly split or
+// grouped across them, and each connection is served as a session of the
+// listener, as if accepted by Serve:
+//
+//	l := &nslogger.Listener{Handler: handle}
+//	http.Handle("/nslogger", l.WebSocketHandler())
+//
+// Browsers may only open sessions from the pages of the origins allowed by
+// WebSocketOrigins, other requests being rejected with status 403. A text
+// message closes the connection, and so does a WebSocket message
+// larger than the maximum message size of the listener limits, size header
+// included.
+func (l *Listener) WebSocketHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		o := newParseOptions(append([]Option{WithLimits(DefaultListenerLimits)}, l.Options...))
+		max := int64(o.Limits.MaxMessageSize)
+		if max > 0 {
+			max += 4
+		}
+		ws, err := upgradeWebSocket(w, r, max, l.WebSocketOrigins)
+		if err != nil {
+			return
+		}
+		s := l.newSession(&wsStream{ws: ws})
+		if s == nil {
+			ws.close()
+			return
+		}
+		l.serveSession(s)
+	})
+}
+
+/** wsStream is the connection of a WebSocket session, reading the payloads
+ * of the binary messages of its client as a stream. */
+type wsStream struct {
+	ws  *wsConn
+	buf []byte // rest of the message being read
+}
+
+func (c *wsStream) Read(p []byte) (int, error) {
+	for len(c.buf) == 0 {
+		op, data, err := c.ws.read()
+		if err == errWebSocketClosed {
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		if op != wsBinary {
+			return 0, errors.New("nslogger: text WebSocket message, expected binary NSLogger frames")
+		}
+		c.buf = data
+	}
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+func (c *wsStream) Write(p []byte) (int, error) {
+	return 0, errors.New("nslogger: WebSocket sessions are receive only")
+}
+
+/** drain asks the client to close the connection, as the listener is going
+ * away. */
+func (c *wsStream) drain() {
+	c.ws.write(wsClose, []byte{0x03, 0xe9}) // 1001: going away
+}
+
+func (c *wsStream) Close() error                       { return c.ws.close() }
+func (c *wsStream) LocalAddr() net.Addr                { return c.ws.conn.LocalAddr() }
+func (c *wsStream) RemoteAddr() net.Addr               { return c.ws.conn.RemoteAddr() }
+func (c *wsStream) SetDeadline(t time.Time) error      { return c.ws.conn.SetDeadline(t) }
+func (c *wsStream) SetReadDeadline(t time.Time) error  { return c.ws.conn.SetReadDeadline(t) }
+func (c *wsStream) SetWriteDeadline(t time.Time) error { return c.ws.conn.SetWriteDeadline(t) }
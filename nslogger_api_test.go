@@ -0,0 +1,203 @@
+package nslogger_test
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fouge/nslogger"
+)
+
+func TestListenerAPI(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := nslogger.NewStore(nslogger.StoreOptions{MaxMessages: 100})
+	msgs := make(chan *nslogger.Message, 10)
+	l := &nslogger.Listener{Handler: func(m *nslogger.Message) {
+		store.Add(m)
+		msgs <- m
+	}}
+	go l.Serve(ln)
+	defer l.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	logger, err := nslogger.NewLogger(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Log("network", nslogger.LevelWarning, "request timeout")
+	logger.Log("ui", nslogger.LevelDebug, "tap")
+	for i := 0; i < 3; i++ {
+		select {
+		case <-msgs:
+		case <-time.After(5 * time.Second):
+			t.Fatal("message not received")
+		}
+	}
+
+	api := &nslogger.ListenerAPI{Listener: l, Store: store}
+	serve := func(h http.Handler, method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder, v interface{}) {
+		t.Helper()
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type %q, want application/json", ct)
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("%v: %s", err, w.Body)
+		}
+	}
+
+	t.Run("clients", func(t *testing.T) {
+		w := serve(api, http.MethodGet, "/clients")
+		var clients []struct {
+			ID       uint64 `json:"id"`
+			Messages int64  `json:"messages"`
+		}
+		decode(w, &clients)
+		if w.Code != http.StatusOK || len(clients) != 1 || clients[0].Messages != 3 {
+			t.Errorf("GET /clients: %d %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		w := serve(api, http.MethodGet, "/stats")
+		var stats nslogger.ListenerStats
+		decode(w, &stats)
+		if w.Code != http.StatusOK || stats.Clients != 1 || stats.Messages != 3 {
+			t.Errorf("GET /stats: %d %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("metrics", func(t *testing.T) {
+		w := serve(api, http.MethodGet, "/metrics")
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "nslogger_") {
+			t.Errorf("GET /metrics: %d %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("recording", func(t *testing.T) {
+		type recording struct {
+			Recording bool     `json:"recording"`
+			Files     []string `json:"files"`
+		}
+		var rec recording
+		w := serve(api, http.MethodPost, "/recording")
+		if decode(w, &rec); w.Code != http.StatusConflict {
+			t.Errorf("POST /recording without record file: %d %s", w.Code, w.Body)
+		}
+
+		api := &nslogger.ListenerAPI{Listener: l, RecordFile: filepath.Join(t.TempDir(), "capture.rawnsloggerdata")}
+		if w := serve(api, http.MethodGet, "/recording/capture"); w.Code != http.StatusNotFound {
+			t.Errorf("GET /recording/capture not recording: %d %s", w.Code, w.Body)
+		}
+		w = serve(api, http.MethodPost, "/recording")
+		if decode(w, &rec); w.Code != http.StatusOK || !rec.Recording || len(rec.Files) != 1 {
+			t.Errorf("POST /recording: %d %s", w.Code, w.Body)
+		}
+		if w := serve(api, http.MethodPost, "/recording"); w.Code != http.StatusConflict {
+			t.Errorf("POST /recording while recording: %d %s", w.Code, w.Body)
+		}
+		w = serve(api, http.MethodGet, "/recording")
+		if decode(w, &rec); w.Code != http.StatusOK || !rec.Recording {
+			t.Errorf("GET /recording: %d %s", w.Code, w.Body)
+		}
+
+		// The capture starts with the client info of the connected client
+		w = serve(api, http.MethodGet, "/recording/capture")
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/octet-stream" {
+			t.Fatalf("GET /recording/capture: %d %s", w.Code, w.Header())
+		}
+		captured, err := nslogger.Decode(w.Body.Bytes())
+		if err != nil || len(captured) != 1 || captured[0].Type != nslogger.LogmsgTypeClientinfo {
+			t.Errorf("GET /recording/capture: %d messages, %v", len(captured), err)
+		}
+
+		w = serve(api, http.MethodDelete, "/recording")
+		if decode(w, &rec); w.Code != http.StatusOK || rec.Recording {
+			t.Errorf("DELETE /recording: %d %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("messages", func(t *testing.T) {
+		tests := []struct {
+			query  string
+			status int
+			texts  []string
+		}{
+			{"", http.StatusOK, []string{"", "request timeout", "tap"}},
+			{"?tag=network,ui&limit=1", http.StatusOK, []string{"tap"}},
+			{"?level=warning&pattern=time", http.StatusOK, []string{"", "request timeout"}}, // filters keep the client info
+			{"?since=2100-01-01T00:00:00Z", http.StatusOK, []string{}},
+			{"?level=loud", http.StatusBadRequest, nil},
+			{"?since=yesterday", http.StatusBadRequest, nil},
+			{"?pattern=(", http.StatusBadRequest, nil},
+			{"?limit=all", http.StatusBadRequest, nil},
+		}
+		for _, tt := range tests {
+			w := serve(api, http.MethodGet, "/messages"+tt.query)
+			if w.Code != tt.status {
+				t.Errorf("GET /messages%s: %d %s, want %d", tt.query, w.Code, w.Body, tt.status)
+				continue
+			}
+			if tt.status != http.StatusOK {
+				var e struct {
+					Error string `json:"error"`
+				}
+				if decode(w, &e); e.Error == "" {
+					t.Errorf("GET /messages%s: %s, want an error", tt.query, w.Body)
+				}
+				continue
+			}
+			var got []nslogger.Message
+			decode(w, &got)
+			texts := []string{}
+			for _, m := range got {
+				texts = append(texts, m.Payload)
+			}
+			if strings.Join(texts, "|") != strings.Join(tt.texts, "|") || len(texts) != len(tt.texts) {
+				t.Errorf("GET /messages%s: %q, want %q", tt.query, texts, tt.texts)
+			}
+		}
+
+		api := &nslogger.ListenerAPI{Listener: l}
+		if w := serve(api, http.MethodGet, "/messages"); w.Code != http.StatusNotFound {
+			t.Errorf("GET /messages without store: %d %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		tests := []struct {
+			method, target string
+			status         int
+		}{
+			{http.MethodPost, "/clients", http.StatusMethodNotAllowed},
+			{http.MethodPut, "/recording", http.StatusMethodNotAllowed},
+			{http.MethodDelete, "/messages", http.StatusMethodNotAllowed},
+			{http.MethodGet, "/sessions", http.StatusNotFound},
+		}
+		for _, tt := range tests {
+			w := serve(api, tt.method, tt.target)
+			var e struct {
+				Error string `json:"error"`
+			}
+			if decode(w, &e); w.Code != tt.status || e.Error == "" {
+				t.Errorf("%s %s: %d %s, want %d", tt.method, tt.target, w.Code, w.Body, tt.status)
+			}
+		}
+	})
+}
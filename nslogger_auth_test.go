@@ -0,0 +1,90 @@
+package nslogger_test
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fouge/nslogger"
+)
+
+func TestAuth(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string // sent by the client, none if empty
+		silent   bool   // the client sends nothing
+		accepted bool
+	}{
+		{"good token", "s3cret", false, true},
+		{"bad token", "guess", false, false},
+		{"missing token", "", false, false},
+		{"silent client", "", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			msgs := make(chan *nslogger.Message, 10)
+			l := &nslogger.Listener{
+				Auth:    &nslogger.ListenerAuth{Tokens: []string{"s3cret"}, Timeout: 100 * time.Millisecond},
+				Handler: nslogger.ChannelHandler(msgs),
+			}
+			go l.Serve(ln)
+			defer l.Close()
+
+			conn, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if !tt.silent {
+				var logger *nslogger.Logger
+				if tt.token != "" {
+					logger, err = nslogger.NewAuthenticatedLogger(conn, tt.token)
+				} else {
+					logger, err = nslogger.NewLogger(conn)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				logger.Log("", nslogger.LevelInfo, "hello")
+			}
+
+			if tt.accepted {
+				for _, want := range []int{nslogger.LogmsgTypeClientinfo, nslogger.LogmsgTypeLog} {
+					select {
+					case m := <-msgs:
+						if m.Type != want {
+							t.Fatalf("got message of type %d, want %d", m.Type, want)
+						}
+					case <-time.After(5 * time.Second):
+						t.Fatal("no message received")
+					}
+				}
+				return
+			}
+
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			// Reset rather than closed if the client sent more than read
+			if _, err := conn.Read(make([]byte, 1)); err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+				t.Fatalf("client not disconnected: %v", err)
+			}
+			select {
+			case m := <-msgs:
+				t.Errorf("message of type %d delivered", m.Type)
+			default:
+			}
+			var metrics bytes.Buffer
+			l.WriteMetrics(&metrics)
+			if !strings.Contains(metrics.String(), "nslogger_connections_rejected_total 1\n") {
+				t.Errorf("rejection not counted:\n%s", metrics.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,407 @@
+package nslogger_test
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fouge/nslogger"
+)
+
+/** benchMessages is the number of messages of the captures benchmarked. */
+const benchMessages = 10000
+
+/** benchStart is the timestamp of the first message of the captures
+ * benchmarked, fixed for them to be the same from run to run. */
+var benchStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+/** benchCaptures are the compositions of the synthetic captures benchmarked,
+ * each generating n messages with e. */
+var benchCaptures = []struct {
+	name     string
+	generate func(e *nslogger.Encoder, n int) error
+}{
+	{"logs", genLogs},
+	{"text", genText},
+	{"minimal", genMinimal},
+	{"binary", genBinary},
+	{"images", genImages},
+	{"sessions", genSessions},
+}
+
+/** benchData holds the captures of benchCaptures, generated once. */
+var benchData = struct {
+	sync.Mutex
+	captures map[string][]byte
+}{captures: make(map[string][]byte)}
+
+/** benchCapture returns the capture of n messages of the composition
+ * named. */
+func benchCapture(tb testing.TB, name string, n int) []byte {
+	benchData.Lock()
+	defer benchData.Unlock()
+	key := fmt.Sprintf("%s/%d", name, n)
+	if data, ok := benchData.captures[key]; ok {
+		return data
+	}
+	for _, c := range benchCaptures {
+		if c.name == name {
+			var buf bytes.Buffer
+			if err := c.generate(nslogger.NewEncoder(&buf), n); err != nil {
+				tb.Fatal(err)
+			}
+			benchData.captures[key] = buf.Bytes()
+			return buf.Bytes()
+		}
+	}
+	tb.Fatalf("no capture %q", name)
+	return nil
+}
+
+/** benchmark runs decode b.N times on data, reporting its throughput in
+ * bytes and messages per second and its allocations. */
+func benchmark(b *testing.B, data []byte, decode func(data []byte) error) {
+	msgs, err := nslogger.Decode(data)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := decode(data); err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		decode(data)
+	}
+	b.ReportMetric(float64(len(msgs))*float64(b.N)/b.Elapsed().Seconds(), "msgs/s")
+}
+
+/** drain reads the messages of d to the end of its stream. */
+func drain(d *nslogger.Decoder) error {
+	for {
+		if _, err := d.Next(); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+/** decodings are the ways of decoding captures benchmarked. */
+var decodings = []struct {
+	name   string
+	decode func(data []byte) error
+}{
+	{"Decode", func(data []byte) error {
+		_, err := nslogger.Decode(data)
+		return err
+	}},
+	{"DecodeParallel", func(data []byte) error {
+		_, err := nslogger.Decode(data, nslogger.WithWorkers(runtime.GOMAXPROCS(0)))
+		return err
+	}},
+	{"DecodeInterning", func(data []byte) error {
+		_, err := nslogger.Decode(data, nslogger.WithInterning())
+		return err
+	}},
+	{"Decoder", func(data []byte) error {
+		return drain(nslogger.NewDecoder(bytes.NewReader(data)))
+	}},
+	{"DecoderPooled", func(data []byte) error {
+		d := nslogger.NewDecoder(bytes.NewReader(data), nslogger.WithMessagePool())
+		for {
+			m, err := d.Next()
+			if err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+			m.Release()
+		}
+	}},
+	{"DecoderLazy", func(data []byte) error {
+		d := nslogger.NewDecoder(bytes.NewReader(data))
+		for {
+			m, err := d.NextLazy()
+			if err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+			m.Tag()
+		}
+	}},
+	{"ParseText", func(data []byte) error {
+		_, err := nslogger.NsLoggerParse(data, ",")
+		return err
+	}},
+	{"ParseJSON", func(data []byte) error {
+		_, err := nslogger.NsLoggerParse(data, ",", nslogger.WithFormat(nslogger.FormatJSON))
+		return err
+	}},
+	{"ParseCSV", func(data []byte) error {
+		_, err := nslogger.NsLoggerParse(data, ",", nslogger.WithFormat(nslogger.FormatCSV))
+		return err
+	}},
+	{"Validate", func(data []byte) error {
+		_, err := nslogger.Validate(data)
+		return err
+	}},
+}
+
+/** benchmarkDecoding runs the decoding named on each capture of
+ * benchCaptures, as sub-benchmarks named after them. */
+func benchmarkDecoding(b *testing.B, name string) {
+	for _, d := range decodings {
+		if d.name != name {
+			continue
+		}
+		for _, c := range benchCaptures {
+			b.Run(c.name, func(b *testing.B) {
+				benchmark(b, benchCapture(b, c.name, benchMessages), d.decode)
+			})
+		}
+	}
+}
+
+func BenchmarkDecode(b *testing.B)          { benchmarkDecoding(b, "Decode") }
+func BenchmarkDecodeParallel(b *testing.B)  { benchmarkDecoding(b, "DecodeParallel") }
+func BenchmarkDecodeInterning(b *testing.B) { benchmarkDecoding(b, "DecodeInterning") }
+func BenchmarkDecoder(b *testing.B)         { benchmarkDecoding(b, "Decoder") }
+func BenchmarkDecoderPooled(b *testing.B)   { benchmarkDecoding(b, "DecoderPooled") }
+func BenchmarkDecoderLazy(b *testing.B)     { benchmarkDecoding(b, "DecoderLazy") }
+func BenchmarkParseText(b *testing.B)       { benchmarkDecoding(b, "ParseText") }
+func BenchmarkParseJSON(b *testing.B)       { benchmarkDecoding(b, "ParseJSON") }
+func BenchmarkParseCSV(b *testing.B)        { benchmarkDecoding(b, "ParseCSV") }
+func BenchmarkValidate(b *testing.B)        { benchmarkDecoding(b, "Validate") }
+
+/** allocMessages is the number of messages of the captures of
+ * TestAllocations. */
+const allocMessages = 1000
+
+/** allocBudgets are the allocations per message of each decoding of each
+ * capture, by decoding and capture name. Lower them along with the changes
+ * saving allocations. */
+var allocBudgets = map[string]float64{
+	"Decode/logs": 8, "Decode/text": 6, "Decode/minimal": 4, "Decode/binary": 6, "Decode/images": 6, "Decode/sessions": 6,
+	"DecodeInterning/logs": 4, "DecodeInterning/text": 4, "DecodeInterning/minimal": 4, "DecodeInterning/binary": 4, "DecodeInterning/images": 4, "DecodeInterning/sessions": 4,
+	"Decoder/logs": 8, "Decoder/text": 6, "Decoder/minimal": 4, "Decoder/binary": 6, "Decoder/images": 6, "Decoder/sessions": 6,
+	"DecoderPooled/logs": 7, "DecoderPooled/text": 5, "DecoderPooled/minimal": 3, "DecoderPooled/binary": 5, "DecoderPooled/images": 5, "DecoderPooled/sessions": 5,
+	"DecoderLazy/logs": 3, "DecoderLazy/text": 3, "DecoderLazy/minimal": 2, "DecoderLazy/binary": 3, "DecoderLazy/images": 3, "DecoderLazy/sessions": 3,
+	"ParseText/logs": 12.1, "ParseText/text": 9, "ParseText/minimal": 6, "ParseText/binary": 11, "ParseText/images": 8, "ParseText/sessions": 8.4,
+	"ParseJSON/logs": 8, "ParseJSON/text": 6, "ParseJSON/minimal": 4, "ParseJSON/binary": 6, "ParseJSON/images": 6, "ParseJSON/sessions": 6,
+	"ParseCSV/logs": 10.9, "ParseCSV/text": 7.9, "ParseCSV/minimal": 5, "ParseCSV/binary": 9.9, "ParseCSV/images": 7.9, "ParseCSV/sessions": 7.4,
+	"Validate/logs": 3, "Validate/text": 0, "Validate/minimal": 0, "Validate/binary": 0, "Validate/images": 3, "Validate/sessions": 0.2,
+}
+
+/** allocSlack is the allocations per message allowed over budgets, less than
+ * one for an allocation more per message to fail. */
+const allocSlack = 0.5
+
+// TestAllocations fails when a decoding allocates more per message than its
+// budget for a capture, so that allocation regressions, unlike those of
+// throughput, are caught by go test.
+func TestAllocations(t *testing.T) {
+	if raceEnabled {
+		t.Skip("sync.Pool drops items at random under the race detector")
+	}
+	for _, d := range decodings {
+		if d.name == "DecodeParallel" {
+			continue // allocations depend on GOMAXPROCS
+		}
+		for _, c := range benchCaptures {
+			t.Run(d.name+"/"+c.name, func(t *testing.T) {
+				data := benchCapture(t, c.name, allocMessages)
+				if err := d.decode(data); err != nil {
+					t.Fatal(err)
+				}
+				budget, ok := allocBudgets[d.name+"/"+c.name]
+				if !ok {
+					t.Fatal("no allocation budget")
+				}
+				perMessage := testing.AllocsPerRun(3, func() { d.decode(data) }) / allocMessages
+				if perMessage > budget+allocSlack {
+					t.Errorf("%.2f allocations per message, over the budget of %g", perMessage, budget)
+				}
+			})
+		}
+	}
+}
+
+/** genLogs generates log messages resembling those of an app, one in a
+ * hundred with a small binary payload. */
+func genLogs(e *nslogger.Encoder, n int) error {
+	tags := []string{"network", "ui", "db", "auth"}
+	for i := 0; i < n; i++ {
+		m := &nslogger.Message{
+			Type:         nslogger.LogmsgTypeLog,
+			Timestamp:    benchStart.Add(time.Duration(i) * time.Millisecond),
+			Seq:          i + 1,
+			ThreadID:     "Main thread",
+			Tag:          tags[i%len(tags)],
+			Level:        i % 5,
+			Filename:     "/Users/dev/App/Sources/NetworkManager.m",
+			LineNumber:   100 + i%200,
+			FunctionName: "-[NetworkManager sendRequest:completion:]",
+			Payload:      fmt.Sprintf("request %d sent to https://api.example.com/v1/items", i),
+		}
+		if i%100 == 99 {
+			m.Payload = ""
+			m.Binary = bytes.Repeat([]byte{0xab}, 256)
+		}
+		if err := e.Encode(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/** genText generates log messages of long multi-line, partly non-ASCII
+ * texts, such as dumped responses. */
+func genText(e *nslogger.Encoder, n int) error {
+	var body strings.Builder
+	for i := 0; i < 24; i++ {
+		fmt.Fprintf(&body, "  {\"id\": %d, \"name\": \"Zoë Ångström\", \"city\": \"Zürich\", \"note\": \"données reçues ✓\"},\n", i)
+	}
+	for i := 0; i < n; i++ {
+		m := &nslogger.Message{
+			Type:      nslogger.LogmsgTypeLog,
+			Timestamp: benchStart.Add(time.Duration(i) * time.Millisecond),
+			Seq:       i + 1,
+			ThreadID:  "com.apple.NSURLSession-work",
+			Tag:       "network",
+			Level:     3,
+			Payload:   fmt.Sprintf("response %d:\n[\n%s]", i, body.String()),
+		}
+		if err := e.Encode(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/** genMinimal generates log messages of short texts without metadata, for
+ * the overhead of messages and parts to dominate. */
+func genMinimal(e *nslogger.Encoder, n int) error {
+	for i := 0; i < n; i++ {
+		m := &nslogger.Message{
+			Type:      nslogger.LogmsgTypeLog,
+			Timestamp: benchStart.Add(time.Duration(i) * time.Microsecond),
+			Payload:   "tick",
+		}
+		if err := e.Encode(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/** genBinary generates log messages of 4 KiB binary payloads. */
+func genBinary(e *nslogger.Encoder, n int) error {
+	data := make([]byte, 4096)
+	for i := 0; i < n; i++ {
+		for j := range data {
+			data[j] = byte(i*31 + j*7)
+		}
+		m := &nslogger.Message{
+			Type:      nslogger.LogmsgTypeLog,
+			Timestamp: benchStart.Add(time.Duration(i) * time.Millisecond),
+			Seq:       i + 1,
+			ThreadID:  "Main thread",
+			Tag:       "bluetooth",
+			Binary:    data,
+		}
+		if err := e.Encode(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/** genImages generates log messages of 64x64 PNG images. */
+func genImages(e *nslogger.Encoder, n int) error {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 4), uint8(y * 4), uint8(x ^ y), 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		m := &nslogger.Message{
+			Type:        nslogger.LogmsgTypeLog,
+			Timestamp:   benchStart.Add(time.Duration(i) * time.Millisecond),
+			Seq:         i + 1,
+			ThreadID:    "Main thread",
+			Tag:         "ui",
+			Image:       buf.Bytes(),
+			ImageWidth:  64,
+			ImageHeight: 64,
+		}
+		if err := e.Encode(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/** genSessions generates the messages of successive client sessions, a
+ * hundred messages each: client infos and disconnections, nested blocks,
+ * marks and logs from several threads. */
+func genSessions(e *nslogger.Encoder, n int) error {
+	threads := []string{"Main thread", "com.apple.main-thread", "NSOperationQueue 0x600001234", "Thread 7"}
+	tags := []string{"network", "ui", "db", "auth", "sync", "push"}
+	var client *nslogger.ClientInfo
+	seq := 0
+	for i := 0; i < n; i++ {
+		m := &nslogger.Message{
+			Type:      nslogger.LogmsgTypeLog,
+			Timestamp: benchStart.Add(time.Duration(i) * time.Millisecond),
+			ThreadID:  threads[i%len(threads)],
+			Tag:       tags[i%len(tags)],
+			Level:     i % 5,
+			Payload:   fmt.Sprintf("step %d of session %d", i%100, i/100),
+		}
+		switch i % 100 {
+		case 0:
+			client = &nslogger.ClientInfo{Name: "Demo", Version: "2.4.1", OSName: "iOS", OSVersion: "17.2",
+				Model: "iPhone15,2", UniqueID: fmt.Sprintf("device-%04d", i/100%16)}
+			m = &nslogger.Message{Type: nslogger.LogmsgTypeClientinfo, Timestamp: m.Timestamp, Client: client}
+			seq = 0
+		case 99:
+			m = &nslogger.Message{Type: nslogger.LogmsgTypeDisconnect, Timestamp: m.Timestamp, Client: client}
+		case 50:
+			m.Type, m.Payload = nslogger.LogmsgTypeMark, fmt.Sprintf("checkpoint %d", i/100)
+		default:
+			switch i % 10 {
+			case 1:
+				m.Type = nslogger.LogmsgTypeBlockstart
+			case 8:
+				m.Type, m.Payload = nslogger.LogmsgTypeBlockend, ""
+			}
+		}
+		if m.Type != nslogger.LogmsgTypeClientinfo && m.Type != nslogger.LogmsgTypeDisconnect {
+			seq++
+			m.Seq = seq
+		}
+		if err := e.Encode(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
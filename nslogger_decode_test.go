@@ -0,0 +1,25 @@
+package nslogger_test
+
+import (
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/fouge/nslogger"
+)
+
+// TestCaptureTooLarge checks that in-memory captures beyond the 32-bit
+// offsets they are decoded with are refused rather than cut short.
+func TestCaptureTooLarge(t *testing.T) {
+	if strconv.IntSize == 32 || testing.Short() {
+		t.Skip("needs a capture of 4 GiB")
+	}
+	b := make([]byte, math.MaxUint32+1) // never written, not backed by memory
+	for _, opts := range [][]nslogger.Option{nil, {nslogger.WithWorkers(4)}} {
+		if err := nslogger.ParseToWriter(b, io.Discard, opts...); !errors.Is(err, nslogger.ErrLimitExceeded) {
+			t.Errorf("ParseToWriter with %d options: %v, want ErrLimitExceeded", len(opts), err)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package nslogger_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fouge/nslogger"
+)
+
+// FuzzDecode feeds arbitrary captures to every decoding path. The seed corpus
+// runs with go test; fuzz with go test -fuzz=FuzzDecode.
+func FuzzDecode(f *testing.F) {
+	for _, b := range nslogger.FuzzCorpus() {
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		nslogger.FuzzDecode(b)
+	})
+}
+
+// TestFuzzDecodeVectors runs FuzzDecode on every test vector, the largest
+// ones included, which decode as expected unless they exceed FuzzLimits.
+func TestFuzzDecodeVectors(t *testing.T) {
+	for _, v := range nslogger.TestVectors() {
+		t.Run(v.Name, func(t *testing.T) {
+			err := nslogger.FuzzDecode(v.Data)
+			if (err != nil) != (v.Err != nil) && !errors.Is(err, nslogger.ErrLimitExceeded) {
+				t.Errorf("FuzzDecode: %v, want error %v", err, v.Err)
+			}
+		})
+	}
+}
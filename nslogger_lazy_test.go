@@ -0,0 +1,36 @@
+package nslogger_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/fouge/nslogger"
+)
+
+// TestLazyDecode checks that lazily decoded messages are those Next returns.
+func TestLazyDecode(t *testing.T) {
+	for _, v := range nslogger.TestVectors() {
+		t.Run(v.Name, func(t *testing.T) {
+			d := nslogger.NewDecoder(bytes.NewReader(v.Data))
+			lazy := nslogger.NewDecoder(bytes.NewReader(v.Data))
+			for i := 0; ; i++ {
+				want, err := d.Next()
+				l, lerr := lazy.NextLazy()
+				if err != nil || lerr != nil {
+					if (err == nil) != (lerr == nil) {
+						t.Fatalf("message %d: NextLazy: %v, Next: %v", i, lerr, err)
+					}
+					return
+				}
+				got, err := l.Decode()
+				if err != nil {
+					t.Fatalf("message %d: Decode: %v", i, err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Fatalf("message %d:\n got %+v\nwant %+v", i, *got, *want)
+				}
+			}
+		})
+	}
+}
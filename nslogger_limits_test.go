@@ -0,0 +1,107 @@
+package nslogger_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fouge/nslogger"
+)
+
+/** syncBuffer is a bytes.Buffer safe for concurrent use, for error logs. */
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// TestListenerLimits checks that connections sending messages beyond the
+// limits of a listener are closed, and counted in its metrics.
+func TestListenerLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits *nslogger.Limits // DefaultListenerLimits if nil
+		send   func(l *nslogger.Logger, conn net.Conn)
+	}{
+		{"oversized frame", nil, func(l *nslogger.Logger, conn net.Conn) {
+			conn.Write(binary.BigEndian.AppendUint32(nil, 1<<30)) // body never sent
+		}},
+		{"too many parts", &nslogger.Limits{MaxParts: 8}, func(l *nslogger.Logger, conn net.Conn) {
+			l.Log("tag", nslogger.LevelInfo, "hello")
+		}},
+		{"oversized part", &nslogger.Limits{MaxPartSize: 256}, func(l *nslogger.Logger, conn net.Conn) {
+			l.Log("tag", nslogger.LevelInfo, strings.Repeat("hello ", 100))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			msgs := make(chan *nslogger.Message, 10)
+			var errors syncBuffer
+			l := &nslogger.Listener{Handler: nslogger.ChannelHandler(msgs), ErrorLog: log.New(&errors, "", 0)}
+			if tt.limits != nil {
+				l.Options = []nslogger.Option{nslogger.WithLimits(*tt.limits)}
+			}
+			go l.Serve(ln)
+			defer l.Close()
+
+			conn, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			logger, err := nslogger.NewLogger(conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.send(logger, conn)
+
+			clientInfo := false
+			for disconnected := false; !disconnected; {
+				select {
+				case m := <-msgs:
+					switch m.Type {
+					case nslogger.LogmsgTypeClientinfo:
+						clientInfo = true
+					case nslogger.LogmsgTypeLog:
+						t.Fatalf("message beyond the limits delivered: %v", m.Payload)
+					case nslogger.LogmsgTypeDisconnect:
+						disconnected = true
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatal("connection not closed")
+				}
+			}
+			if !clientInfo {
+				t.Error("client info within the limits not delivered")
+			}
+			if !strings.Contains(errors.String(), "limit exceeded") {
+				t.Errorf("error log %q, want a limit exceeded", errors.String())
+			}
+			var metrics bytes.Buffer
+			l.WriteMetrics(&metrics)
+			if !strings.Contains(metrics.String(), "nslogger_decode_errors_total 1\n") {
+				t.Errorf("connection not counted as closed on a decoding error:\n%s", metrics.String())
+			}
+		})
+	}
+}
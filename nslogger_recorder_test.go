@@ -0,0 +1,196 @@
+package nslogger_test
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fouge/nslogger"
+)
+
+/** recordLogs sends n logs to a listener recording with r, waiting for each
+ * to be received and pause between them, then closes r. */
+func recordLogs(t *testing.T, r *nslogger.Recorder, n int, pause time.Duration) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := make(chan *nslogger.Message, 10)
+	l := &nslogger.Listener{Handler: nslogger.ChannelHandler(msgs), Recorder: r}
+	go l.Serve(ln)
+	defer l.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	logger, err := nslogger.NewLogger(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i <= n; i++ {
+		if i > 0 {
+			time.Sleep(pause)
+			logger.Log("", nslogger.LevelInfo, strings.Repeat("x", 100))
+		}
+		select {
+		case <-msgs: // recorded before delivered
+		case <-time.After(5 * time.Second):
+			t.Fatal("message not received")
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+/** recordedLogs returns the number of logs of each capture file, checking
+ * that each starts with the client info message. */
+func recordedLogs(t *testing.T, files []string) []int {
+	t.Helper()
+	var counts []int
+	for _, name := range files {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs, err := nslogger.Decode(b)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(msgs) == 0 || msgs[0].Type != nslogger.LogmsgTypeClientinfo {
+			t.Errorf("%s does not start with the client info", name)
+		}
+		counts = append(counts, len(msgs)-1)
+	}
+	return counts
+}
+
+func TestRecorderMaxSize(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "capture.rawnsloggerdata")
+	r, err := nslogger.NewRecorder(name, nslogger.RecordOptions{MaxSize: 400})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordLogs(t, r, 6, 0)
+
+	files := r.Files()
+	counts := recordedLogs(t, files)
+	total := 0
+	for _, n := range counts {
+		if n == 0 || n > 2 {
+			t.Errorf("files of %v logs, want 1 or 2 within 400 bytes", counts)
+		}
+		total += n
+	}
+	if total != 6 {
+		t.Errorf("%d logs recorded, want 6", total)
+	}
+
+	// Files created the same second are numbered
+	pattern := regexp.MustCompile(`^capture-\d{8}T\d{6}(-\d+)?\.rawnsloggerdata$`)
+	seen := make(map[string]bool)
+	numbered := false
+	for _, f := range files {
+		m := pattern.FindStringSubmatch(filepath.Base(f))
+		if m == nil || seen[f] {
+			t.Errorf("file names %q", files)
+			continue
+		}
+		seen[f] = true
+		numbered = numbered || m[1] != ""
+	}
+	if !numbered {
+		t.Errorf("file names %q, want some numbered within the same second", files)
+	}
+}
+
+func TestRecorderInterval(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "capture.rawnsloggerdata")
+	r, err := nslogger.NewRecorder(name, nslogger.RecordOptions{Interval: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordLogs(t, r, 3, 150*time.Millisecond)
+
+	// Windows are aligned on multiples of Interval, so that the client info
+	// may be alone in the first file
+	counts := recordedLogs(t, r.Files())
+	total := 0
+	for _, n := range counts {
+		if n > 1 {
+			t.Errorf("files of %v logs, want 1 log at most per window", counts)
+		}
+		total += n
+	}
+	if total != 3 {
+		t.Errorf("%d logs recorded, want 3", total)
+	}
+}
+
+func TestRecorderPrune(t *testing.T) {
+	dir := t.TempDir()
+	old := []string{"capture-20200101T000000.rawnsloggerdata", "capture-20200101T000000-2.rawnsloggerdata.gz", "capture-20200102T000000.rawnsloggerdata"}
+	for _, f := range append(old, "other.rawnsloggerdata") {
+		if err := os.WriteFile(filepath.Join(dir, f), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := nslogger.NewRecorder(filepath.Join(dir, "capture.rawnsloggerdata"), nslogger.RecordOptions{MaxSize: 400, MaxFiles: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordLogs(t, r, 6, 0)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	files := r.Files()
+	if len(names) != 4 || len(files) != 3 {
+		t.Fatalf("files %q left, recorder files %q, want the 3 last ones and other.rawnsloggerdata", names, files)
+	}
+	for _, f := range files {
+		if _, err := os.Stat(f); err != nil {
+			t.Error(err)
+		}
+	}
+	for _, f := range old {
+		if _, err := os.Stat(filepath.Join(dir, f)); !os.IsNotExist(err) {
+			t.Errorf("%s recorded by a previous run not deleted", f)
+		}
+	}
+}
+
+func TestRecorderCompress(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "capture.rawnsloggerdata")
+	r, err := nslogger.NewRecorder(name, nslogger.RecordOptions{MaxSize: 400, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordLogs(t, r, 6, 0)
+
+	files := r.Files()
+	for i, f := range files {
+		if compressed := strings.HasSuffix(f, ".gz"); compressed != (i < len(files)-1) {
+			t.Errorf("file %d of %d named %s", i+1, len(files), f)
+		}
+	}
+	total := 0
+	for _, n := range recordedLogs(t, files) {
+		total += n
+	}
+	if total != 6 {
+		t.Errorf("%d logs recorded, want 6", total)
+	}
+}
@@ -0,0 +1,16 @@
+package nslogger_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fouge/nslogger"
+)
+
+func TestExportSQLiteNoDriver(t *testing.T) {
+	err := nslogger.ExportSQLite(filepath.Join(t.TempDir(), "capture.db"), nil)
+	if err == nil || !strings.Contains(err.Error(), "not registered") {
+		t.Errorf("got %v, want an error about the driver to import", err)
+	}
+}
@@ -0,0 +1,129 @@
+package nslogger_test
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/fouge/nslogger"
+)
+
+func TestStitchTimeout(t *testing.T) {
+	tests := []struct {
+		timeout  time.Duration
+		sessions int // sessions of the messages of two connections of a client
+	}{
+		{time.Hour, 1},
+		{time.Millisecond, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.timeout.String(), func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			msgs := make(chan *nslogger.Message, 10)
+			l := &nslogger.Listener{Handler: nslogger.ChannelHandler(msgs), StitchSessions: true, StitchTimeout: tt.timeout}
+			go l.Serve(ln)
+			defer l.Close()
+
+			sessions := make(map[uint64]bool)
+			for i := 0; i < 2; i++ {
+				conn, err := net.Dial("tcp", ln.Addr().String())
+				if err != nil {
+					t.Fatal(err)
+				}
+				logger, err := nslogger.NewLogger(conn)
+				if err != nil {
+					t.Fatal(err)
+				}
+				logger.Log("", nslogger.LevelInfo, "hello")
+				conn.Close()
+				for m := range msgs {
+					sessions[m.SessionID] = true
+					if m.Type == nslogger.LogmsgTypeDisconnect {
+						break
+					}
+				}
+				for len(l.Sessions()) > 0 {
+					time.Sleep(time.Millisecond)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			if len(sessions) != tt.sessions {
+				t.Errorf("messages of %d sessions, want %d", len(sessions), tt.sessions)
+			}
+		})
+	}
+}
+
+// TestStitchQueued checks that the messages queued by FlowControl before a
+// client info telling a reconnection keep the session of their connection.
+func TestStitchQueued(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := make(chan *nslogger.Message, 100)
+	l := &nslogger.Listener{
+		Handler: func(m *nslogger.Message) {
+			time.Sleep(time.Millisecond)
+			msgs <- m
+		},
+		StitchSessions: true,
+		FlowControl:    nslogger.FlowControl{MaxQueued: 100},
+	}
+	go l.Serve(ln)
+	defer l.Close()
+	receive := func(n int) []*nslogger.Message {
+		var list []*nslogger.Message
+		for len(list) < n {
+			select {
+			case m := <-msgs:
+				list = append(list, m)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%d messages received, want %d", len(list), n)
+			}
+		}
+		return list
+	}
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+
+	logger, err := nslogger.NewLogger(dial())
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Log("", nslogger.LevelInfo, "first connection")
+	first := receive(2)[0].SessionID
+
+	// Logs before the client info of the second connection
+	var early bytes.Buffer
+	logger, _ = nslogger.NewLogger(&early)
+	early.Reset()
+	for i := 0; i < 5; i++ {
+		logger.Log("", nslogger.LevelInfo, "before client info")
+	}
+	conn := dial()
+	conn.Write(early.Bytes())
+	logger, err = nslogger.NewLogger(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		logger.Log("", nslogger.LevelInfo, "after client info")
+	}
+
+	for _, m := range receive(10) {
+		if stitched := m.Payload == "after client info"; stitched != (m.SessionID == first) {
+			t.Errorf("%v: session %d, first connection %d", m.Payload, m.SessionID, first)
+		}
+	}
+}
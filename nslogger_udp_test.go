@@ -0,0 +1,89 @@
+package nslogger_test
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fouge/nslogger"
+)
+
+/** udpDatagrams returns a client info message and a log, one frame each. */
+func udpDatagrams(t *testing.T) [][]byte {
+	t.Helper()
+	var buf bytes.Buffer
+	logger, err := nslogger.NewLogger(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientInfo := append([]byte(nil), buf.Bytes()...)
+	buf.Reset()
+	logger.Log("", nslogger.LevelInfo, "hello")
+	return [][]byte{clientInfo, buf.Bytes()}
+}
+
+func TestUDPBounds(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxClients int
+		maxQueued  int64
+		received   int // messages received from two clients sending two datagrams
+	}{
+		{"unbounded", 0, 0, 4},
+		{"max clients", 1, 0, 2},
+		{"max queued bytes", 0, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			msgs := make(chan *nslogger.Message, 10)
+			l := &nslogger.Listener{
+				UDPMaxClients:     tt.maxClients,
+				UDPMaxQueuedBytes: tt.maxQueued,
+				Handler: func(m *nslogger.Message) {
+					if m.Type != nslogger.LogmsgTypeDisconnect {
+						msgs <- m
+					}
+				},
+			}
+			go l.ServeUDP(pc)
+			defer l.Close()
+
+			for i := 0; i < 2; i++ {
+				conn, err := net.Dial("udp", pc.LocalAddr().String())
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer conn.Close()
+				for _, d := range udpDatagrams(t) {
+					conn.Write(d)
+				}
+			}
+
+			received := 0
+			for done := false; !done; {
+				select {
+				case <-msgs:
+					received++
+				case <-time.After(200 * time.Millisecond):
+					done = true
+				}
+			}
+			if received != tt.received {
+				t.Errorf("received %d messages, want %d", received, tt.received)
+			}
+			var metrics bytes.Buffer
+			l.WriteMetrics(&metrics)
+			dropped := fmt.Sprintf("nslogger_datagrams_dropped_total %d\n", 4-tt.received)
+			if !strings.Contains(metrics.String(), dropped) {
+				t.Errorf("metrics lack %q:\n%s", dropped, metrics.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package nslogger_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fouge/nslogger"
+)
+
+/** wsDial connects to the WebSocket handler of srv from a page of origin, if
+ * not empty, returning the connection once the handshake succeeded and the
+ * status of the handshake response. */
+func wsDial(t *testing.T, srv *httptest.Server, origin string) (net.Conn, *bufio.Reader, int) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, nil, resp.StatusCode
+	}
+	return conn, br, resp.StatusCode
+}
+
+/** wsFrame returns a final frame of type op carrying data, masked unless
+ * size is negative, announcing size bytes of payload if positive. */
+func wsFrame(op byte, data []byte, size int64) []byte {
+	frame := []byte{0x80 | op, 0x80}
+	n := uint64(len(data))
+	if size > 0 {
+		n = uint64(size)
+	} else if size < 0 {
+		frame[1] = 0
+	}
+	switch {
+	case n < 126:
+		frame[1] |= byte(n)
+	case n <= 0xffff:
+		frame[1] |= 126
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame[1] |= 127
+		frame = binary.BigEndian.AppendUint64(frame, n)
+	}
+	if size < 0 {
+		return append(frame, data...)
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame = append(frame, mask...)
+	for i, b := range data {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+/** wsCloseStatus reads frames until a close frame, returning its status. */
+func wsCloseStatus(t *testing.T, br *bufio.Reader) int {
+	t.Helper()
+	for {
+		var header [2]byte
+		if _, err := io.ReadFull(br, header[:]); err != nil {
+			t.Fatalf("no close frame: %v", err)
+		}
+		payload := make([]byte, header[1]&0x7f)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			t.Fatal(err)
+		}
+		if header[0]&0x0f == 0x8 && len(payload) >= 2 {
+			return int(binary.BigEndian.Uint16(payload))
+		}
+	}
+}
+
+func TestWebSocketHandler(t *testing.T) {
+	msgs := make(chan *nslogger.Message, 10)
+	l := &nslogger.Listener{
+		Handler: nslogger.ChannelHandler(msgs),
+		Options: []nslogger.Option{nslogger.WithLimits(nslogger.Limits{MaxMessageSize: 1024})},
+	}
+	srv := httptest.NewServer(l.WebSocketHandler())
+	defer srv.Close()
+
+	t.Run("log", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger, err := nslogger.NewLogger(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logger.Log("net", nslogger.LevelInfo, "hello")
+		conn, _, _ := wsDial(t, srv, "")
+		conn.Write(wsFrame(0x2, buf.Bytes(), 0))
+		for {
+			select {
+			case m := <-msgs:
+				if m.Type == nslogger.LogmsgTypeLog {
+					if m.Payload != "hello" {
+						t.Errorf("got %q, want hello", m.Payload)
+					}
+					return
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("no message received")
+			}
+		}
+	})
+
+	tests := []struct {
+		name   string
+		frame  []byte
+		status int
+	}{
+		{"unmasked", wsFrame(0x2, []byte{0, 0, 0, 0}, -1), 1002},
+		{"too large", wsFrame(0x2, nil, 1<<40), 1009},
+		{"control too large", wsFrame(0x9, nil, 200), 1002},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, br, _ := wsDial(t, srv, "")
+			conn.Write(tt.frame)
+			if status := wsCloseStatus(t, br); status != tt.status {
+				t.Errorf("closed with status %d, want %d", status, tt.status)
+			}
+		})
+	}
+}
+
+func TestWebSocketOrigins(t *testing.T) {
+	tests := []struct {
+		allowed []string
+		origin  string
+		status  int
+	}{
+		{nil, "", http.StatusSwitchingProtocols},
+		{nil, "self", http.StatusSwitchingProtocols},
+		{nil, "https://evil.example.com", http.StatusForbidden},
+		{[]string{"https://*.example.com"}, "https://app.example.com", http.StatusSwitchingProtocols},
+		{[]string{"https://*.example.com"}, "self", http.StatusForbidden},
+		{[]string{"*"}, "https://evil.example.com", http.StatusSwitchingProtocols},
+	}
+	for _, tt := range tests {
+		l := &nslogger.Listener{WebSocketOrigins: tt.allowed}
+		srv := httptest.NewServer(l.WebSocketHandler())
+		origin := strings.Replace(tt.origin, "self", srv.URL, 1)
+		if _, _, status := wsDial(t, srv, origin); status != tt.status {
+			t.Errorf("origins %q, origin %q: status %d, want %d", tt.allowed, tt.origin, status, tt.status)
+		}
+		srv.Close()
+	}
+}
@@ -0,0 +1,89 @@
+// Package zapcore sends the entries of zap loggers to an NSLogger viewer. It
+// is a module of its own so that the nslogger package does not depend on zap.
+package zapcore
+
+import (
+	"sort"
+
+	"github.com/fouge/nslogger"
+	"go.uber.org/zap/zapcore"
+)
+
+// Core is a zapcore.Core sending entries to an NSLogger viewer through a
+// nslogger.FieldLogger, which maps their fields to the tag and the text of
+// the messages, and optionally to user-defined parts.
+type Core struct {
+	zapcore.LevelEnabler
+	fl     *nslogger.FieldLogger
+	fields []zapcore.Field
+}
+
+// NewCore returns a Core sending the entries of the levels enabled by enab
+// through fl.
+func NewCore(fl *nslogger.FieldLogger, enab zapcore.LevelEnabler) *Core {
+	return &Core{LevelEnabler: enab, fl: fl}
+}
+
+// With returns a Core adding fields to every entry.
+func (c *Core) With(fields []zapcore.Field) zapcore.Core {
+	c2 := *c
+	c2.fields = append(append([]zapcore.Field(nil), c.fields...), fields...)
+	return &c2
+}
+
+// Check adds c to ce if the level of e is enabled.
+func (c *Core) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(e.Level) {
+		return ce.AddCore(e, c)
+	}
+	return ce
+}
+
+// Write sends e with fields to the viewer. Fields in namespaces have their
+// keys prefixed with the namespace names, separated by dots.
+func (c *Core) Write(e zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+
+	entry := nslogger.LogEntry{
+		Time:    e.Time,
+		Level:   nslogger.ZapLevel(int8(e.Level)),
+		Message: e.Message,
+		Fields:  flatten(nil, "", enc.Fields),
+	}
+	if e.Caller.Defined {
+		entry.File = e.Caller.File
+		entry.Line = e.Caller.Line
+		entry.Function = e.Caller.Function
+	}
+	return c.fl.Log(entry)
+}
+
+// Sync does nothing, the messages being written as they are logged.
+func (c *Core) Sync() error {
+	return nil
+}
+
+/** flatten appends the fields of m to fields sorted by key, along with the
+ * fields of its namespaces, their keys prefixed with prefix and the
+ * namespace names. */
+func flatten(fields []nslogger.Field, prefix string, m map[string]any) []nslogger.Field {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if ns, ok := m[key].(map[string]any); ok {
+			fields = flatten(fields, prefix+key+".", ns)
+			continue
+		}
+		fields = append(fields, nslogger.Field{Key: prefix + key, Value: m[key]})
+	}
+	return fields
+}
@@ -0,0 +1,37 @@
+package zapcore_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/fouge/nslogger"
+	nszap "github.com/fouge/nslogger/zapcore"
+	"go.uber.org/zap"
+)
+
+func TestCore(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := nslogger.NewLogger(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fl := nslogger.NewFieldLogger(l, nil)
+	logger := zap.New(nszap.NewCore(fl, zap.InfoLevel), zap.AddCaller()).With(zap.String("tag", "network"))
+	logger.Debug("not sent")
+	logger.Warn("request sent", zap.Int("status", 200), zap.Namespace("req"), zap.String("method", "GET"))
+
+	msgs, err := nslogger.Decode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("got %d messages, want the client info and 1 log", len(msgs))
+	}
+	m := msgs[1]
+	if m.Tag != "network" || m.Level != nslogger.LevelWarning || m.Payload != "request sent req.method=GET status=200" {
+		t.Errorf("got tag %q, level %d, text %q", m.Tag, m.Level, m.Payload)
+	}
+	if m.Filename == "" || m.LineNumber == 0 {
+		t.Errorf("caller not sent")
+	}
+}